@@ -0,0 +1,123 @@
+package kslog
+
+import (
+	"net/http"
+	"time"
+)
+
+// AccessLogConfig configures the access log of HTTPMiddlewareConfig.
+type AccessLogConfig struct {
+	// Module is the module of the records, "http" by default, and Code
+	// their code.
+	Module string
+	Code   int32
+	// Levels are the levels of requests by status class, 2 for 2xx and
+	// so on. Classes missing are logged at INFO, 4xx at WARNING and 5xx
+	// at ERROR.
+	Levels map[int]Level
+}
+
+// HTTPMiddleware logs every request next serves with the default access
+// log configuration.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return HTTPMiddlewareConfig(AccessLogConfig{}, next)
+}
+
+// HTTPMiddlewareConfig logs every request next serves, once it is served,
+// with its method, path, status, response size, duration, remote address
+// and correlation ID as fields. The correlation ID is the one the
+// request's context carries or, with CorrelationMiddleware inside the
+// access log, the one of the response:
+//
+//	http.ListenAndServe(addr, kslog.HTTPMiddleware(kslog.CorrelationMiddleware(mux)))
+func HTTPMiddlewareConfig(config AccessLogConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		config.LogRequest(r, w.Header(), sw.status, sw.size, time.Since(start))
+	})
+}
+
+// LogRequest logs a request served, for middleware of other frameworks:
+// header is the header of the response, status and size those of its
+// body, and fields are logged along.
+func (this *AccessLogConfig) LogRequest(r *http.Request, header http.Header, status int, size int64, elapsed time.Duration, fields ...Field) {
+	module := this.Module
+	if module == "" {
+		module = "http"
+	}
+	level := this.level(status)
+	if !logging.admit(level, module, this.Code) {
+		return
+	}
+
+	all := ContextFields(r.Context())
+	if CorrelationID(r.Context()) == "" && header.Get(RequestIDHeader) != "" {
+		all = append(all, String("correlation_id", header.Get(RequestIDHeader)))
+	}
+	all = append(all,
+		String("method", r.Method),
+		String("path", r.URL.Path),
+		Int("status", status),
+		Int64("size", size),
+		Duration("duration", elapsed),
+		String("remote", r.RemoteAddr),
+		NoCaller,
+	)
+	all = append(all, fields...)
+	logging.outputFields(level, this.Code, module, r.Method+" "+r.URL.Path, all, false)
+}
+
+// level returns the level of a request answered with status.
+func (this *AccessLogConfig) level(status int) Level {
+	class := status / 100
+	if level, ok := this.Levels[class]; ok {
+		return level
+	}
+	switch class {
+	case 4:
+		return WARNING
+	case 5:
+		return ERROR
+	}
+	return INFO
+}
+
+// statusWriter notes the status and size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (this *statusWriter) WriteHeader(status int) {
+	if this.status == 0 && status >= 200 {
+		this.status = status
+	}
+	this.ResponseWriter.WriteHeader(status)
+}
+
+func (this *statusWriter) Write(p []byte) (int, error) {
+	if this.status == 0 {
+		this.status = http.StatusOK
+	}
+	n, err := this.ResponseWriter.Write(p)
+	this.size += int64(n)
+	return n, err
+}
+
+// Flush flushes the response if it can be.
+func (this *statusWriter) Flush() {
+	if f, ok := this.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the response writer.
+func (this *statusWriter) Unwrap() http.ResponseWriter {
+	return this.ResponseWriter
+}
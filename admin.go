@@ -0,0 +1,215 @@
+package kslog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AdminHandler returns an http.Handler to inspect and control the logger
+// at runtime, like net/http/pprof does for profiles. It answers in JSON:
+//
+//	GET    /level                      the level
+//	POST   /level?level=DEBUG          sets the level
+//	GET    /modules                    the module levels
+//	POST   /modules?module=db&level=DEBUG
+//	DELETE /modules?module=db          sets or clears a module level
+//	GET    /sinks                      the sinks, numbered from 0
+//	POST   /sinks?sink=2&enabled=false disables or enables a sink
+//	POST   /sinks?sink=2&level=ERROR   sets the level of a sink
+//	GET    /stats                      the queue and the counters
+//
+// It expects its paths with any prefix stripped, and has no access
+// control of its own; serve it on an internal address only:
+//
+//	mux.Handle("/debug/kslog/", http.StripPrefix("/debug/kslog", kslog.AdminHandler()))
+func (this *logger) AdminHandler() http.Handler {
+	return &adminHandler{this}
+}
+
+// AdminHandler returns an http.Handler controlling the default logger.
+func AdminHandler() http.Handler {
+	return logging.AdminHandler()
+}
+
+type adminHandler struct {
+	l *logger
+}
+
+// adminSink is a sink as /sinks shows it.
+type adminSink struct {
+	Sink      int    `json:"sink"`
+	Type      string `json:"type"`
+	Level     string `json:"level"`
+	Enabled   bool   `json:"enabled"`
+	Failures  uint64 `json:"failures"`
+	Dropped   uint64 `json:"dropped"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// adminStats is what /stats shows, with counters by level name.
+type adminStats struct {
+	QueueDepth int               `json:"queue_depth"`
+	QueueSize  int               `json:"queue_size"`
+	HighWater  int               `json:"high_water"`
+	Lag        string            `json:"lag"`
+	Emitted    map[string]uint64 `json:"emitted"`
+	Dropped    map[string]uint64 `json:"dropped"`
+	Sampled    map[string]uint64 `json:"sampled"`
+	Limited    map[string]uint64 `json:"limited"`
+}
+
+func (this *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var result interface{}
+	var err error
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/level":
+		result, err = this.level(r)
+	case "/modules":
+		result, err = this.modules(r)
+	case "/sinks":
+		result, err = this.sinks(r)
+	case "/stats":
+		result, err = this.stats(r)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == errMethod {
+			status = http.StatusMethodNotAllowed
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(result)
+}
+
+var errMethod = errors.New("Method not allowed")
+
+func (this *adminHandler) level(r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		level, err := ParseLevel(r.FormValue("level"))
+		if err != nil {
+			return nil, err
+		}
+		this.l.SetLevel(level)
+	default:
+		return nil, errMethod
+	}
+	return map[string]string{"level": this.l.GetLevel().String()}, nil
+}
+
+func (this *adminHandler) modules(r *http.Request) (interface{}, error) {
+	module := r.FormValue("module")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		if module == "" {
+			return nil, errors.New("No module given")
+		}
+		level, err := ParseLevel(r.FormValue("level"))
+		if err != nil {
+			return nil, err
+		}
+		this.l.SetModuleLevel(module, level)
+	case http.MethodDelete:
+		if module == "" {
+			return nil, errors.New("No module given")
+		}
+		this.l.ClearModuleLevel(module)
+	default:
+		return nil, errMethod
+	}
+
+	levels := make(map[string]string)
+	for module, level := range this.l.ModuleLevels() {
+		levels[module] = level.String()
+	}
+	return levels, nil
+}
+
+func (this *adminHandler) sinks(r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		i, err := strconv.Atoi(r.FormValue("sink"))
+		if err != nil {
+			return nil, fmt.Errorf("Bad sink %q", r.FormValue("sink"))
+		}
+		sinks := this.l.Stats().Sinks
+		if i < 0 || i >= len(sinks) {
+			return nil, fmt.Errorf("No sink %d", i)
+		}
+		if s := r.FormValue("level"); s != "" {
+			level, err := ParseLevel(s)
+			if err != nil {
+				return nil, err
+			}
+			this.l.SetSinkLevel(sinks[i].Sink, level)
+		}
+		if s := r.FormValue("enabled"); s != "" {
+			on, err := strconv.ParseBool(s)
+			if err != nil {
+				return nil, fmt.Errorf("Bad enabled %q", s)
+			}
+			this.l.SetSinkEnabled(sinks[i].Sink, on)
+		}
+	default:
+		return nil, errMethod
+	}
+
+	health, stats := this.l.Health().Sinks, this.l.Stats().Sinks
+	sinks := []adminSink{}
+	for i, ss := range stats {
+		s := adminSink{
+			Sink:     i,
+			Type:     fmt.Sprintf("%T", ss.Sink),
+			Level:    ss.Level.String(),
+			Enabled:  !ss.Disabled,
+			Failures: ss.Failures,
+			Dropped:  ss.Dropped,
+		}
+		// The sinks may have changed in between.
+		if len(health) == len(stats) && health[i].LastError != nil {
+			s.LastError = health[i].LastError.Error()
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+func (this *adminHandler) stats(r *http.Request) (interface{}, error) {
+	if r.Method != http.MethodGet {
+		return nil, errMethod
+	}
+	h, st := this.l.Health(), this.l.Stats()
+	return &adminStats{
+		QueueDepth: h.QueueDepth,
+		QueueSize:  h.QueueSize,
+		HighWater:  h.HighWater,
+		Lag:        h.Lag.String(),
+		Emitted:    byLevel(&st.Emitted),
+		Dropped:    byLevel(&st.Dropped),
+		Sampled:    byLevel(&st.Sampled),
+		Limited:    byLevel(&st.Limited),
+	}, nil
+}
+
+func byLevel(counts *[MAXLEVEL]uint64) map[string]uint64 {
+	m := make(map[string]uint64, MAXLEVEL)
+	for l, n := range counts {
+		m[Level(l).String()] = n
+	}
+	return m
+}
@@ -0,0 +1,147 @@
+package kslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AlertRule matches records and fires when more than Count of them are
+// logged within Window, e.g. to page on any EMERGE:
+//
+//	kslog.AddAlert(kslog.AlertRule{Name: "emerge"}, kslog.AlertWebhook(url))
+//
+// or to circuit-break on a burst of timeouts:
+//
+//	kslog.AddAlert(kslog.AlertRule{Name: "db timeouts", Code: 9002, Level: kslog.DEBUG2, Count: 10, Window: time.Minute}, breaker.Trip)
+type AlertRule struct {
+	Name string
+	// Level is the least severe level matched, EMERGE unless set; Code
+	// and Module, when set, are the only code and module matched. The
+	// records of module "kslog" are only matched by that Module.
+	Level  Level
+	Code   int32
+	Module string
+	// Count is how many records within Window are tolerated, none by
+	// default. Without a Window every Count+1 records fire.
+	Count  int
+	Window time.Duration
+}
+
+// Alert is what a rule fired on.
+type Alert struct {
+	Rule AlertRule
+	// Count is how many records matched within the window, and Record
+	// the last of them.
+	Count  int
+	Record *Record
+	Time   time.Time
+}
+
+// alertState is a rule with its callback and the times of the records it
+// matched lately. They are only used by the goroutine writing records.
+type alertState struct {
+	rule     AlertRule
+	callback func(Alert)
+	times    []time.Time
+}
+
+// alerts are the rules of a logger, replaced as a whole when one is added.
+type alerts struct {
+	rules atomic.Pointer[[]*alertState]
+	mu    sync.Mutex
+}
+
+// AddAlert calls callback, on a goroutine of its own, whenever rule
+// fires. Rules are checked as records are written, so records dropped by
+// levels, filters, sampling or a full queue don't count.
+func (this *logger) AddAlert(rule AlertRule, callback func(Alert)) {
+	this.alerts.mu.Lock()
+	defer this.alerts.mu.Unlock()
+
+	var rules []*alertState
+	if old := this.alerts.rules.Load(); old != nil {
+		rules = append(rules, *old...)
+	}
+	rules = append(rules, &alertState{rule: rule, callback: callback})
+	this.alerts.rules.Store(&rules)
+}
+
+// ClearAlerts removes the alert rules.
+func (this *logger) ClearAlerts() {
+	this.alerts.rules.Store(nil)
+}
+
+// AddAlert adds an alert rule to the default logger.
+func AddAlert(rule AlertRule, callback func(Alert)) {
+	logging.AddAlert(rule, callback)
+}
+
+// ClearAlerts removes the alert rules of the default logger.
+func ClearAlerts() {
+	logging.ClearAlerts()
+}
+
+// checkAlerts fires the rules r makes fire.
+func (this *logger) checkAlerts(r *Record) {
+	rules := this.alerts.rules.Load()
+	if rules == nil {
+		return
+	}
+	for _, a := range *rules {
+		if !a.matches(r) {
+			continue
+		}
+		now := this.now()
+		a.times = append(a.times, now)
+		if a.rule.Window > 0 {
+			i := 0
+			for i < len(a.times) && now.Sub(a.times[i]) > a.rule.Window {
+				i++
+			}
+			a.times = a.times[i:]
+		}
+		if len(a.times) > a.rule.Count {
+			go a.callback(Alert{Rule: a.rule, Count: len(a.times), Record: r.Clone(), Time: now})
+			a.times = nil
+		}
+	}
+}
+
+func (this *alertState) matches(r *Record) bool {
+	if r.Level > this.rule.Level || this.rule.Code != 0 && r.Code != this.rule.Code {
+		return false
+	}
+	if this.rule.Module == "" {
+		return r.Module != "kslog"
+	}
+	return r.Module == this.rule.Module
+}
+
+// AlertWebhook returns a callback posting alerts to url as JSON objects
+// with the rule's name, the count and the last record. Posts that fail
+// are logged as ERRORs of module "kslog".
+func AlertWebhook(url string) func(Alert) {
+	client := newHTTPClient(nil)
+	return func(alert Alert) {
+		body, _ := json.Marshal(map[string]interface{}{
+			"rule":   alert.Rule.Name,
+			"count":  alert.Count,
+			"time":   alert.Time,
+			"record": json.RawMessage(encodeJSON(alert.Record)),
+		})
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("Webhook answered %s", resp.Status)
+			}
+		}
+		if err != nil {
+			Errorf("kslog", 0, "Alert %s not posted: %v", alert.Rule.Name, err)
+		}
+	}
+}
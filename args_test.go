@@ -0,0 +1,48 @@
+package kslog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArgsOddCount(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		args []interface{}
+		want map[string]interface{}
+	}{
+		{"none", nil, map[string]interface{}{}},
+		{"pairs", []interface{}{"a", 1, "b", 2}, map[string]interface{}{"a": 1, "b": 2}},
+		{"value only", []interface{}{1}, map[string]interface{}{badKey: 1}},
+		{"last value", []interface{}{"a", 1, "b"}, map[string]interface{}{"a": 1, badKey: "b"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := make(map[string]interface{})
+			args2map(got, test.args...)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestArgsNonStringKey(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		args []interface{}
+		want map[string]interface{}
+	}{
+		{"int", []interface{}{1, "a", "b", 2}, map[string]interface{}{
+			"1": "a", "b": 2, keyWarning: "Key 1 is a int, not a string"}},
+		{"stringer", []interface{}{ERROR, "a"}, map[string]interface{}{
+			ERROR.String(): "a", keyWarning: "Key " + ERROR.String() + " is a kslog.Level, not a string"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := make(map[string]interface{})
+			args2map(got, test.args...)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
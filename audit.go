@@ -0,0 +1,138 @@
+package kslog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// auditLog is the audit trail of a logger, kept apart from its sinks.
+type auditLog struct {
+	mu sync.Mutex
+	// sink is where audit records go, the default audit file until set.
+	sink   Sink
+	seq    uint64
+	closed bool
+}
+
+// defaultAuditConfig is the configuration of the default audit file.
+func defaultAuditConfig() FileSinkConfig {
+	return FileSinkConfig{Name: "{program}.audit.log.{time}.{pid}", Append: true, Format: JSONFormatter, BufferSize: -1}
+}
+
+// SetAuditSink sends the audit trail to s, closing the sink it went to.
+func (this *logger) SetAuditSink(s Sink) error {
+	this.audit.mu.Lock()
+	defer this.audit.mu.Unlock()
+
+	var err error
+	if this.audit.sink != nil {
+		err = this.audit.sink.Close()
+	}
+	this.audit.sink = s
+	return err
+}
+
+// SetAuditFile sends the audit trail to a file configured by config, with
+// rotation and retention of its own. Records are always appended: a file
+// in Dir is named like a FileSinkConfig with Append set, by default
+// <program>.audit.log. The format defaults to JSONFormatter, and records
+// are written straight to the file unless a BufferSize is set.
+func (this *logger) SetAuditFile(config FileSinkConfig) error {
+	config.Append = true
+	if config.Name == "" {
+		config.Name = defaultAuditConfig().Name
+	}
+	if config.Format == nil {
+		config.Format = JSONFormatter
+	}
+	if config.BufferSize == 0 {
+		config.BufferSize = -1
+	}
+	s, err := OpenFileSink(config)
+	if err != nil {
+		return err
+	}
+	return this.SetAuditSink(s)
+}
+
+// SetAuditSink sends the audit trail of the default logger to s.
+func SetAuditSink(s Sink) error {
+	return logging.SetAuditSink(s)
+}
+
+// SetAuditFile sends the audit trail of the default logger to a file.
+func SetAuditFile(config FileSinkConfig) error {
+	return logging.SetAuditFile(config)
+}
+
+// Audit records that actor did action to target in the audit trail, for
+// compliance: a record of module and code at NOTICE with "actor",
+// "action" and "target" args, numbered in sequence. Audit records go
+// only to the audit sink, by default <program>.audit.log in the default
+// directory, see SetAuditFile, and are written before Audit returns;
+// levels, filters, sampling and rate limits don't apply to them. An error
+// writing one is returned, and logged as an ERROR.
+func Audit(module string, code int32, actor, action, target string, fields ...Field) error {
+	return logging.writeAudit(module, code, actor, action, target, fields)
+}
+
+func (this *logger) writeAudit(module string, code int32, actor, action, target string, fields []Field) error {
+	file, line := "", 0
+	if !this.noCaller.Load() {
+		file, line = getCaller(3)
+	}
+	r := this.newItem(NOTICE, code, module, action, file, line)
+	r.fields = append(r.fields, fields...)
+	expandFields(r)
+	r.Args["actor"] = actor
+	r.Args["action"] = action
+	r.Args["target"] = target
+	redactRecord(r)
+	scrubRecord(r)
+	sanitizeRecord(r)
+
+	err := this.audit.write(r)
+	releaseRecord(r)
+	if err != nil {
+		self := "kslog"
+		message := fmt.Sprintf("Audit record not written: %v", err)
+		this.printex(ERROR, &self, 0, &message, "actor", actor, "action", action, "target", target)
+	}
+	return err
+}
+
+// write writes r to the audit sink, opening the default audit file if
+// there is none.
+func (this *auditLog) write(r *Record) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return errors.New("Logger is shut down")
+	}
+	if this.sink == nil {
+		this.sink = newFileSink(defaultAuditConfig())
+	}
+	this.seq++
+	r.Seq = this.seq
+	if err := this.sink.Write(r); err != nil {
+		return err
+	}
+	if b, ok := this.sink.(BatchSink); ok {
+		return b.EndBatch()
+	}
+	return nil
+}
+
+// close closes the audit sink for good.
+func (this *auditLog) close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.closed = true
+	if this.sink == nil {
+		return nil
+	}
+	return this.sink.Close()
+}
@@ -0,0 +1,135 @@
+package kslog
+
+import "sync/atomic"
+
+// Policies for a full record queue, see SetBackpressure.
+const (
+	// BackpressureBlock makes the logging call wait for room.
+	BackpressureBlock = iota
+	// BackpressureDropNewest discards the record being logged.
+	BackpressureDropNewest
+	// BackpressureDropOldest discards the oldest queued record to make
+	// room. While records of levels that block are queued, or waiting for
+	// room, the new record is discarded instead, so that the queue stays
+	// in order and the call doesn't wait.
+	BackpressureDropOldest
+)
+
+// SetBackpressure sets what logging calls at level and less severe levels
+// do when the sink goroutine falls behind and the queue is full. All
+// levels block by default; to never drop ERROR and more severe records,
+// but not stall on the rest:
+//
+//	kslog.SetBackpressure(kslog.WARNING, kslog.BackpressureDropOldest)
+func (this *logger) SetBackpressure(level Level, policy int) {
+	for l := level; l < MAXLEVEL; l++ {
+		atomic.StoreInt32(&this.backpressure[l], int32(policy))
+	}
+}
+
+// SetBackpressure sets the queue policy of the default logger.
+func SetBackpressure(level Level, policy int) {
+	logging.SetBackpressure(level, policy)
+}
+
+func (this *logger) policy(level Level) int32 {
+	if level >= MAXLEVEL {
+		level = MAXLEVEL - 1
+	}
+	return atomic.LoadInt32(&this.backpressure[level])
+}
+
+// countDropped counts r as dropped.
+func (this *logger) countDropped(r *Record) {
+	if r.Level < MAXLEVEL {
+		this.dropped[r.Level].Add(1)
+	}
+}
+
+// enqueue hands r to the sink goroutine according to its level's policy,
+// reporting whether it wasn't dropped.
+func (this *logger) enqueue(r *Record) bool {
+	r.Seq = this.seq.Add(1)
+	if r.Level < MAXLEVEL {
+		this.emitted[r.Level].Add(1)
+	}
+	this.metrics.count(r)
+	if this.sync.Load() {
+		this.writeNow(r)
+		return true
+	}
+
+	policy := this.policy(r.Level)
+	if policy == BackpressureDropOldest && this.queue.size() == 0 {
+		// An unbuffered queue holds nothing that could be dropped.
+		policy = BackpressureDropNewest
+	}
+
+	queued := true
+	switch policy {
+	case BackpressureDropNewest:
+		if !this.queue.push(r, false) {
+			this.countDropped(r)
+			releaseRecord(r)
+			queued = false
+		}
+
+	case BackpressureDropOldest:
+		for !this.queue.push(r, false) {
+			if !this.dropOldest() {
+				this.countDropped(r)
+				releaseRecord(r)
+				queued = false
+				break
+			}
+		}
+
+	default:
+		this.pushKept(r, true)
+	}
+
+	depth := int64(this.queue.len())
+	for {
+		high := this.highWater.Load()
+		if depth <= high || this.highWater.CompareAndSwap(high, depth) {
+			break
+		}
+	}
+	return queued
+}
+
+// pushKept queues r, a record BackpressureDropOldest may not drop, like
+// queue.push.
+func (this *logger) pushKept(r *Record, wait bool) bool {
+	r.keep = true
+	this.keeping.RLock()
+	defer this.keeping.RUnlock()
+
+	this.kept.Add(1)
+	if !this.queue.push(r, wait) {
+		this.kept.Add(-1)
+		return false
+	}
+	return true
+}
+
+// dropOldest drops the oldest queued record to make room, and reports
+// whether it may: not while records that may not be dropped are queued or
+// being queued, which keeps the oldest record one that may.
+func (this *logger) dropOldest() bool {
+	if !this.keeping.TryLock() {
+		return false
+	}
+	var old *Record
+	ok := this.kept.Load() == 0
+	if ok {
+		old = this.queue.pop(false)
+	}
+	this.keeping.Unlock()
+
+	if old != nil {
+		this.countDropped(old)
+		releaseRecord(old)
+	}
+	return ok
+}
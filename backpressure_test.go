@@ -0,0 +1,94 @@
+package kslog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingSink blocks writing its first record until released.
+type blockingSink struct {
+	recordSink
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (this *blockingSink) Write(r *Record) error {
+	if this.entered != nil {
+		close(this.entered)
+		this.entered = nil
+		<-this.release
+	}
+	return this.recordSink.Write(r)
+}
+
+func TestBackpressureDropOldest(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		// logged are the records logged once the sink is stuck, E at
+		// ERROR, which blocks, and the others at INFO, which drops the
+		// oldest.
+		logged  string
+		written string
+	}{
+		{"infos", "abcdx", "-bcdx"},
+		{"kept error", "Eabcx", "-Eabc"},
+		{"kept error last", "abcEx", "-abcE"},
+	} {
+		for _, q := range []struct {
+			name string
+			l    *logger
+		}{
+			{"chan", NewLoggerQueue(4)},
+			{"ring", NewLoggerRing(4)},
+		} {
+			t.Run(test.name+"/"+q.name, func(t *testing.T) {
+				l := q.l
+				l.ResetSinks()
+				sink := &blockingSink{entered: make(chan struct{}), release: make(chan struct{})}
+				entered := sink.entered
+				l.AddSink(sink)
+				l.SetBackpressure(WARNING, BackpressureDropOldest)
+
+				module := "test"
+				l.printf(INFO, &module, 0, "-")
+				<-entered
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					for _, c := range test.logged {
+						level := INFO
+						if c == 'E' {
+							level = ERROR
+						}
+						l.printf(level, &module, 0, "%c", c)
+					}
+				}()
+				select {
+				case <-done:
+				case <-time.After(5 * time.Second):
+					t.Fatal("logging blocked on the full queue")
+				}
+				close(sink.release)
+				l.Flush()
+
+				var written strings.Builder
+				var last uint64
+				for _, r := range sink.records {
+					written.WriteString(r.Message)
+					if r.Seq <= last {
+						t.Errorf("record %d after %d", r.Seq, last)
+					}
+					last = r.Seq
+				}
+				if written.String() != test.written {
+					t.Errorf("got %q, want %q", written.String(), test.written)
+				}
+				if got := fmt.Sprint(l.dropped[INFO].Load()); got != "1" {
+					t.Errorf("got %s INFO records dropped, want 1", got)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package kslog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultMaxRetries    = 3
+)
+
+// Special MaxRetries of the network sinks' configs, whose zero value
+// stands for the default of 3 retries.
+const (
+	// RetryForever keeps retrying a failed batch until the sink is
+	// closed.
+	RetryForever = -1
+	// NoRetries gives a batch up when it fails the first time.
+	NoRetries = -2
+)
+
+// maxRetries returns the retries a MaxRetries of a config stands for,
+// negative for retrying forever.
+func maxRetries(n int) int {
+	switch {
+	case n == 0:
+		return defaultMaxRetries
+	case n == NoRetries:
+		return 0
+	case n < 0:
+		return RetryForever
+	}
+	return n
+}
+
+// errPending is what records dropped for too many pending fail with.
+var errPending = errors.New("Too many records pending")
+
+// permanentError marks a flush failure that retrying won't fix.
+type permanentError struct {
+	error
+}
+
+// retryAfterError is a retryable flush failure where the server told us
+// how long to wait.
+type retryAfterError struct {
+	error
+	after time.Duration
+}
+
+// partialError is a flush failure affecting only records. They are sent
+// again unless final is set, in which case they are dropped. The records
+// in rejected are dropped right away either way.
+type partialError struct {
+	error
+	records  []*Record
+	final    bool
+	rejected []*Record
+}
+
+// batcher collects records and hands them to flush in batches, either
+// when size records are pending or every interval, from its own goroutine.
+// Failed batches are retried with exponential backoff up to retries times,
+// see maxRetries, before they are dropped and handed to fail, if set. At
+// most limit records are kept pending; past that the oldest are dropped
+// and handed to fail as well. Batches given up on also go
+// to fallback, which the logger the sink is attached to sets.
+type batcher struct {
+	size     int
+	interval time.Duration
+	retries  int
+	limit    int
+	flush    func([]*Record) error
+	fail     func([]*Record, error)
+	fallback atomic.Pointer[func(*Record, error)]
+
+	mu      sync.Mutex
+	pending []*Record
+	dropped uint64
+
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	exit      chan struct{}
+}
+
+func newBatcher(size int, interval time.Duration, retries int, flush func([]*Record) error, fail func([]*Record, error)) *batcher {
+	if size < 1 {
+		size = defaultBatchSize
+	}
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	b := &batcher{
+		size:     size,
+		interval: interval,
+		retries:  maxRetries(retries),
+		limit:    size * 10,
+		flush:    flush,
+		fail:     fail,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		exit:     make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+func (this *batcher) add(r *Record) {
+	this.mu.Lock()
+	var over []*Record
+	if len(this.pending) >= this.limit {
+		over = this.pending[:1]
+		this.pending = this.pending[1:]
+	}
+	this.pending = append(this.pending, r.Clone())
+	full := len(this.pending) >= this.size
+	this.mu.Unlock()
+
+	this.drop(over, errPending)
+
+	if full {
+		select {
+		case this.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// setLimit changes how many records are kept pending.
+func (this *batcher) setLimit(limit int) {
+	this.mu.Lock()
+	this.limit = limit
+	var over []*Record
+	if n := len(this.pending) - limit; n > 0 {
+		over = this.pending[:n]
+		this.pending = this.pending[n:]
+	}
+	this.mu.Unlock()
+
+	this.drop(over, errPending)
+}
+
+func (this *batcher) take() []*Record {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	n := len(this.pending)
+	if n > this.size {
+		n = this.size
+	}
+	batch := this.pending[:n:n]
+	this.pending = this.pending[n:]
+	return batch
+}
+
+func (this *batcher) droppedCount() uint64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.dropped
+}
+
+// close flushes whatever is pending and stops the goroutine. Closing
+// again waits for it as well.
+func (this *batcher) close() {
+	this.closeOnce.Do(func() { close(this.done) })
+	<-this.exit
+}
+
+func (this *batcher) loop() {
+	ticker := time.NewTicker(this.interval)
+	defer ticker.Stop()
+	defer close(this.exit)
+
+	for {
+		closing := false
+		select {
+		case <-this.wake:
+		case <-ticker.C:
+		case <-this.done:
+			closing = true
+		}
+
+		for {
+			batch := this.take()
+			if len(batch) == 0 {
+				break
+			}
+			this.send(batch, closing)
+		}
+
+		if closing {
+			return
+		}
+	}
+}
+
+func (this *batcher) send(batch []*Record, closing bool) {
+	var err error
+	backoff := netMinBackoff
+
+	for attempt := 0; ; attempt++ {
+		err = this.flush(batch)
+		if err == nil {
+			return
+		}
+		pe, partial := err.(partialError)
+		if partial {
+			if len(pe.rejected) > 0 {
+				this.drop(pe.rejected, err)
+			}
+			batch = pe.records
+		}
+		if _, ok := err.(permanentError); ok || (partial && pe.final) || (this.retries >= 0 && attempt >= this.retries) || closing {
+			break
+		}
+
+		wait := backoff
+		if ra, ok := err.(retryAfterError); ok && ra.after > wait {
+			wait = ra.after
+		}
+		select {
+		case <-time.After(wait):
+		case <-this.done:
+			closing = true
+		}
+		if backoff *= 2; backoff > netMaxBackoff {
+			backoff = netMaxBackoff
+		}
+	}
+
+	this.drop(batch, err)
+}
+
+// drop counts the records of batch, which failed with err, as dropped and
+// hands them to fail and fallback.
+func (this *batcher) drop(batch []*Record, err error) {
+	if len(batch) == 0 {
+		return
+	}
+	this.mu.Lock()
+	this.dropped += uint64(len(batch))
+	this.mu.Unlock()
+
+	notifyError(fmt.Errorf("Dropped %d records: %w", len(batch), err))
+	if this.fail != nil {
+		this.fail(batch, err)
+	}
+	if f := this.fallback.Load(); f != nil {
+		for _, r := range batch {
+			(*f)(r, err)
+		}
+	}
+}
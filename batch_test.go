@@ -0,0 +1,188 @@
+package kslog
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flushScript is a flush func answering its calls with errs in turn, nil
+// once they run out, and keeping the batches and times of the calls.
+type flushScript struct {
+	mu      sync.Mutex
+	errs    []func(batch []*Record) error
+	batches [][]*Record
+	times   []time.Time
+}
+
+func (this *flushScript) flush(batch []*Record) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.batches = append(this.batches, batch)
+	this.times = append(this.times, time.Now())
+	if len(this.batches) > len(this.errs) {
+		return nil
+	}
+	return this.errs[len(this.batches)-1](batch)
+}
+
+func fails(err error) func([]*Record) error {
+	return func([]*Record) error { return err }
+}
+
+// messages returns the messages of the records of batch i.
+func (this *flushScript) messages(i int) string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	s := ""
+	for _, r := range this.batches[i] {
+		s += r.Message
+	}
+	return s
+}
+
+func TestBatcher(t *testing.T) {
+	transient := errors.New("transient")
+	for _, test := range []struct {
+		name    string
+		retries int
+		errs    []func([]*Record) error
+		// calls are the messages of the batches flushed, failed those
+		// handed to fail.
+		calls   []string
+		failed  string
+		dropped uint64
+	}{
+		{name: "ok", calls: []string{"abc"}},
+		{name: "retried", errs: []func([]*Record) error{fails(transient), fails(transient)}, calls: []string{"abc", "abc", "abc"}},
+		{name: "no retries", retries: NoRetries, errs: []func([]*Record) error{fails(transient)}, calls: []string{"abc"}, failed: "abc", dropped: 3},
+		{name: "retries used up", retries: 2, errs: []func([]*Record) error{fails(transient), fails(transient), fails(transient)},
+			calls: []string{"abc", "abc", "abc"}, failed: "abc", dropped: 3},
+		{name: "permanent", errs: []func([]*Record) error{fails(permanentError{transient})}, calls: []string{"abc"}, failed: "abc", dropped: 3},
+		{name: "partial", errs: []func([]*Record) error{func(b []*Record) error { return partialError{transient, b[1:], false, nil} }},
+			calls: []string{"abc", "bc"}},
+		{name: "partial final", errs: []func([]*Record) error{func(b []*Record) error { return partialError{transient, b[1:], true, nil} }},
+			calls: []string{"abc"}, failed: "bc", dropped: 2},
+		{name: "partial rejected", errs: []func([]*Record) error{func(b []*Record) error { return partialError{transient, b[2:], false, b[:1]} }},
+			calls: []string{"abc", "c"}, failed: "a", dropped: 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			script := &flushScript{errs: test.errs}
+			var mu sync.Mutex
+			failed := ""
+			b := newBatcher(3, time.Hour, test.retries, script.flush, func(batch []*Record, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				for _, r := range batch {
+					failed += r.Message
+				}
+			})
+			for _, m := range []string{"a", "b", "c"} {
+				b.add(&Record{Message: m})
+			}
+			// Wait for the calls rather than close, which stops retrying.
+			for i := 0; i < 500; i++ {
+				script.mu.Lock()
+				n := len(script.batches)
+				script.mu.Unlock()
+				if n >= len(test.calls) {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			b.close()
+
+			if len(script.batches) != len(test.calls) {
+				t.Fatalf("got %d calls, want %d", len(script.batches), len(test.calls))
+			}
+			for i, want := range test.calls {
+				if got := script.messages(i); got != want {
+					t.Errorf("call %d got %q, want %q", i, got, want)
+				}
+			}
+			if failed != test.failed || b.droppedCount() != test.dropped {
+				t.Errorf("got %q failed, %d dropped, want %q, %d", failed, b.droppedCount(), test.failed, test.dropped)
+			}
+		})
+	}
+}
+
+func TestBatcherBackoff(t *testing.T) {
+	transient := errors.New("transient")
+	script := &flushScript{errs: []func([]*Record) error{
+		fails(transient),
+		fails(transient),
+		fails(retryAfterError{transient, 500 * time.Millisecond}),
+	}}
+	b := newBatcher(1, time.Hour, 3, script.flush, nil)
+	b.add(&Record{Message: "a"})
+	for i := 0; i < 200; i++ {
+		script.mu.Lock()
+		n := len(script.times)
+		script.mu.Unlock()
+		if n == 4 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.close()
+
+	if len(script.times) != 4 {
+		t.Fatalf("got %d calls, want 4", len(script.times))
+	}
+	// The waits double from netMinBackoff unless Retry-After asks for more.
+	for i, want := range []time.Duration{netMinBackoff, 2 * netMinBackoff, 500 * time.Millisecond} {
+		if got := script.times[i+1].Sub(script.times[i]); got < want {
+			t.Errorf("retry %d after %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestBatcherLimit(t *testing.T) {
+	// The first flush blocks until released, so records pile up.
+	release := make(chan struct{})
+	var once sync.Once
+	var mu sync.Mutex
+	var got []string
+	var failed []string
+	b := newBatcher(1, time.Hour, 1, func(batch []*Record) error {
+		once.Do(func() { <-release })
+		mu.Lock()
+		got = append(got, batch[0].Message)
+		mu.Unlock()
+		return nil
+	}, func(batch []*Record, err error) {
+		if err != errPending {
+			t.Errorf("got %v", err)
+		}
+		for _, r := range batch {
+			failed = append(failed, r.Message)
+		}
+	})
+	b.setLimit(2)
+
+	b.add(&Record{Message: "a"})
+	for i := 0; i < 100; i++ {
+		b.mu.Lock()
+		n := len(b.pending)
+		b.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, m := range []string{"b", "c", "d", "e"} {
+		b.add(&Record{Message: m})
+	}
+	b.setLimit(1)
+	close(release)
+	b.close()
+	// Closing again doesn't panic.
+	b.close()
+
+	if s := strings.Join(got, ""); s != "ae" || b.droppedCount() != 3 || strings.Join(failed, "") != "bcd" {
+		t.Errorf("sent %q, dropped %d and failed %q, want the oldest waiting records dropped", s, b.droppedCount(), failed)
+	}
+}
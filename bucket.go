@@ -0,0 +1,39 @@
+package kslog
+
+import (
+	"time"
+)
+
+// tokenBucket allows burst events at once and rate events per second on
+// average. It is not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// allow takes a token if one is available at now.
+func (this *tokenBucket) allow(now time.Time) bool {
+	if !this.last.IsZero() {
+		this.tokens += now.Sub(this.last).Seconds() * this.rate
+		if this.tokens > this.burst {
+			this.tokens = this.burst
+		}
+	}
+	this.last = now
+
+	if this.tokens < 1 {
+		return false
+	}
+	this.tokens--
+	return true
+}
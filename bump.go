@@ -0,0 +1,62 @@
+package kslog
+
+import (
+	"sync"
+	"time"
+)
+
+// levelBump is a temporary change of the level, see BumpLevelOnSignal.
+type levelBump struct {
+	mu    sync.Mutex
+	base  Level
+	timer *time.Timer
+}
+
+// bumpLevel makes the logger's level step levels more verbose, or less
+// when step is negative, and has it go back after revert; zero or
+// negative keeps the new level. Bumps add up, and revert counts from the
+// last one. It logs a NOTICE of module "kslog" saying so.
+func (this *logger) bumpLevel(step int, revert time.Duration) {
+	b := &this.bump
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := this.GetLevel()
+	if b.timer == nil {
+		b.base = current
+	} else {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	level := int(current) + step
+	if level < int(EMERGE) {
+		level = int(EMERGE)
+	}
+	if level > int(DEBUG2) {
+		level = int(DEBUG2)
+	}
+	this.SetLevel(Level(level))
+
+	message := "Level set to " + Level(level).String()
+	if revert > 0 && Level(level) != b.base {
+		b.timer = time.AfterFunc(revert, this.revertLevel)
+		message += " for " + revert.String()
+	}
+	module := "kslog"
+	this.printex(NOTICE, &module, 0, &message)
+}
+
+// revertLevel restores the level from before the first bump.
+func (this *logger) revertLevel() {
+	b := &this.bump
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.timer == nil {
+		return
+	}
+	b.timer = nil
+	this.SetLevel(b.base)
+	module, message := "kslog", "Level set back to "+b.base.String()
+	this.printex(NOTICE, &module, 0, &message)
+}
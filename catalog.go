@@ -0,0 +1,102 @@
+package kslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// catalog holds the message templates by code, see SetCatalog.
+var catalog atomic.Pointer[map[int32]string]
+
+// SetCatalog sets the message templates Code logs codes with, replacing
+// those set before, e.g. with a catalog in the operators' language. A
+// template names the args of the call between braces:
+//
+//	kslog.SetCatalog(map[int32]string{1203: "User {user} not found in {realm}"})
+//	kslog.Code(1203, "user", u, "realm", realm)
+func SetCatalog(templates map[int32]string) {
+	c := make(map[int32]string, len(templates))
+	for code, template := range templates {
+		c[code] = template
+	}
+	catalog.Store(&c)
+}
+
+// LoadCatalog sets the message templates from a JSON file mapping codes to
+// templates, see SetCatalog:
+//
+//	{"1203": "User {user} not found in {realm}"}
+func LoadCatalog(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var byName map[string]string
+	if err := json.Unmarshal(data, &byName); err != nil {
+		return fmt.Errorf("Bad catalog %s: %v", path, err)
+	}
+	templates := make(map[int32]string, len(byName))
+	for name, template := range byName {
+		code, err := strconv.ParseInt(name, 10, 32)
+		if err != nil {
+			return fmt.Errorf("Bad catalog %s: code %q", path, name)
+		}
+		templates[int32(code)] = template
+	}
+	SetCatalog(templates)
+	return nil
+}
+
+// Code logs code with the message of its template in the catalog, filled
+// in with args, key value pairs which are logged as well. Like LogCode,
+// the code is logged at its level and for its module if registered, see
+// RegisterCode, and as an ERROR of module "kslog" otherwise. Codes
+// without a template are logged with their registered name, or their
+// number.
+func Code(code int32, args ...interface{}) {
+	level, module, name := ERROR, "kslog", ""
+	if codes := codeRegistry.Load(); codes != nil {
+		if info := (*codes)[code]; info != nil {
+			level, module, name = info.Level, info.Module, info.Name
+		}
+	}
+	if !logging.moduleEnabled(level, module) {
+		return
+	}
+	message := codeMessage(code, name, args)
+	logging.printex(level, &module, code, &message, args...)
+}
+
+// codeMessage returns the message code is logged with.
+func codeMessage(code int32, name string, args []interface{}) string {
+	var template string
+	if c := catalog.Load(); c != nil {
+		template = (*c)[code]
+	}
+	switch {
+	case template != "":
+		return fillTemplate(template, args)
+	case name != "":
+		return name
+	}
+	return "Code " + strconv.Itoa(int(code))
+}
+
+// fillTemplate replaces the {key} placeholders of template by the values
+// of key in args; placeholders of no key are left as they are.
+func fillTemplate(template string, args []interface{}) string {
+	if !strings.Contains(template, "{") {
+		return template
+	}
+	pairs := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		if key, ok := args[i].(string); ok {
+			pairs = append(pairs, "{"+key+"}", fmt.Sprint(args[i+1]))
+		}
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
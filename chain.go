@@ -0,0 +1,229 @@
+package kslog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+const chainCheckpointEvery = 100
+
+// ChainConfig configures ChainFormatter.
+type ChainConfig struct {
+	// SigningKey, when set, signs a checkpoint of the chain every
+	// CheckpointEvery records, 100 by default.
+	SigningKey      ed25519.PrivateKey
+	CheckpointEvery int
+}
+
+// chainFormatter holds the state of a hash chain.
+type chainFormatter struct {
+	config ChainConfig
+	mu     sync.Mutex
+	seq    uint64
+	prev   string
+}
+
+// ChainFormatter returns a Formatter for tamper-evident logs: JSON lines
+// that carry a sequence number, the hash of the previous record and their
+// own SHA-256 hash, so that no record can be changed, removed or inserted
+// without breaking the chain. Check a log with VerifyChain.
+//
+// Every formatter starts a new chain; give each sink its own. For files,
+// set FileSinkConfig.Chain instead: it also signs a checkpoint whenever a
+// file is closed or rotated, so that cutting records off its end shows.
+func ChainFormatter(config ChainConfig) Formatter {
+	return newChainFormatter(config).format
+}
+
+func newChainFormatter(config ChainConfig) *chainFormatter {
+	if config.CheckpointEvery <= 0 {
+		config.CheckpointEvery = chainCheckpointEvery
+	}
+	return &chainFormatter{config: config, prev: hex.EncodeToString(make([]byte, sha256.Size))}
+}
+
+func chainSigned(seq uint64, hash string, closed bool) []byte {
+	signed := "kslog checkpoint " + strconv.FormatUint(seq, 10) + " " + hash
+	if closed {
+		signed += " closed"
+	}
+	return []byte(signed)
+}
+
+func (this *chainFormatter) format(r *Record) []byte {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	body := new(bytes.Buffer)
+	fmt.Fprintf(body, `{"seq":%d,"prev":"%s",`, this.seq, this.prev)
+	// The chain numbers records itself.
+	plain := *r
+	plain.Seq = 0
+	body.Write(encodeJSON(&plain)[1:])
+
+	sum := sha256.Sum256(body.Bytes())
+	hash := hex.EncodeToString(sum[:])
+
+	out := body.Bytes()
+	out = append(out[:len(out)-1], `,"hash":"`+hash+"\"}\n"...)
+
+	if this.config.SigningKey != nil && (this.seq+1)%uint64(this.config.CheckpointEvery) == 0 {
+		out = append(out, this.sign(this.seq, hash, false)...)
+	}
+
+	this.seq++
+	this.prev = hash
+	return out
+}
+
+// sign returns the checkpoint line of the chain up to record seq of hash,
+// closing the file if closed is set.
+func (this *chainFormatter) sign(seq uint64, hash string, closed bool) []byte {
+	sig := ed25519.Sign(this.config.SigningKey, chainSigned(seq, hash, closed))
+	line := fmt.Sprintf(`{"checkpoint":%d,"hash":"%s",`, seq, hash)
+	if closed {
+		line += `"closed":true,`
+	}
+	return []byte(line + `"sig":"` + base64.StdEncoding.EncodeToString(sig) + "\"}\n")
+}
+
+// head returns the link of the record formatted last.
+func (this *chainFormatter) head() chainLink {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return chainLink{seq: this.seq - 1, hash: this.prev}
+}
+
+// closing returns the checkpoint line closing a file that ends with link,
+// or nil without a signing key.
+func (this *chainFormatter) closing(link chainLink) []byte {
+	if this.config.SigningKey == nil {
+		return nil
+	}
+	return this.sign(link.seq, link.hash, true)
+}
+
+// chainLink is a record's place in a chain.
+type chainLink struct {
+	seq  uint64
+	hash string
+}
+
+// ChainReport is what VerifyChain found in a log.
+type ChainReport struct {
+	// Records is how many records were verified.
+	Records int
+	// Checkpoints is how many signed checkpoints were verified, and
+	// Unsigned how many records follow the last of them.
+	Checkpoints int
+	Unsigned    int
+	// Closed is set when the log ends with the checkpoint signed as its
+	// file was closed or rotated, see FileSinkConfig.Chain. A log cut
+	// short lacks it.
+	Closed bool
+	// FirstSeq and FirstPrev are the sequence number of the first record
+	// and the hash of the record before it, which a rotated file starts
+	// from, LastSeq and LastHash those of the last record. A file follows
+	// another when its FirstPrev is the other's LastHash.
+	FirstSeq  uint64
+	FirstPrev string
+	LastSeq   uint64
+	LastHash  string
+}
+
+// VerifyChain checks a log written with ChainFormatter, returning an error
+// naming the first line that was tampered with. With publicKey set, the
+// checkpoints' signatures are checked too; the report tells how many
+// records no checkpoint vouches for, and whether the file was closed
+// properly. The first record is taken as it is, so that files rotated
+// away from a chain verify on their own, and one with sequence number 0
+// starts a new chain, as after a restart.
+func VerifyChain(r io.Reader, publicKey ed25519.PublicKey) (ChainReport, error) {
+	var report ChainReport
+	var seq uint64
+	prev := ""
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Bytes()
+		if len(text) == 0 {
+			continue
+		}
+
+		var fields struct {
+			Seq        *uint64 `json:"seq"`
+			Prev       string  `json:"prev"`
+			Hash       string  `json:"hash"`
+			Checkpoint *uint64 `json:"checkpoint"`
+			Closed     bool    `json:"closed"`
+			Sig        string  `json:"sig"`
+		}
+		if err := json.Unmarshal(text, &fields); err != nil {
+			return report, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		if fields.Checkpoint != nil {
+			if report.Records == 0 || *fields.Checkpoint+1 != seq || fields.Hash != prev {
+				return report, fmt.Errorf("line %d: checkpoint doesn't match the chain", line)
+			}
+			if publicKey != nil {
+				sig, err := base64.StdEncoding.DecodeString(fields.Sig)
+				if err != nil || !ed25519.Verify(publicKey, chainSigned(*fields.Checkpoint, fields.Hash, fields.Closed), sig) {
+					return report, fmt.Errorf("line %d: bad checkpoint signature", line)
+				}
+				report.Checkpoints++
+				report.Unsigned = 0
+			}
+			report.Closed = fields.Closed
+			continue
+		}
+
+		if fields.Seq == nil {
+			return report, fmt.Errorf("line %d: not a chained record", line)
+		}
+		switch {
+		case report.Records == 0:
+			report.FirstSeq, report.FirstPrev = *fields.Seq, fields.Prev
+		case *fields.Seq == 0:
+		case *fields.Seq != seq:
+			return report, fmt.Errorf("line %d: record %d doesn't follow record %d", line, *fields.Seq, seq-1)
+		case fields.Prev != prev:
+			return report, fmt.Errorf("line %d: record %d doesn't follow the hash of record %d", line, *fields.Seq, seq-1)
+		}
+
+		suffix := `,"hash":"` + fields.Hash + `"}`
+		if !bytes.HasSuffix(text, []byte(suffix)) {
+			return report, fmt.Errorf("line %d: hash is not the last field", line)
+		}
+		body := append(append([]byte(nil), text[:len(text)-len(suffix)]...), '}')
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != fields.Hash {
+			return report, fmt.Errorf("line %d: record %d was modified", line, *fields.Seq)
+		}
+
+		seq = *fields.Seq + 1
+		prev = fields.Hash
+		report.LastSeq, report.LastHash = *fields.Seq, fields.Hash
+		report.Records++
+		report.Closed = false
+		report.Unsigned++
+	}
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+	if report.Records == 0 {
+		return report, errors.New("No chained records found")
+	}
+	return report, nil
+}
@@ -0,0 +1,160 @@
+package kslog
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeChain writes n records to a chained file sink configured by config
+// and closes it.
+func writeChain(t *testing.T, config FileSinkConfig, n int) {
+	t.Helper()
+	config.BufferSize = -1
+	s, err := OpenFileSink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := s.Write(&Record{Message: fmt.Sprintf("record %d", i), Level: INFO}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func verifyLines(lines []string, key ed25519.PublicKey) (ChainReport, error) {
+	return VerifyChain(strings.NewReader(strings.Join(lines, "")), key)
+}
+
+func TestChainVerify(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	path := filepath.Join(t.TempDir(), "x.log")
+	writeChain(t, FileSinkConfig{Path: path, Chain: &ChainConfig{SigningKey: private, CheckpointEvery: 4}}, 10)
+	lines := readLines(t, path)
+
+	report, err := verifyLines(lines, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Checkpoints after records 3 and 7, and when the file was closed.
+	if report.Records != 10 || report.Checkpoints != 3 || report.Unsigned != 0 || !report.Closed ||
+		report.FirstSeq != 0 || report.LastSeq != 9 {
+		t.Errorf("got %+v", report)
+	}
+}
+
+func TestChainTamper(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	path := filepath.Join(t.TempDir(), "x.log")
+	writeChain(t, FileSinkConfig{Path: path, Chain: &ChainConfig{SigningKey: private, CheckpointEvery: 4}}, 10)
+	lines := readLines(t, path)
+	otherPublic, _, _ := ed25519.GenerateKey(nil)
+
+	without := func(i int) []string {
+		return append(append([]string(nil), lines[:i]...), lines[i+1:]...)
+	}
+	changed := append([]string(nil), lines...)
+	changed[2] = strings.Replace(changed[2], "record 2", "record X", 1)
+	swapped := append([]string(nil), lines...)
+	swapped[1], swapped[2] = swapped[2], swapped[1]
+	inserted := append(append(append([]string(nil), lines[:3]...), lines[2]), lines[3:]...)
+	forged := append([]string(nil), lines...)
+	forged[4] = strings.Replace(forged[4], `"sig"`, `"closed":true,"sig"`, 1)
+
+	for _, test := range []struct {
+		name  string
+		lines []string
+		key   ed25519.PublicKey
+		err   string
+	}{
+		{"changed", changed, public, "line 3: record 2 was modified"},
+		{"removed", without(2), public, "line 3: record 3 doesn't follow record 1"},
+		{"swapped", swapped, public, "line 2: record 2 doesn't follow record 0"},
+		{"inserted", inserted, public, "line 4: record 2 doesn't follow record 2"},
+		{"forged closing", forged, public, "line 5: bad checkpoint signature"},
+		{"other key", lines, otherPublic, "line 5: bad checkpoint signature"},
+	} {
+		_, err := verifyLines(test.lines, test.key)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: got %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestChainTruncate(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	path := filepath.Join(t.TempDir(), "x.log")
+	writeChain(t, FileSinkConfig{Path: path, Chain: &ChainConfig{SigningKey: private, CheckpointEvery: 4}}, 10)
+	lines := readLines(t, path)
+	if !strings.Contains(lines[len(lines)-1], `"checkpoint":9`) {
+		t.Fatalf("the file doesn't end with a checkpoint: %s", lines[len(lines)-1])
+	}
+
+	// Cutting off any lines, even down to an earlier checkpoint, loses the
+	// closing checkpoint.
+	for _, n := range []int{1, 2, 3} {
+		report, err := verifyLines(lines[:len(lines)-n], public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Closed {
+			t.Errorf("%d lines cut off: got %+v, want it not closed", n, report)
+		}
+	}
+	report, _ := verifyLines(lines[:len(lines)-1], public)
+	if report.Unsigned != 2 {
+		t.Errorf("got %d unsigned records, want 2", report.Unsigned)
+	}
+}
+
+func TestChainRotate(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	dir := t.TempDir()
+	writeChain(t, FileSinkConfig{Path: filepath.Join(dir, "x.log"), MaxSize: 1000, Chain: &ChainConfig{SigningKey: private, CheckpointEvery: 4}}, 20)
+
+	// The rotated files, oldest first, then the current one.
+	files, _ := filepath.Glob(filepath.Join(dir, "x.log.*"))
+	sort.Strings(files)
+	files = append(files, filepath.Join(dir, "x.log"))
+	if len(files) < 3 {
+		t.Fatalf("got %d files, want the log rotated", len(files))
+	}
+
+	var last ChainReport
+	records := 0
+	for i, f := range files {
+		data, _ := os.ReadFile(f)
+		report, err := VerifyChain(bytes.NewReader(data), public)
+		if err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		if report.Unsigned != 0 || !report.Closed {
+			t.Errorf("%s: %d unsigned records, closed %v", f, report.Unsigned, report.Closed)
+		}
+		if i > 0 && (report.FirstSeq != last.LastSeq+1 || report.FirstPrev != last.LastHash) {
+			t.Errorf("%s doesn't follow the file before: %+v after %+v", f, report, last)
+		}
+		records += report.Records
+		last = report
+	}
+	if records != 20 {
+		t.Errorf("got %d records, want 20", records)
+	}
+}
@@ -0,0 +1,41 @@
+package kslog
+
+import "time"
+
+// Clock tells the time records are stamped with and file sinks rotate
+// by, so that tests can set it; see kslogtest.Clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// SetClock sets the clock records are stamped with; nil restores the
+// system clock. Set the Clock of a FileSinkConfig for rotation and
+// retention.
+func (this *logger) SetClock(c Clock) {
+	if c == nil {
+		this.clock.Store(nil)
+		return
+	}
+	this.clock.Store(&c)
+}
+
+// SetClock sets the clock of the default logger.
+func SetClock(c Clock) {
+	logging.SetClock(c)
+}
+
+// now returns the time of the logger's clock.
+func (this *logger) now() time.Time {
+	if c := this.clock.Load(); c != nil {
+		return (*c).Now()
+	}
+	return time.Now()
+}
+
+// clockNow returns the time of c, or of the system clock if c is nil.
+func clockNow(c Clock) time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
@@ -0,0 +1,250 @@
+package kslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PutLogEvents limits.
+const (
+	cloudwatchMaxEvents     = 10000
+	cloudwatchMaxBatchBytes = 1048576
+	cloudwatchEventOverhead = 26
+	cloudwatchMaxEventBytes = 262144 - cloudwatchEventOverhead
+	cloudwatchMaxSpan       = 24 * time.Hour
+)
+
+// CloudWatchSinkConfig configures a CloudWatchSink.
+type CloudWatchSinkConfig struct {
+	LogGroup string
+	// LogStream defaults to the program name; it is created if missing.
+	LogStream string
+	// Region defaults to AWS_REGION or AWS_DEFAULT_REGION.
+	Region string
+	// Credentials defaults to reading AWS_ACCESS_KEY_ID,
+	// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN on every request.
+	Credentials func() (AWSCredentials, error)
+	// Endpoint overrides https://logs.<region>.amazonaws.com.
+	Endpoint string
+	// BatchSize, FlushInterval and MaxRetries default to 100, 1s and 3;
+	// see NoRetries and RetryForever.
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+}
+
+// CloudWatchSink sends records to AWS CloudWatch Logs with PutLogEvents,
+// splitting batches to stay within the API's count, size and time span
+// limits.
+type CloudWatchSink struct {
+	config   CloudWatchSinkConfig
+	client   *http.Client
+	token    string
+	hasToken bool
+	batch    *batcher
+}
+
+type cloudwatchEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+type cloudwatchError struct {
+	Type                  string `json:"__type"`
+	Message               string `json:"message"`
+	ExpectedSequenceToken string `json:"expectedSequenceToken"`
+}
+
+// NewCloudWatchSink returns a sink writing to config.LogGroup.
+func NewCloudWatchSink(config CloudWatchSinkConfig) *CloudWatchSink {
+	if config.LogStream == "" {
+		config.LogStream = getProgram()
+	}
+	if config.Region == "" {
+		config.Region = awsEnvRegion()
+	}
+	if config.Credentials == nil {
+		config.Credentials = awsEnvCredentials
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://logs." + config.Region + ".amazonaws.com"
+	}
+	if config.BatchSize > cloudwatchMaxEvents {
+		config.BatchSize = cloudwatchMaxEvents
+	}
+
+	s := &CloudWatchSink{
+		config: config,
+		client: newHTTPClient(nil),
+	}
+	s.batch = newBatcher(config.BatchSize, config.FlushInterval, config.MaxRetries, s.flush, nil)
+	return s
+}
+
+func (this *CloudWatchSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *CloudWatchSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *CloudWatchSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close sends what is still pending and stops the sink.
+func (this *CloudWatchSink) Close() error {
+	this.batch.close()
+	return nil
+}
+
+func (this *CloudWatchSink) flush(records []*Record) error {
+	// Events in a call must be in chronological order; records from
+	// concurrent goroutines may reach the sink slightly out of it.
+	records = append([]*Record(nil), records...)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+
+	var events []cloudwatchEvent
+	size := 0
+
+	for i, r := range records {
+		msg := strings.TrimSuffix(fileLine(r), "\n")
+		if len(msg) > cloudwatchMaxEventBytes {
+			msg = msg[:cloudwatchMaxEventBytes]
+		}
+		ev := cloudwatchEvent{Timestamp: r.Time.UnixNano() / int64(time.Millisecond), Message: msg}
+
+		if len(events) > 0 && (size+len(msg)+cloudwatchEventOverhead > cloudwatchMaxBatchBytes ||
+			time.Duration(ev.Timestamp-events[0].Timestamp)*time.Millisecond >= cloudwatchMaxSpan) {
+			if err := this.put(events); err != nil {
+				_, final := err.(permanentError)
+				return partialError{err, records[i-len(events):], final, nil}
+			}
+			events, size = nil, 0
+		}
+		events = append(events, ev)
+		size += len(msg) + cloudwatchEventOverhead
+	}
+
+	if err := this.put(events); err != nil {
+		_, final := err.(permanentError)
+		return partialError{err, records[len(records)-len(events):], final, nil}
+	}
+	return nil
+}
+
+// put sends one PutLogEvents call, creating the stream and picking up the
+// expected sequence token as needed.
+func (this *CloudWatchSink) put(events []cloudwatchEvent) error {
+	for attempt := 0; attempt < 3; attempt++ {
+		req := map[string]interface{}{
+			"logGroupName":  this.config.LogGroup,
+			"logStreamName": this.config.LogStream,
+			"logEvents":     events,
+		}
+		if this.hasToken {
+			req["sequenceToken"] = this.token
+		}
+
+		var resp struct {
+			NextSequenceToken string `json:"nextSequenceToken"`
+		}
+		cwerr, err := this.call("PutLogEvents", req, &resp)
+		if err != nil {
+			return err
+		}
+		if cwerr == nil {
+			this.token, this.hasToken = resp.NextSequenceToken, resp.NextSequenceToken != ""
+			return nil
+		}
+
+		switch cwerr.Type {
+		case "InvalidSequenceTokenException", "DataAlreadyAcceptedException":
+			this.token, this.hasToken = cwerr.ExpectedSequenceToken, cwerr.ExpectedSequenceToken != ""
+			if cwerr.Type == "DataAlreadyAcceptedException" {
+				return nil
+			}
+		case "ResourceNotFoundException":
+			create := map[string]interface{}{
+				"logGroupName":  this.config.LogGroup,
+				"logStreamName": this.config.LogStream,
+			}
+			cerr, err := this.call("CreateLogStream", create, nil)
+			if err != nil {
+				return err
+			}
+			if cerr != nil && cerr.Type != "ResourceAlreadyExistsException" {
+				return permanentError{errors.New(cerr.Type + ": " + cerr.Message)}
+			}
+			this.hasToken = false
+		case "ThrottlingException", "ServiceUnavailableException":
+			return errors.New(cwerr.Type + ": " + cwerr.Message)
+		default:
+			return permanentError{errors.New(cwerr.Type + ": " + cwerr.Message)}
+		}
+	}
+	return errors.New("CloudWatch sequence token kept changing")
+}
+
+// call invokes a CloudWatch Logs action. Service side failures are returned
+// as a cloudwatchError, transport failures as error.
+func (this *CloudWatchSink) call(action string, in interface{}, out interface{}) (*cloudwatchError, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, permanentError{err}
+	}
+
+	creds, err := this.config.Credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", this.config.Endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "Logs_20140328."+action)
+	awsSign(req, body, creds, this.config.Region, "logs", time.Now())
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		if out != nil {
+			json.Unmarshal(data, out)
+		}
+		return nil, nil
+	}
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("%s: %s", action, resp.Status)
+	}
+
+	cwerr := new(cloudwatchError)
+	if err := json.Unmarshal(data, cwerr); err != nil || cwerr.Type == "" {
+		return nil, permanentError{fmt.Errorf("%s: %s", action, resp.Status)}
+	}
+	if i := strings.LastIndex(cwerr.Type, "#"); i >= 0 {
+		cwerr.Type = cwerr.Type[i+1:]
+	}
+	return cwerr, nil
+}
@@ -0,0 +1,135 @@
+package kslog
+
+// codeRules are the rules of SetCodeLevel and RouteCodes.
+type codeRules struct {
+	levels []codeLevel
+	routes []codeRoute
+}
+
+// codeLevel drops records of codes from to to more verbose than level.
+type codeLevel struct {
+	from, to int32
+	level    Level
+}
+
+// codeRoute hands records of codes from to to only to sinks.
+type codeRoute struct {
+	from, to int32
+	sinks    []Sink
+}
+
+// SetCodeLevel drops the records with a code from from to to that are
+// more verbose than level, e.g. to keep client errors quiet:
+//
+//	kslog.SetCodeLevel(400, 499, kslog.WARNING)
+//
+// Ranges set later take precedence where they overlap. Records dropped are
+// not even built.
+func (this *logger) SetCodeLevel(from, to int32, level Level) {
+	this.updateCodeRules(func(rules *codeRules) {
+		rules.levels = append([]codeLevel{{from, to, level}}, rules.levels...)
+	})
+}
+
+// RouteCodes hands the records with a code from from to to only to sinks,
+// which then get no other records than those routed to them, e.g. to keep
+// an audit trail of its own:
+//
+//	kslog.AddSink(audit)
+//	kslog.RouteCodes(1000, 1999, audit)
+//
+// The sinks must be attached to the logger. Ranges routed later take
+// precedence where they overlap.
+func (this *logger) RouteCodes(from, to int32, sinks ...Sink) {
+	this.updateCodeRules(func(rules *codeRules) {
+		rules.routes = append([]codeRoute{{from, to, sinks}}, rules.routes...)
+	})
+}
+
+// ClearCodeRules removes the code levels and routes.
+func (this *logger) ClearCodeRules() {
+	this.codeRules.Store(nil)
+}
+
+// updateCodeRules replaces the code rules with a copy changed by update.
+func (this *logger) updateCodeRules(update func(rules *codeRules)) {
+	this.codeRulesMu.Lock()
+	defer this.codeRulesMu.Unlock()
+
+	rules := new(codeRules)
+	if old := this.codeRules.Load(); old != nil {
+		*rules = *old
+	}
+	update(rules)
+	this.codeRules.Store(rules)
+}
+
+// codeAllowed reports whether the code levels let a record at level with
+// code through.
+func (this *logger) codeAllowed(level Level, code int32) bool {
+	rules := this.codeRules.Load()
+	if rules == nil {
+		return true
+	}
+	for _, l := range rules.levels {
+		if code >= l.from && code <= l.to {
+			return level <= l.level
+		}
+	}
+	return true
+}
+
+// routeFor returns the route of code, or nil.
+func (this *codeRules) routeFor(code int32) *codeRoute {
+	for i, r := range this.routes {
+		if code >= r.from && code <= r.to {
+			return &this.routes[i]
+		}
+	}
+	return nil
+}
+
+// routed reports whether s is one of the sinks records are routed to.
+func (this *codeRules) routed(s Sink) bool {
+	for _, r := range this.routes {
+		if r.has(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *codeRoute) has(s Sink) bool {
+	for _, rs := range this.sinks {
+		if rs == s {
+			return true
+		}
+	}
+	return false
+}
+
+// gets reports whether the code routes let e have a record with code.
+func (this *codeRules) gets(e *sinkEntry, code int32) bool {
+	if len(this.routes) == 0 {
+		return true
+	}
+	if r := this.routeFor(code); r != nil {
+		return r.has(e.sink)
+	}
+	return !this.routed(e.sink)
+}
+
+// SetCodeLevel sets the level of a code range in the default logger.
+func SetCodeLevel(from, to int32, level Level) {
+	logging.SetCodeLevel(from, to, level)
+}
+
+// RouteCodes routes a code range of the default logger to sinks.
+func RouteCodes(from, to int32, sinks ...Sink) {
+	logging.RouteCodes(from, to, sinks...)
+}
+
+// ClearCodeRules removes the code rules of the default logger.
+func ClearCodeRules() {
+	logging.ClearCodeRules()
+}
@@ -0,0 +1,124 @@
+package kslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// CodeInfo describes a registered code, see RegisterCode.
+type CodeInfo struct {
+	Code        int32  `json:"code"`
+	Module      string `json:"module"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Level is the level LogCode logs the code at.
+	Level Level `json:"-"`
+}
+
+// MarshalJSON includes the level by name.
+func (this CodeInfo) MarshalJSON() ([]byte, error) {
+	type plain CodeInfo
+	return json.Marshal(struct {
+		plain
+		Level string `json:"level"`
+	}{plain(this), this.Level.String()})
+}
+
+// codeRegistry holds the registered codes; it is replaced as a whole when
+// a code is registered, which is rare, so that logging only reads it.
+var (
+	codeRegistry   atomic.Pointer[map[int32]*CodeInfo]
+	codeRegistryMu sync.Mutex
+)
+
+// RegisterCode registers code as a code of module, so that records with it
+// carry its name under the "code_name" key and the catalog of codes can be
+// exported with ExportCodes for the ops runbook. Once a code is
+// registered, records with a code that isn't, or that is registered for
+// another module, carry what is wrong under the "code_error" key; code 0
+// is exempt. Registering a code again for another module or name fails.
+func RegisterCode(code int32, module, name, description string, defaultLevel Level) error {
+	codeRegistryMu.Lock()
+	defer codeRegistryMu.Unlock()
+
+	codes := make(map[int32]*CodeInfo)
+	if old := codeRegistry.Load(); old != nil {
+		for c, info := range *old {
+			codes[c] = info
+		}
+	}
+	if info := codes[code]; info != nil && (info.Module != module || info.Name != name) {
+		return fmt.Errorf("Code %d is already registered as %s of module %s", code, info.Name, info.Module)
+	}
+	codes[code] = &CodeInfo{code, module, name, description, defaultLevel}
+	codeRegistry.Store(&codes)
+	return nil
+}
+
+// LookupCode returns what code was registered with, or nil.
+func LookupCode(code int32) *CodeInfo {
+	if codes := codeRegistry.Load(); codes != nil {
+		if info := (*codes)[code]; info != nil {
+			c := *info
+			return &c
+		}
+	}
+	return nil
+}
+
+// Codes returns the registered codes, ordered by code.
+func Codes() []CodeInfo {
+	var list []CodeInfo
+	if codes := codeRegistry.Load(); codes != nil {
+		for _, info := range *codes {
+			list = append(list, *info)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// ExportCodes writes the registered codes to w as a JSON array.
+func ExportCodes(w io.Writer) error {
+	list := Codes()
+	if list == nil {
+		list = []CodeInfo{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(list)
+}
+
+// LogCode logs a registered code at its level and for its module; the
+// message is formatted in the manner of fmt.Printf. An unregistered code
+// is logged as an ERROR of module "kslog".
+func LogCode(code int32, format string, args ...interface{}) {
+	level, module := ERROR, "kslog"
+	if codes := codeRegistry.Load(); codes != nil {
+		if info := (*codes)[code]; info != nil {
+			level, module = info.Level, info.Module
+		}
+	}
+	logging.printf(level, &module, code, format, args...)
+}
+
+// describeCode adds the name of r's code to it, or what is wrong with it.
+func describeCode(r *Record) {
+	codes := codeRegistry.Load()
+	if codes == nil || r.Code == 0 {
+		return
+	}
+	switch info := (*codes)[r.Code]; {
+	case info == nil:
+		r.Args["code_error"] = "unregistered code"
+	case info.Module != r.Module:
+		r.Args["code_name"] = info.Name
+		r.Args["code_error"] = "code of module " + info.Module
+	default:
+		r.Args["code_name"] = info.Name
+	}
+}
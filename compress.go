@@ -0,0 +1,63 @@
+package kslog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// Compressor compresses rotated log files, adding Ext to their name.
+// Formats other than gzip plug in their encoder, e.g. zstd with
+// github.com/klauspost/compress/zstd:
+//
+//	kslog.Compressor{Ext: ".zst", NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+//		return zstd.NewWriter(w)
+//	}}
+type Compressor struct {
+	Ext       string
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// GzipCompressor compresses rotated files with gzip.
+var GzipCompressor = &Compressor{
+	Ext: ".gz",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+}
+
+// compressFile replaces name with its compressed version, keeping its
+// modification time.
+func compressFile(name string, c *Compressor) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(name+c.Ext, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	zw, err := c.NewWriter(out)
+	if err == nil {
+		_, err = io.Copy(zw, in)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + c.Ext)
+		return err
+	}
+
+	os.Chtimes(name+c.Ext, info.ModTime(), info.ModTime())
+	return os.Remove(name)
+}
@@ -0,0 +1,454 @@
+package kslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Config describes the settings of a logger, as read from a file by
+// LoadConfig or built by the application for Build. Levels are level
+// names like "INFO", durations strings like "24h".
+type Config struct {
+	// Level is the most verbose level logged, DEBUG2 by default.
+	Level string `json:"level"`
+	// Queue is how many records are queued for the sinks, 1000 by
+	// default, on a lock-free ring with Ring set; they only apply to the
+	// logger Build returns. Sync hands records to the sinks in the logging
+	// call instead, see SetSync.
+	Queue int  `json:"queue"`
+	Ring  bool `json:"ring"`
+	Sync  bool `json:"sync"`
+	// NoCaller turns caller lookup off, see SetCaller.
+	NoCaller bool `json:"no_caller"`
+	// Console is where the console sink prints: "stdout", the default,
+	// "stderr" or "off", and ConsoleLevel the most verbose level it
+	// prints, DEBUG2 by default.
+	Console      string       `json:"console"`
+	ConsoleLevel string       `json:"console_level"`
+	Sinks        []SinkConfig `json:"sinks"`
+
+	// Include and Exclude filter records by module, see SetModuleFilter;
+	// Sampling, RateLimit and Dedup filter them further, see SetSampling,
+	// SetRateLimit and SetDedup.
+	Include   []string         `json:"include"`
+	Exclude   []string         `json:"exclude"`
+	Sampling  *SamplingConfig  `json:"sampling"`
+	RateLimit *RateLimitConfig `json:"rate_limit"`
+	Dedup     string           `json:"dedup"`
+}
+
+// SinkConfig describes a sink of a Config. Type is "file", "net" or
+// "http"; the other fields apply to the types their comments name.
+type SinkConfig struct {
+	Type string `json:"type"`
+	// Level is the most verbose level the sink gets, DEBUG2 by default.
+	Level string `json:"level"`
+	// Format is "text", the default, "json" or "console", for file and
+	// net sinks.
+	Format string `json:"format"`
+
+	// File sinks, see FileSinkConfig; Compress gzips rotated files.
+	Path             string `json:"path"`
+	Dir              string `json:"dir"`
+	Append           bool   `json:"append"`
+	Name             string `json:"name"`
+	MaxSize          int64  `json:"max_size"`
+	RotateEvery      string `json:"rotate_every"`
+	RotateOffset     string `json:"rotate_offset"`
+	RotateUTC        bool   `json:"rotate_utc"`
+	Compress         bool   `json:"compress"`
+	KeepUncompressed int    `json:"keep_uncompressed"`
+	MaxFiles         int    `json:"max_files"`
+	MaxAge           string `json:"max_age"`
+	MaxTotalSize     int64  `json:"max_total_size"`
+
+	// Net sinks send to Addr over Network, tcp by default, buffering up
+	// to Buffer records, 10000 by default.
+	Network string `json:"network"`
+	Addr    string `json:"addr"`
+	Buffer  int    `json:"buffer"`
+
+	// HTTP sinks POST batches to URL.
+	URL    string `json:"url"`
+	NDJSON bool   `json:"ndjson"`
+	Gzip   bool   `json:"gzip"`
+}
+
+// SamplingConfig is the Sampling of Level and less severe levels.
+type SamplingConfig struct {
+	Level      string `json:"level"`
+	First      int    `json:"first"`
+	Thereafter int    `json:"thereafter"`
+}
+
+// RateLimitConfig is the RateLimit of Level and less severe levels.
+type RateLimitConfig struct {
+	Level   string  `json:"level"`
+	Rate    float64 `json:"rate"`
+	Burst   int     `json:"burst"`
+	Summary string  `json:"summary"`
+}
+
+// LoadConfig reads a Config from the file at path and applies it to the
+// default logger, so that logging can be changed without recompiling. The
+// file is JSON or, by its extension, YAML (.yaml, .yml) or TOML (.toml),
+// of which the block style subset that maps onto Config is understood:
+//
+//	level: INFO
+//	sinks:
+//	  - type: file
+//	    dir: /var/log/app
+//	    max_size: 104857600
+//	    compress: true
+//	  - type: net
+//	    addr: collector:5140
+//	    level: ERROR
+//	    format: json
+func LoadConfig(path string) error {
+	config, err := ReadConfig(path)
+	if err != nil {
+		return err
+	}
+	return logging.ApplyConfig(config)
+}
+
+// ReadConfig reads the Config in the file at path, see LoadConfig.
+func ReadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yamlToJSON(data)
+	case ".toml":
+		data, err = tomlToJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	config := new(Config)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// parseLevel parses an optional level.
+func parseLevel(s string, def Level) (Level, error) {
+	if s == "" {
+		return def, nil
+	}
+	return ParseLevel(s)
+}
+
+// parseDuration parses an optional duration.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func parseFormat(s string) (Formatter, error) {
+	switch strings.ToLower(s) {
+	case "", "text":
+		return TextFormatter, nil
+	case "json":
+		return JSONFormatter, nil
+	case "console":
+		return ConsoleFormatter, nil
+	}
+	return nil, fmt.Errorf("Unknown log format %q", s)
+}
+
+// parse checks the sink described, returning its level and how to open
+// it.
+func (this *SinkConfig) parse() (func() (Sink, error), Level, error) {
+	level, err := parseLevel(this.Level, DEBUG2)
+	if err != nil {
+		return nil, 0, err
+	}
+	format, err := parseFormat(this.Format)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch this.Type {
+	case "file":
+		fc := FileSinkConfig{
+			Path:             this.Path,
+			Dir:              this.Dir,
+			Append:           this.Append,
+			Name:             this.Name,
+			Format:           format,
+			MaxSize:          this.MaxSize,
+			RotateUTC:        this.RotateUTC,
+			KeepUncompressed: this.KeepUncompressed,
+			MaxFiles:         this.MaxFiles,
+			MaxTotalSize:     this.MaxTotalSize,
+		}
+		if fc.RotateEvery, err = parseDuration(this.RotateEvery); err != nil {
+			return nil, 0, err
+		}
+		if fc.RotateOffset, err = parseDuration(this.RotateOffset); err != nil {
+			return nil, 0, err
+		}
+		if fc.MaxAge, err = parseDuration(this.MaxAge); err != nil {
+			return nil, 0, err
+		}
+		if this.Compress {
+			fc.Compress = GzipCompressor
+		}
+		if fc.Path == "" && fc.Dir == "" {
+			return nil, 0, errors.New("File sink needs a path or a dir")
+		}
+		return func() (Sink, error) { return OpenFileSink(fc) }, level, nil
+
+	case "net":
+		if this.Addr == "" {
+			return nil, 0, errors.New("Net sink needs an addr")
+		}
+		network, addr, buffer := this.Network, this.Addr, this.Buffer
+		if network == "" {
+			network = "tcp"
+		}
+		if buffer <= 0 {
+			buffer = 10000
+		}
+		return func() (Sink, error) {
+			s := NewNetSink(network, addr, buffer)
+			s.format = format
+			return s, nil
+		}, level, nil
+
+	case "http":
+		if this.URL == "" {
+			return nil, 0, errors.New("HTTP sink needs a url")
+		}
+		hc := HTTPSinkConfig{URL: this.URL, NDJSON: this.NDJSON, Gzip: this.Gzip}
+		return func() (Sink, error) { return NewHTTPSink(hc), nil }, level, nil
+	}
+	return nil, 0, fmt.Errorf("Unknown sink type %q", this.Type)
+}
+
+// parsedConfig is a Config checked and with its values parsed.
+type parsedConfig struct {
+	level, consoleLevel Level
+	// console is nil when the console is off.
+	console       io.Writer
+	dedup         time.Duration
+	sampling      *Sampling
+	samplingLevel Level
+	limit         *RateLimit
+	limitLevel    Level
+	sinks         []func() (Sink, error)
+	sinkLevels    []Level
+}
+
+// parse checks config and parses its values.
+func (this *Config) parse() (*parsedConfig, error) {
+	p := new(parsedConfig)
+	var err error
+	if p.level, err = parseLevel(this.Level, DEBUG2); err != nil {
+		return nil, err
+	}
+	if p.consoleLevel, err = parseLevel(this.ConsoleLevel, DEBUG2); err != nil {
+		return nil, err
+	}
+	switch this.Console {
+	case "", "stdout":
+		p.console = os.Stdout
+	case "stderr":
+		p.console = os.Stderr
+	case "off":
+	default:
+		return nil, fmt.Errorf("Unknown console %q", this.Console)
+	}
+	if this.Queue < 0 {
+		return nil, fmt.Errorf("Bad queue size %d", this.Queue)
+	}
+	if p.dedup, err = parseDuration(this.Dedup); err != nil {
+		return nil, err
+	}
+	for _, patterns := range [][]string{this.Include, this.Exclude} {
+		if _, err := modulePatterns(patterns); err != nil {
+			return nil, err
+		}
+	}
+
+	if c := this.Sampling; c != nil {
+		if p.samplingLevel, err = parseLevel(c.Level, DEBUG2); err != nil {
+			return nil, err
+		}
+		p.sampling = &Sampling{First: c.First, Thereafter: c.Thereafter}
+	}
+	if c := this.RateLimit; c != nil {
+		if p.limitLevel, err = parseLevel(c.Level, DEBUG2); err != nil {
+			return nil, err
+		}
+		if c.Rate < 0 {
+			return nil, fmt.Errorf("Bad rate limit %v", c.Rate)
+		}
+		p.limit = &RateLimit{Rate: c.Rate, Burst: c.Burst}
+		if p.limit.Summary, err = parseDuration(c.Summary); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range this.Sinks {
+		open, level, err := this.Sinks[i].parse()
+		if err != nil {
+			return nil, fmt.Errorf("Sink %d: %v", i+1, err)
+		}
+		p.sinks = append(p.sinks, open)
+		p.sinkLevels = append(p.sinkLevels, level)
+	}
+	return p, nil
+}
+
+// Validate checks config without opening any sink, so that a
+// misconfiguration is reported when the application starts.
+func (this *Config) Validate() error {
+	_, err := this.parse()
+	return err
+}
+
+// Build returns a new logger with the settings of config, or the first
+// problem with them. The logger gets no sinks other than those config
+// describes, the console and the system sinks.
+func (this *Config) Build() (*logger, error) {
+	if _, err := this.parse(); err != nil {
+		return nil, err
+	}
+	size := this.Queue
+	if size == 0 {
+		size = defaultQueueSize
+	}
+	var l *logger
+	if this.Ring {
+		l = newLogger(newRingQueue(size))
+	} else {
+		l = newLogger(newChanQueue(size))
+	}
+	if err := l.ApplyConfig(this); err != nil {
+		l.Shutdown(context.Background())
+		return nil, err
+	}
+	return l, nil
+}
+
+// ApplyConfig replaces the sinks the logger opened itself, the default
+// file sink and those of an earlier config, with those config describes,
+// sets up the console as config says and applies its other settings but
+// Queue and Ring. Sinks attached with AddSink or AddSecuritySink are kept. When config is invalid or a sink can't be
+// opened, the logger is left as it was.
+func (this *logger) ApplyConfig(config *Config) error {
+	return this.applyConfig(config, nil)
+}
+
+// applyConfig applies what config changes from old, or all of it when old
+// is nil, so that a reload leaves the sinks alone unless they changed.
+func (this *logger) applyConfig(config, old *Config) error {
+	p, err := config.parse()
+	if err != nil {
+		return err
+	}
+
+	sinksChanged := old == nil || !reflect.DeepEqual(old.Sinks, config.Sinks)
+	var entries []*sinkEntry
+	var file *sinkEntry
+	for i := 0; sinksChanged && i < len(p.sinks); i++ {
+		s, err := p.sinks[i]()
+		if err != nil {
+			for _, e := range entries {
+				e.sink.Close()
+			}
+			return fmt.Errorf("Sink %d: %v", i+1, err)
+		}
+		this.setFallbackOf(s)
+		e := &sinkEntry{sink: s, level: p.sinkLevels[i], owned: true}
+		if file == nil && config.Sinks[i].Type == "file" {
+			file = e
+		}
+		entries = append(entries, e)
+	}
+
+	this.mu.Lock()
+	if sinksChanged {
+		kept := this.sinks[:0:0]
+		for _, e := range this.sinks {
+			if e.owned {
+				e.sink.Close()
+			} else {
+				kept = append(kept, e)
+			}
+		}
+		this.file = file
+		this.sinks = append(kept, entries...)
+		for _, s := range systemSinks() {
+			this.sinks = append(this.sinks, &sinkEntry{sink: s, level: systemSinkLevel, owned: true})
+		}
+	}
+	if old == nil || old.Console != config.Console {
+		for i, e := range this.sinks {
+			if e == this.console {
+				this.sinks = append(this.sinks[:i:i], this.sinks[i+1:]...)
+				break
+			}
+		}
+		if p.console != nil {
+			if this.console == nil {
+				this.console = &sinkEntry{sink: &consoleSink{format: ConsoleFormatter}, level: DEBUG2}
+			}
+			this.console.sink.(*consoleSink).w = p.console
+			this.sinks = append([]*sinkEntry{this.console}, this.sinks...)
+		}
+	}
+	if this.console != nil && (old == nil || old.ConsoleLevel != config.ConsoleLevel) {
+		this.console.level = p.consoleLevel
+	}
+	this.updateVerbosest()
+	this.mu.Unlock()
+
+	if old == nil || old.Level != config.Level {
+		this.SetLevel(p.level)
+	}
+	if old == nil || !reflect.DeepEqual(old.Include, config.Include) || !reflect.DeepEqual(old.Exclude, config.Exclude) {
+		this.SetModuleFilter(config.Include, config.Exclude)
+	}
+	if old == nil || !reflect.DeepEqual(old.Sampling, config.Sampling) {
+		this.SetSampling(p.samplingLevel, p.sampling)
+	}
+	if old == nil || !reflect.DeepEqual(old.RateLimit, config.RateLimit) {
+		this.SetRateLimit(p.limitLevel, p.limit)
+	}
+	if old == nil || old.Dedup != config.Dedup {
+		this.SetDedup(p.dedup)
+	}
+	if old == nil || old.NoCaller != config.NoCaller {
+		this.SetCaller(!config.NoCaller)
+	}
+	if old == nil || old.Sync != config.Sync {
+		this.SetSync(config.Sync)
+	}
+	return nil
+}
+
+// ApplyConfig applies config to the default logger.
+func ApplyConfig(config *Config) error {
+	return logging.ApplyConfig(config)
+}
@@ -0,0 +1,359 @@
+package kslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Config files in YAML or TOML are turned into JSON. Only what a Config
+// needs is understood: YAML in block style with mappings, sequences and
+// scalars; TOML with key/value pairs, tables, arrays of tables and single
+// line arrays.
+
+// configLine is a line of a config file without its comment.
+type configLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// stripComment cuts a # comment off line, minding quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func configLines(data []byte) []configLine {
+	var lines []configLine
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(stripComment(strings.TrimRight(line, "\r")), " \t")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text == "---" {
+			continue
+		}
+		lines = append(lines, configLine{num: i + 1, indent: len(line) - len(text), text: text})
+	}
+	return lines
+}
+
+// configScalar parses a scalar value: a quoted string, a number, a bool,
+// null, or else a plain string.
+func configScalar(s string) (interface{}, error) {
+	switch {
+	case s == "":
+		return nil, nil
+	case s[0] == '"':
+		return strconv.Unquote(s)
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	switch s {
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	case "null", "Null", "NULL", "~":
+		return nil, nil
+	}
+	if n, err := strconv.ParseInt(strings.ReplaceAll(s, "_", ""), 0, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil
+}
+
+// yamlParser parses the lines of a YAML file.
+type yamlParser struct {
+	lines []configLine
+	i     int
+}
+
+func yamlToJSON(data []byte) ([]byte, error) {
+	p := &yamlParser{lines: configLines(data)}
+	if len(p.lines) == 0 {
+		return []byte("{}"), nil
+	}
+	v, err := p.value(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.lines) {
+		return nil, fmt.Errorf("line %d: bad indentation", p.lines[p.i].num)
+	}
+	return json.Marshal(v)
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// value parses the mapping or sequence at indent.
+func (this *yamlParser) value(indent int) (interface{}, error) {
+	if isSeqItem(this.lines[this.i].text) {
+		return this.sequence(indent)
+	}
+	return this.mapping(indent)
+}
+
+// splitKey splits "key: value" at its colon.
+func splitKey(text string) (string, string, bool) {
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			key := strings.TrimSpace(text[:i])
+			if unquoted, err := strconv.Unquote(key); err == nil {
+				key = unquoted
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// nested parses the value of a key or item with nothing after it: a
+// deeper block, a sequence at the same indent for a key, or else null.
+func (this *yamlParser) nested(indent int, key bool) (interface{}, error) {
+	if this.i < len(this.lines) {
+		next := this.lines[this.i]
+		if next.indent > indent || key && next.indent == indent && isSeqItem(next.text) {
+			return this.value(next.indent)
+		}
+	}
+	return nil, nil
+}
+
+func (this *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for this.i < len(this.lines) {
+		line := this.lines[this.i]
+		if line.indent < indent || line.indent == indent && isSeqItem(line.text) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: bad indentation", line.num)
+		}
+		key, rest, ok := splitKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", line.num)
+		}
+		if strings.HasPrefix(rest, "[") || strings.HasPrefix(rest, "{") {
+			return nil, fmt.Errorf("line %d: flow style is not supported", line.num)
+		}
+		this.i++
+
+		var v interface{}
+		var err error
+		if rest == "" {
+			v, err = this.nested(indent, true)
+		} else {
+			v, err = configScalar(rest)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line.num, err)
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func (this *yamlParser) sequence(indent int) ([]interface{}, error) {
+	var seq []interface{}
+	for this.i < len(this.lines) {
+		line := this.lines[this.i]
+		if line.indent != indent || !isSeqItem(line.text) {
+			if line.indent > indent {
+				return nil, fmt.Errorf("line %d: bad indentation", line.num)
+			}
+			break
+		}
+		rest := strings.TrimLeft(line.text[1:], " ")
+
+		var v interface{}
+		var err error
+		switch _, _, isKey := splitKey(rest); {
+		case rest == "":
+			this.i++
+			v, err = this.nested(indent, false)
+		case isKey || isSeqItem(rest):
+			// The item's block starts on the dash's line; parse it
+			// from where its text starts.
+			this.lines[this.i] = configLine{num: line.num, indent: indent + len(line.text) - len(rest), text: rest}
+			v, err = this.value(this.lines[this.i].indent)
+		default:
+			this.i++
+			v, err = configScalar(rest)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line.num, err)
+		}
+		seq = append(seq, v)
+	}
+	return seq, nil
+}
+
+func tomlToJSON(data []byte) ([]byte, error) {
+	root := make(map[string]interface{})
+	table := root
+	for _, line := range configLines(data) {
+		text := strings.TrimSpace(line.text)
+		switch {
+		case strings.HasPrefix(text, "[["):
+			if !strings.HasSuffix(text, "]]") {
+				return nil, fmt.Errorf("line %d: bad table header", line.num)
+			}
+			parent, name, err := tomlTable(root, strings.TrimSpace(text[2:len(text)-2]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line.num, err)
+			}
+			list, _ := parent[name].([]interface{})
+			if parent[name] != nil && list == nil {
+				return nil, fmt.Errorf("line %d: %s is not an array of tables", line.num, name)
+			}
+			table = make(map[string]interface{})
+			parent[name] = append(list, table)
+
+		case strings.HasPrefix(text, "["):
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: bad table header", line.num)
+			}
+			parent, name, err := tomlTable(root, strings.TrimSpace(text[1:len(text)-1]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line.num, err)
+			}
+			if parent[name] != nil {
+				return nil, fmt.Errorf("line %d: table %s defined twice", line.num, name)
+			}
+			table = make(map[string]interface{})
+			parent[name] = table
+
+		default:
+			eq := strings.Index(text, "=")
+			if eq < 0 {
+				return nil, fmt.Errorf("line %d: expected key = value", line.num)
+			}
+			key := strings.TrimSpace(text[:eq])
+			if unquoted, err := strconv.Unquote(key); err == nil {
+				key = unquoted
+			}
+			v, err := tomlValue(strings.TrimSpace(text[eq+1:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line.num, err)
+			}
+			table[key] = v
+		}
+	}
+	return json.Marshal(root)
+}
+
+// tomlTable returns the table a dotted header name is defined in, and its
+// last part.
+func tomlTable(root map[string]interface{}, dotted string) (map[string]interface{}, string, error) {
+	parts := strings.Split(dotted, ".")
+	table := root
+	for _, part := range parts[:len(parts)-1] {
+		switch v := table[part].(type) {
+		case nil:
+			next := make(map[string]interface{})
+			table[part] = next
+			table = next
+		case map[string]interface{}:
+			table = v
+		case []interface{}:
+			// A sub-table of the last table in an array.
+			var ok bool
+			if len(v) > 0 {
+				table, ok = v[len(v)-1].(map[string]interface{})
+			}
+			if !ok {
+				return nil, "", fmt.Errorf("key %s is not a table", part)
+			}
+		default:
+			return nil, "", fmt.Errorf("key %s is not a table", part)
+		}
+	}
+	return table, parts[len(parts)-1], nil
+}
+
+func tomlValue(s string) (interface{}, error) {
+	if !strings.HasPrefix(s, "[") {
+		if s == "" || s[0] != '"' && s[0] != '\'' && s != "true" && s != "false" && !strings.ContainsAny(s[:1], "+-0123456789") {
+			return nil, fmt.Errorf("bad value %s", s)
+		}
+		return configScalar(s)
+	}
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("arrays must be on one line")
+	}
+	items, err := splitArray(s[1 : len(s)-1])
+	if err != nil {
+		return nil, err
+	}
+	list := []interface{}{}
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		v, err := tomlValue(item)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// splitArray splits the items of a single line array at its commas,
+// minding quoted strings and nested arrays.
+func splitArray(s string) ([]string, error) {
+	var items []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			if depth--; depth < 0 {
+				return nil, fmt.Errorf("unbalanced ] in array")
+			}
+		case c == ',' && depth == 0:
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string in array")
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced [ in array")
+	}
+	return append(items, s[start:]), nil
+}
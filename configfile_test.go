@@ -0,0 +1,83 @@
+package kslog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTOMLToJSON(t *testing.T) {
+	tests := []struct {
+		toml string
+		json string
+		err  string
+	}{
+		{toml: "level = \"INFO\"\nqueue = 1_000", json: `{"level":"INFO","queue":1000}`},
+		{toml: "[file]\ndir = '/var/log' # the directory\n", json: `{"file":{"dir":"/var/log"}}`},
+		{toml: "[[sinks]]\ntype = \"net\"\n[sinks.tls]\nca = \"x\"\n[[sinks]]\ntype = \"file\"", json: `{"sinks":[{"tls":{"ca":"x"},"type":"net"},{"type":"file"}]}`},
+		{toml: `include = ["/^x{1,3}$/", 'a,b', "c\",d"]`, json: `{"include":["/^x{1,3}$/","a,b","c\",d"]}`},
+		{toml: `nested = [[1, 2], [], ["]"]]`, json: `{"nested":[[1,2],[],["]"]]}`},
+		{toml: "list = []", json: `{"list":[]}`},
+		{toml: "a = []\n[a.b]", err: "line 2: key a is not a table"},
+		{toml: "a = [1]\n[a.b]", err: "line 2: key a is not a table"},
+		{toml: "a = 1\n[a.b]", err: "line 2: key a is not a table"},
+		{toml: "a = [1]\n[[a.b]]", err: "line 2: key a is not a table"},
+		{toml: "[a]\n[a]", err: "line 2: table a defined twice"},
+		{toml: `a = ["x]`, err: "line 1: unterminated string in array"},
+		{toml: `a = [[1]`, err: "line 1: unbalanced [ in array"},
+		{toml: "a = [1,\n2]", err: "line 1: arrays must be on one line"},
+		{toml: "a", err: "line 1: expected key = value"},
+		{toml: "a = b", err: "line 1: bad value b"},
+	}
+	for _, test := range tests {
+		out, err := tomlToJSON([]byte(test.toml))
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: got error %v, want %q", test.toml, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.toml, err)
+		} else if string(out) != test.json {
+			t.Errorf("%q: got %s, want %s", test.toml, out, test.json)
+		}
+	}
+}
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		yaml string
+		json string
+		err  string
+	}{
+		{yaml: "level: INFO\nqueue: 1000", json: `{"level":"INFO","queue":1000}`},
+		{yaml: "sinks:\n- type: net\n  addr: 'x:1' # comment\n- type: file", json: `{"sinks":[{"addr":"x:1","type":"net"},{"type":"file"}]}`},
+		{yaml: "a:\n  - 1\n  - \"#2\"", json: `{"a":[1,"#2"]}`},
+		{yaml: "a:\n    b: 1\n  c: 2", err: "bad indentation"},
+	}
+	for _, test := range tests {
+		out, err := yamlToJSON([]byte(test.yaml))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: got error %v, want %q", test.yaml, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.yaml, err)
+		} else if string(out) != test.json {
+			t.Errorf("%q: got %s, want %s", test.yaml, out, test.json)
+		}
+	}
+}
+
+func FuzzConfigFile(f *testing.F) {
+	f.Add("level = \"INFO\"\n[[sinks]]\ntype = \"net\"\n[sinks.tls]\nca = \"x\"")
+	f.Add("a = [[1], \"x,y\"]\n[a.b]")
+	f.Add("level: INFO\nsinks:\n- type: net\n  tls:\n    ca: x\n-\n  - 1")
+	f.Fuzz(func(t *testing.T, data string) {
+		// Either parser may reject the input, neither may panic.
+		tomlToJSON([]byte(data))
+		yamlToJSON([]byte(data))
+	})
+}
@@ -0,0 +1,65 @@
+package kslog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header CorrelationMiddleware takes the
+// correlation ID of a request from, and returns it in.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestID bounds the length of a correlation ID taken from a header.
+const maxRequestID = 128
+
+type correlationKey struct{}
+
+// NewCorrelationID returns a new random correlation ID.
+func NewCorrelationID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// WithCorrelationID returns a copy of ctx carrying id, which the Ctx
+// functions add to records made with it under the "correlation_id" key.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID ctx carries, or "".
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// CorrelationMiddleware gives every request a correlation ID: the one in
+// its X-Request-ID header or else a new one. The ID is stashed in the
+// request's context, for the Ctx functions, and set in the X-Request-ID
+// header of the response.
+func CorrelationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewCorrelationID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithCorrelationID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether id is fit to be logged: not empty, not
+// too long and printable ASCII.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
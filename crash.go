@@ -0,0 +1,70 @@
+package kslog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
+	"time"
+)
+
+// crashTimeout bounds how long a dying process waits for its records to be
+// written.
+const crashTimeout = 5 * time.Second
+
+// HandleCrash, deferred at the top of main and of goroutines, logs a panic
+// with its stack as a CRIT record of module "kslog", writes out everything
+// still queued, closes the sinks and panics again:
+//
+//	func main() {
+//		defer kslog.HandleCrash()
+//		...
+//	}
+func HandleCrash() {
+	if p := recover(); p != nil {
+		logging.crashed(p)
+		panic(p)
+	}
+}
+
+// HandleCrash is HandleCrash for this logger.
+func (this *logger) HandleCrash() {
+	if p := recover(); p != nil {
+		this.crashed(p)
+		panic(p)
+	}
+}
+
+func (this *logger) crashed(p interface{}) {
+	module, message := "kslog", fmt.Sprintf("Panic: %v", p)
+	this.printex(CRIT, &module, 0, &message, "stack", string(debug.Stack()))
+	this.shutdownNow()
+}
+
+// shutdownNow shuts the logger down with crashTimeout.
+func (this *logger) shutdownNow() {
+	ctx, cancel := context.WithTimeout(context.Background(), crashTimeout)
+	defer cancel()
+	this.Shutdown(ctx)
+}
+
+// FlushOnSignal makes the default logger write out everything still queued
+// and close its sinks when the process gets one of sigs, SIGINT and
+// SIGTERM by default, before the signal takes its usual effect. It is for
+// programs that don't handle these signals themselves; those call
+// Shutdown when they stop.
+func FlushOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	go func() {
+		sig := <-c
+		logging.shutdownNow()
+		signal.Reset(sigs...)
+		raise(sig)
+	}()
+}
@@ -0,0 +1,114 @@
+package kslog
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync/atomic"
+)
+
+// SpanFunc returns the IDs of the trace and the span active in ctx, or
+// empty strings without one.
+type SpanFunc func(ctx context.Context) (traceID, spanID string)
+
+// spanFunc is the SpanFunc set by SetSpanFunc.
+var spanFunc atomic.Pointer[SpanFunc]
+
+// SetSpanFunc sets how the Ctx functions find the span active in their
+// context, whose IDs they add to the record under the "trace_id" and
+// "span_id" keys, so that logs and traces can be correlated. For
+// OpenTelemetry:
+//
+//	kslog.SetSpanFunc(func(ctx context.Context) (string, string) {
+//		sc := trace.SpanContextFromContext(ctx)
+//		if !sc.IsValid() {
+//			return "", ""
+//		}
+//		return sc.TraceID().String(), sc.SpanID().String()
+//	})
+//
+// nil removes it.
+func SetSpanFunc(f SpanFunc) {
+	if f == nil {
+		spanFunc.Store(nil)
+		return
+	}
+	spanFunc.Store(&f)
+}
+
+// pprofLabels is set by SetPprofLabels.
+var pprofLabels atomic.Bool
+
+// SetPprofLabels switches adding the runtime/pprof labels of the context
+// of the Ctx functions to their records, so that records and CPU profiles
+// share dimensions such as the handler or the tenant:
+//
+//	pprof.Do(ctx, pprof.Labels("handler", "checkout"), func(ctx context.Context) {
+//		kslog.InfoCtx(ctx, "shop", 0, "Cart checked out")
+//	})
+//
+// The labels are read from the context: those a goroutine was given with
+// pprof.SetGoroutineLabels can't be read back from the goroutine.
+func SetPprofLabels(on bool) {
+	pprofLabels.Store(on)
+}
+
+// ContextFields returns what ctx carries for records as fields: its
+// correlation ID, the IDs of its span, see SetSpanFunc, and its pprof
+// labels, see SetPprofLabels.
+func ContextFields(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	var fields []Field
+	if id := CorrelationID(ctx); id != "" {
+		fields = append(fields, String("correlation_id", id))
+	}
+	if f := spanFunc.Load(); f != nil {
+		if traceID, spanID := (*f)(ctx); traceID != "" {
+			fields = append(fields, String("trace_id", traceID), String("span_id", spanID))
+		}
+	}
+	if pprofLabels.Load() {
+		pprof.ForLabels(ctx, func(key, value string) bool {
+			fields = append(fields, String(key, value))
+			return true
+		})
+	}
+	return fields
+}
+
+// contextArgs returns args with what ctx carries added.
+func contextArgs(ctx context.Context, args []interface{}) []interface{} {
+	for _, f := range ContextFields(ctx) {
+		args = append(args[:len(args):len(args)], f.Key, f.str)
+	}
+	return args
+}
+
+func (this *logger) printctx(ctx context.Context, level Level, module *string, code int32, message *string, args ...interface{}) {
+	if this.admit(level, *module, code) {
+		this.output(level, code, module, message, 0, contextArgs(ctx, args)...)
+	} else if t := this.traces.Load(); t != nil && level <= t.level && ctx != nil && CorrelationID(ctx) != "" && atomic.LoadInt32(&this.verbosest) >= 0 {
+		this.outputTraced(level, code, module, message, contextArgs(ctx, args)...)
+	}
+}
+
+// EmergeCtx logs to the EMERGE log like EmergeEx, with what ctx carries.
+func EmergeCtx(ctx context.Context, module string, code int32, message string, args ...interface{}) {
+	logging.printctx(ctx, EMERGE, &module, code, &message, args...)
+}
+
+// ErrorCtx logs to the ERROR log like ErrorEx, with what ctx carries.
+func ErrorCtx(ctx context.Context, module string, code int32, message string, args ...interface{}) {
+	logging.printctx(ctx, ERROR, &module, code, &message, args...)
+}
+
+// NoticeCtx logs to the NOTICE log like NoticeEx, with what ctx carries.
+func NoticeCtx(ctx context.Context, module string, code int32, message string, args ...interface{}) {
+	logging.printctx(ctx, NOTICE, &module, code, &message, args...)
+}
+
+// InfoCtx logs to the INFO log like InfoEx, with what ctx carries.
+func InfoCtx(ctx context.Context, module string, code int32, message string, args ...interface{}) {
+	logging.printctx(ctx, INFO, &module, code, &message, args...)
+}
@@ -0,0 +1,45 @@
+//go:build !kslog_nodebug
+// +build !kslog_nodebug
+
+package kslog
+
+import "context"
+
+// CompiledLevel is the most verbose level compiled in: DEBUG2, DEBUG
+// with the kslog_notrace build tag, which turns the Debug2 functions into
+// no-ops, or INFO with the kslog_nodebug tag, which also turns the Debug
+// functions into no-ops. Arguments of no-ops are still evaluated; guard
+// costly ones so that the compiler drops them as well:
+//
+//	if kslog.CompiledLevel >= kslog.DEBUG2 {
+//		kslog.Debug2Ex("storage", 0, "Page read", "page", page.Dump())
+//	}
+const CompiledLevel = traceLevel
+
+// Debugf logs to the DEBUG log.
+// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
+func Debugf(module string, code int32, format string, args ...interface{}) {
+	logging.printf(DEBUG, &module, code, format, args...)
+}
+
+// Debug logs to the DEBUG log.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func Debug(module string, code int32, args ...interface{}) {
+	logging.print(DEBUG, &module, code, args...)
+}
+
+// Debug logs to the DEBUG log.
+// Argument are string and anonymous struct
+func DebugEx(module string, code int32, message string, args ...interface{}) {
+	logging.printex(DEBUG, &module, code, &message, args...)
+}
+
+// DebugFields logs to the DEBUG log with typed fields; it doesn't allocate.
+func DebugFields(module string, code int32, message string, fields ...Field) {
+	logging.printFields(DEBUG, module, code, message, fields...)
+}
+
+// DebugCtx logs to the DEBUG log like DebugEx, with what ctx carries.
+func DebugCtx(ctx context.Context, module string, code int32, message string, args ...interface{}) {
+	logging.printctx(ctx, DEBUG, &module, code, &message, args...)
+}
@@ -0,0 +1,24 @@
+//go:build kslog_nodebug
+// +build kslog_nodebug
+
+package kslog
+
+import "context"
+
+// CompiledLevel is INFO with the kslog_nodebug build tag; see debug.go.
+const CompiledLevel = INFO
+
+// Debugf is a no-op with the kslog_nodebug build tag.
+func Debugf(module string, code int32, format string, args ...interface{}) {}
+
+// Debug is a no-op with the kslog_nodebug build tag.
+func Debug(module string, code int32, args ...interface{}) {}
+
+// DebugEx is a no-op with the kslog_nodebug build tag.
+func DebugEx(module string, code int32, message string, args ...interface{}) {}
+
+// DebugFields is a no-op with the kslog_nodebug build tag.
+func DebugFields(module string, code int32, message string, fields ...Field) {}
+
+// DebugCtx is a no-op with the kslog_nodebug build tag.
+func DebugCtx(ctx context.Context, module string, code int32, message string, args ...interface{}) {}
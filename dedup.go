@@ -0,0 +1,86 @@
+package kslog
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// dedup tracks runs of repeated records. It is only used on the sink
+// goroutine.
+type dedup struct {
+	timeout atomic.Int64
+	// level to line describe the record written last, repeats counts the
+	// identical ones since, the first of them at since.
+	level   Level
+	module  string
+	code    int32
+	message string
+	file    string
+	line    int
+	repeats uint64
+	since   time.Time
+}
+
+// SetDedup collapses runs of records with the same level, module, code
+// and message, like syslog: only the first is written, followed by a
+// "Last message repeated N times" record once a different record comes
+// along, on Flush, or timeout after the first repeat. Zero, the default,
+// writes every record.
+func (this *logger) SetDedup(timeout time.Duration) {
+	this.dedup.timeout.Store(int64(timeout))
+}
+
+// SetDedup sets the duplicate suppression of the default logger.
+func SetDedup(timeout time.Duration) {
+	logging.SetDedup(timeout)
+}
+
+// repeated reports whether r repeats the record written last and was
+// counted rather than written. It must be called with mu held.
+func (this *logger) repeated(r *Record) bool {
+	d := &this.dedup
+	timeout := time.Duration(d.timeout.Load())
+	if timeout <= 0 && d.repeats == 0 {
+		return false
+	}
+
+	if timeout > 0 && r.Level == d.level && r.Module == d.module && r.Code == d.code && r.Message == d.message {
+		if d.repeats++; d.repeats == 1 {
+			d.since = r.Time
+			time.AfterFunc(timeout, func() {
+				this.pushKept(&Record{repeatsDue: true}, false)
+			})
+		} else if r.Time.Sub(d.since) >= timeout {
+			this.endRun()
+		}
+		return true
+	}
+
+	this.endRun()
+	d.level, d.module, d.code, d.message = r.Level, r.Module, r.Code, r.Message
+	d.file, d.line = r.File, r.Line
+	return false
+}
+
+// repeatsDue ends a run that has been going on for the timeout.
+func (this *logger) repeatsDue() {
+	d := &this.dedup
+	if d.repeats > 0 && this.now().Sub(d.since) >= time.Duration(d.timeout.Load()) {
+		this.endRun()
+	}
+}
+
+// endRun writes how often the last record was repeated, if it was. It
+// must be called with mu held.
+func (this *logger) endRun() {
+	d := &this.dedup
+	if d.repeats == 0 {
+		return
+	}
+	item := this.newItem(d.level, d.code, d.module, "Last message repeated "+strconv.FormatUint(d.repeats, 10)+" times", d.file, d.line)
+	item.Args["repeated"] = d.repeats
+	item.Seq = this.seq.Add(1)
+	d.repeats = 0
+	this.write(item)
+}
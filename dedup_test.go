@@ -0,0 +1,111 @@
+package kslog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDedupClock(t *testing.T) {
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	sink := new(recordSink)
+	l.AddSink(sink)
+	clock := &testClock{t: time.Now()}
+	l.SetClock(clock)
+	l.SetDedup(time.Hour)
+
+	module := "test"
+	l.printf(INFO, &module, 0, "x")
+	l.printf(INFO, &module, 0, "x")
+	// Only the clock says the run timed out, the timer is an hour off.
+	clock.add(2 * time.Hour)
+	l.printf(INFO, &module, 0, "x")
+	l.printf(INFO, &module, 0, "x")
+	l.Flush()
+
+	var got []string
+	for _, r := range sink.records {
+		got = append(got, r.Message)
+	}
+	want := []string{"x", "Last message repeated 2 times", "Last message repeated 1 times"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		timeout time.Duration
+		logged  []string
+		want    []string
+	}{
+		{"off", 0, []string{"a", "a", "a"}, []string{"a", "a", "a"}},
+		{"run", time.Hour, []string{"a", "a", "a", "b"}, []string{"a", "Last message repeated 2 times", "b"}},
+		{"runs", time.Hour, []string{"a", "a", "b", "b", "a"}, []string{"a", "Last message repeated 1 times", "b", "Last message repeated 1 times", "a"}},
+		{"flushed", time.Hour, []string{"a", "a"}, []string{"a", "Last message repeated 1 times"}},
+		// Records differing in level or code only aren't repeats.
+		{"level", time.Hour, []string{"a", "A", "a:1"}, []string{"a", "a", "a"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			l := NewLoggerQueue(16)
+			l.ResetSinks()
+			sink := new(recordSink)
+			l.AddSink(sink)
+			l.SetDedup(test.timeout)
+
+			module := "test"
+			for _, m := range test.logged {
+				switch m {
+				case "A":
+					l.printf(WARNING, &module, 0, "a")
+				case "a:1":
+					l.printf(INFO, &module, 1, "a")
+				default:
+					l.printf(INFO, &module, 0, "%s", m)
+				}
+			}
+			l.Flush()
+
+			var got []string
+			for _, r := range sink.records {
+				got = append(got, r.Message)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDedupTimeout(t *testing.T) {
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	sink := new(recordSink)
+	l.AddSink(sink)
+	l.SetDedup(20 * time.Millisecond)
+
+	module := "test"
+	for i := 0; i < 3; i++ {
+		l.printf(INFO, &module, 0, "a")
+	}
+
+	// The run ends on its own, without Flush or another record.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sink.mu.Lock()
+		records := sink.records
+		sink.mu.Unlock()
+		if len(records) == 2 {
+			if r := records[1]; r.Message != "Last message repeated 2 times" || r.Args["repeated"] != uint64(2) {
+				t.Errorf("got %q %v", r.Message, r.Args)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d records, want the repeat count", len(records))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
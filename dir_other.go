@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package kslog
+
+// defaultLogDir is where the default file sink logs unless KSLOG_DIR is
+// set.
+func defaultLogDir() string {
+	return "/var/log/kslog/" + getProgram()
+}
@@ -0,0 +1,21 @@
+package kslog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultLogDir is where the default file sink logs unless KSLOG_DIR is
+// set: %ProgramData%\<program>\logs, or %LOCALAPPDATA%\<program>\logs.
+func defaultLogDir() string {
+	program := strings.TrimSuffix(strings.TrimSuffix(getProgram(), ".exe"), ".EXE")
+	base := os.Getenv("ProgramData")
+	if base == "" {
+		base = os.Getenv("LOCALAPPDATA")
+	}
+	if base == "" {
+		base = os.TempDir()
+	}
+	return filepath.Join(base, program, "logs")
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !windows
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly,!windows
+
+package kslog
+
+import "errors"
+
+// diskFree is not supported on this platform.
+func diskFree(dir string) (uint64, error) {
+	return 0, errors.New("Free disk space unknown on this platform")
+}
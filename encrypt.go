@@ -0,0 +1,222 @@
+package kslog
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Encrypted log files are a sequence of segments, one per time the file
+// was opened. A segment starts with a header frame
+//
+//	'H' mode uint16(len) key
+//
+// where mode 'X' has the ephemeral X25519 public key the data key was
+// agreed with and mode 'K' the data key as wrapped by WrapKey. Records
+// follow as frames
+//
+//	'R' uint32(len) AES-256-GCM ciphertext
+//
+// sealed with the segment's record count as nonce.
+const (
+	encHeader   = 'H'
+	encRecord   = 'R'
+	encX25519   = 'X'
+	encWrapped  = 'K'
+	encKDFLabel = "kslog file encryption"
+)
+
+// FileEncryption encrypts a log file for a recipient, either to an X25519
+// PublicKey or with a data key wrapped by WrapKey, e.g. with a KMS.
+type FileEncryption struct {
+	PublicKey *ecdh.PublicKey
+	WrapKey   func(key []byte) ([]byte, error)
+}
+
+// FileDecryption holds what is needed to read files encrypted with
+// FileEncryption: the PrivateKey matching its PublicKey, or UnwrapKey
+// undoing its WrapKey.
+type FileDecryption struct {
+	PrivateKey *ecdh.PrivateKey
+	UnwrapKey  func(wrapped []byte) ([]byte, error)
+}
+
+// fileCipher seals the records of one segment.
+type fileCipher struct {
+	aead  cipher.AEAD
+	count uint64
+}
+
+func newFileCipher(key []byte) (*fileCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &fileCipher{aead: aead}, nil
+}
+
+func (this *fileCipher) nonce() []byte {
+	nonce := make([]byte, this.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], this.count)
+	this.count++
+	return nonce
+}
+
+// seal returns p as a record frame.
+func (this *fileCipher) seal(p []byte) []byte {
+	frame := make([]byte, 5, 5+len(p)+this.aead.Overhead())
+	frame[0] = encRecord
+	frame = this.aead.Seal(frame, this.nonce(), p, nil)
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(frame)-5))
+	return frame
+}
+
+func x25519Key(shared []byte, ephemeral, recipient *ecdh.PublicKey) ([]byte, error) {
+	salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+	return hkdf.Key(sha256.New, shared, salt, encKDFLabel, 32)
+}
+
+// segment starts a segment with a fresh data key, returning its header
+// frame and cipher.
+func (this *FileEncryption) segment() ([]byte, *fileCipher, error) {
+	var mode byte
+	var key, blob []byte
+	var err error
+
+	switch {
+	case this.PublicKey != nil:
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		shared, err := ephemeral.ECDH(this.PublicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if key, err = x25519Key(shared, ephemeral.PublicKey(), this.PublicKey); err != nil {
+			return nil, nil, err
+		}
+		mode, blob = encX25519, ephemeral.PublicKey().Bytes()
+	case this.WrapKey != nil:
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, nil, err
+		}
+		if blob, err = this.WrapKey(key); err != nil {
+			return nil, nil, err
+		}
+		mode = encWrapped
+	default:
+		return nil, nil, errors.New("No encryption key given")
+	}
+
+	c, err := newFileCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := []byte{encHeader, mode, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(blob)))
+	return append(header, blob...), c, nil
+}
+
+// decryptReader reads the plaintext of an encrypted log file.
+type decryptReader struct {
+	r      *bufio.Reader
+	key    FileDecryption
+	cipher *fileCipher
+	buf    []byte
+}
+
+// NewDecryptReader returns a reader of the plain text of the encrypted log
+// file read from r. Reading fails on frames that don't authenticate.
+func NewDecryptReader(r io.Reader, key FileDecryption) io.Reader {
+	return &decryptReader{r: bufio.NewReader(r), key: key}
+}
+
+func (this *decryptReader) Read(p []byte) (int, error) {
+	for len(this.buf) == 0 {
+		if err := this.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, this.buf)
+	this.buf = this.buf[n:]
+	return n, nil
+}
+
+// next reads the next frame.
+func (this *decryptReader) next() error {
+	kind, err := this.r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case encHeader:
+		var head [3]byte
+		if _, err := io.ReadFull(this.r, head[:]); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		blob := make([]byte, binary.BigEndian.Uint16(head[1:]))
+		if _, err := io.ReadFull(this.r, blob); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		key, err := this.key.dataKey(head[0], blob)
+		if err != nil {
+			return err
+		}
+		this.cipher, err = newFileCipher(key)
+		return err
+
+	case encRecord:
+		if this.cipher == nil {
+			return errors.New("Encrypted log record before any header")
+		}
+		var size [4]byte
+		if _, err := io.ReadFull(this.r, size[:]); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		sealed := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(this.r, sealed); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		this.buf, err = this.cipher.aead.Open(sealed[:0], this.cipher.nonce(), sealed, nil)
+		return err
+	}
+	return errors.New("Not an encrypted log file")
+}
+
+func (this *FileDecryption) dataKey(mode byte, blob []byte) ([]byte, error) {
+	switch mode {
+	case encX25519:
+		if this.PrivateKey == nil {
+			return nil, errors.New("Log file is encrypted to a public key, no private key given")
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(blob)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := this.PrivateKey.ECDH(ephemeral)
+		if err != nil {
+			return nil, err
+		}
+		return x25519Key(shared, ephemeral, this.PrivateKey.PublicKey())
+	case encWrapped:
+		if this.UnwrapKey == nil {
+			return nil, errors.New("Log file key is wrapped, no UnwrapKey given")
+		}
+		return this.UnwrapKey(blob)
+	}
+	return nil, errors.New("Unknown log file encryption")
+}
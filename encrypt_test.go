@@ -0,0 +1,186 @@
+package kslog
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeEncrypted writes a record per message to a file sink configured by
+// config, reopening the file, and so starting a segment, before each
+// message in reopen.
+func writeEncrypted(t *testing.T, config FileSinkConfig, messages []string, reopen map[int]bool) {
+	t.Helper()
+	config.BufferSize = -1
+	s, err := OpenFileSink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range messages {
+		if reopen[i] {
+			s.(*fileSink).Reopen()
+		}
+		if err := s.Write(&Record{Message: m, Level: INFO}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func decryptFile(path string, key FileDecryption) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	plain, err := io.ReadAll(NewDecryptReader(bytes.NewReader(data), key))
+	return string(plain), err
+}
+
+// segmentHeaders returns the key blobs of the segment headers of an
+// encrypted file whose records are all shorter than 64KiB.
+func segmentHeaders(data []byte) [][]byte {
+	var blobs [][]byte
+	for len(data) > 0 {
+		switch data[0] {
+		case encHeader:
+			n := int(data[2])<<8 | int(data[3])
+			blobs = append(blobs, data[4:4+n])
+			data = data[4+n:]
+		case encRecord:
+			n := int(data[3])<<8 | int(data[4])
+			data = data[5+n:]
+		default:
+			return nil
+		}
+	}
+	return blobs
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A stand-in for a KMS: the wrapped key is the key xored with a pad.
+	pad := bytes.Repeat([]byte{0x5a}, 32)
+	xor := func(key []byte) ([]byte, error) {
+		out := make([]byte, len(key))
+		for i := range key {
+			out[i] = key[i] ^ pad[i]
+		}
+		return out, nil
+	}
+
+	for _, test := range []struct {
+		name string
+		enc  FileEncryption
+		dec  FileDecryption
+	}{
+		{"x25519", FileEncryption{PublicKey: private.PublicKey()}, FileDecryption{PrivateKey: private}},
+		{"wrapped", FileEncryption{WrapKey: xor}, FileDecryption{UnwrapKey: xor}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "x.log")
+			messages := []string{"one", "two", "two", "three"}
+			writeEncrypted(t, FileSinkConfig{Path: path, Encrypt: &test.enc}, messages, map[int]bool{2: true})
+
+			data, _ := os.ReadFile(path)
+			if bytes.Contains(data, []byte("two")) {
+				t.Error("the file holds plain text")
+			}
+			headers := segmentHeaders(data)
+			if len(headers) != 2 || bytes.Equal(headers[0], headers[1]) {
+				t.Errorf("want 2 segments with keys of their own, got %x", headers)
+			}
+
+			plain, err := decryptFile(path, test.dec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range messages {
+				if !strings.Contains(plain, `"`+m+`"`) {
+					t.Errorf("%q missing from %q", m, plain)
+				}
+			}
+			if n := strings.Count(plain, "\n"); n != len(messages) {
+				t.Errorf("got %d records, want %d", n, len(messages))
+			}
+		})
+	}
+}
+
+func TestEncryptTamper(t *testing.T) {
+	private, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	path := filepath.Join(t.TempDir(), "x.log")
+	writeEncrypted(t, FileSinkConfig{Path: path, Encrypt: &FileEncryption{PublicKey: private.PublicKey()}}, []string{"aaa", "bbb", "ccc"}, nil)
+	data, _ := os.ReadFile(path)
+	key := FileDecryption{PrivateKey: private}
+
+	// The record frames, after the header.
+	header := 4 + len(segmentHeaders(data)[0])
+	var frames [][]byte
+	for rest := data[header:]; len(rest) > 0; {
+		n := 5 + (int(rest[3])<<8 | int(rest[4]))
+		frames = append(frames, rest[:n])
+		rest = rest[n:]
+	}
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(frames))
+	}
+
+	flipped := append([]byte(nil), data...)
+	flipped[header+len(frames[0])+10] ^= 1
+	swapped := append(append(append(append([]byte(nil), data[:header]...), frames[1]...), frames[0]...), frames[2]...)
+	otherKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+
+	for name, test := range map[string]struct {
+		data []byte
+		key  FileDecryption
+	}{
+		"flipped bit":     {flipped, key},
+		"swapped records": {swapped, key},
+		"truncated frame": {data[:len(data)-3], key},
+		"wrong key":       {data, FileDecryption{PrivateKey: otherKey}},
+		"no key":          {data, FileDecryption{}},
+	} {
+		if _, err := io.ReadAll(NewDecryptReader(bytes.NewReader(test.data), test.key)); err == nil {
+			t.Errorf("%s: read without an error", name)
+		}
+	}
+}
+
+func TestEncryptRotate(t *testing.T) {
+	private, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	dir := t.TempDir()
+	var messages []string
+	for i := 0; i < 20; i++ {
+		messages = append(messages, fmt.Sprintf("record-%02d", i))
+	}
+	writeEncrypted(t, FileSinkConfig{Path: filepath.Join(dir, "x.log"), MaxSize: 300, Encrypt: &FileEncryption{PublicKey: private.PublicKey()}}, messages, nil)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "x.log*"))
+	if len(files) < 3 {
+		t.Fatalf("got %d files, want the log rotated", len(files))
+	}
+	var all string
+	for _, f := range files {
+		plain, err := decryptFile(f, FileDecryption{PrivateKey: private})
+		if err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		all += plain
+	}
+	for _, m := range messages {
+		if strings.Count(all, m) != 1 {
+			t.Errorf("%s found %d times", m, strings.Count(all, m))
+		}
+	}
+}
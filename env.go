@@ -0,0 +1,64 @@
+package kslog
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// newDefaultLogger returns the default logger, configured by the
+// environment so that containers and CI jobs can adjust it without code
+// changes:
+//
+//	KSLOG_LEVEL    the most verbose level logged, e.g. INFO
+//	KSLOG_DIR      the directory of the log file
+//	KSLOG_FORMAT   text, json or console, for the console and the file
+//	KSLOG_CONSOLE  stdout, stderr or off
+//	KSLOG_QUEUE    how many records are queued for the sinks
+//
+// Invalid values are reported on stderr and ignored.
+func newDefaultLogger() *logger {
+	size := defaultQueueSize
+	if s := os.Getenv("KSLOG_QUEUE"); s != "" {
+		if n, err := strconv.Atoi(s); err != nil || n < 0 {
+			envInvalid("KSLOG_QUEUE", s, "not a queue size")
+		} else {
+			size = n
+		}
+	}
+	l := NewLoggerQueue(size)
+
+	if s := os.Getenv("KSLOG_LEVEL"); s != "" {
+		if level, err := ParseLevel(s); err != nil {
+			envInvalid("KSLOG_LEVEL", s, err)
+		} else {
+			l.SetLevel(level)
+		}
+	}
+
+	if s := os.Getenv("KSLOG_FORMAT"); s != "" {
+		if format, err := parseFormat(s); err != nil {
+			envInvalid("KSLOG_FORMAT", s, err)
+		} else {
+			l.setFormat(format)
+		}
+	}
+
+	switch s := os.Getenv("KSLOG_CONSOLE"); strings.ToLower(s) {
+	case "":
+	case "stdout":
+		l.SetConsole(ConsoleStdout)
+	case "stderr":
+		l.SetConsole(ConsoleStderr)
+	case "off":
+		l.SetConsole(ConsoleOff)
+	default:
+		envInvalid("KSLOG_CONSOLE", s, "not stdout, stderr or off")
+	}
+	return l
+}
+
+func envInvalid(name, value string, reason interface{}) {
+	reportError(fmt.Errorf("Ignoring %s=%s: %v", name, value, reason))
+}
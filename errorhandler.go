@@ -0,0 +1,49 @@
+package kslog
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// ErrorHandler receives the errors of the logger no logging call can
+// return: log files failing to open, records failing to encode and sinks
+// failing to write.
+type ErrorHandler func(err error)
+
+var errorHandler atomic.Pointer[ErrorHandler]
+
+// SetErrorHandler makes handler receive the logger's own errors, e.g. to
+// count them in the application's monitoring:
+//
+//	kslog.SetErrorHandler(func(err error) {
+//		logErrors.Inc()
+//	})
+//
+// Without a handler, or after SetErrorHandler(nil), errors the logger
+// can't recover from are written to stderr. The handler may run on the
+// goroutine writing records; it must not log, nor block for long.
+func SetErrorHandler(handler ErrorHandler) {
+	if handler == nil {
+		errorHandler.Store(nil)
+		return
+	}
+	errorHandler.Store(&handler)
+}
+
+// reportError hands err to the error handler, or writes it to stderr.
+func reportError(err error) {
+	if h := errorHandler.Load(); h != nil {
+		(*h)(err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "kslog:", err)
+}
+
+// notifyError hands err to the error handler, if there is one. It is for
+// errors the logger recovered from, which stderr isn't bothered with.
+func notifyError(err error) {
+	if h := errorHandler.Load(); h != nil {
+		(*h)(err)
+	}
+}
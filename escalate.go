@@ -0,0 +1,149 @@
+package kslog
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EscalationRule changes the level of records repeated too often: once
+// more than Count records of Module at Level with the same code are
+// logged within Window, the records that follow, and the one that made
+// it, are logged at To instead, e.g. to surface a persistent problem:
+//
+//	kslog.AddEscalation(kslog.EscalationRule{Level: kslog.WARNING, Count: 20, Window: time.Minute, To: kslog.ERROR})
+//
+// or to keep a flood of DEBUG records of module "cache" out of the sinks
+// that take DEBUG:
+//
+//	kslog.AddEscalation(kslog.EscalationRule{Module: "cache", Level: kslog.DEBUG, Count: 100, Window: time.Second, To: kslog.DEBUG2})
+type EscalationRule struct {
+	// Module is the module the rule is for, every module if empty.
+	Module string
+	Level  Level
+	Count  int
+	Window time.Duration
+	To     Level
+}
+
+// escalation is a rule with the times of the records it counted lately,
+// by module and code, and when keys without any were last removed. They
+// are only used by the goroutine writing records.
+type escalation struct {
+	rule  EscalationRule
+	times map[escalationKey][]time.Time
+	swept time.Time
+}
+
+type escalationKey struct {
+	module string
+	code   int32
+}
+
+// escalations are the rules of a logger, replaced as a whole when one is
+// added.
+type escalations struct {
+	rules atomic.Pointer[[]*escalation]
+	mu    sync.Mutex
+}
+
+// AddEscalation adds rule. Where rules overlap, the one added first
+// applies. Records escalated carry the level they were logged at under
+// the "escalated_from" key. Records escalated to ERROR or more severe
+// levels carry a Stack like those logged at them; for that the stack is
+// taken of every record the rule counts.
+func (this *logger) AddEscalation(rule EscalationRule) {
+	this.escalations.mu.Lock()
+	defer this.escalations.mu.Unlock()
+
+	var rules []*escalation
+	if old := this.escalations.rules.Load(); old != nil {
+		rules = append(rules, *old...)
+	}
+	rules = append(rules, &escalation{rule: rule, times: make(map[escalationKey][]time.Time)})
+	this.escalations.rules.Store(&rules)
+}
+
+// ClearEscalations removes the escalation rules.
+func (this *logger) ClearEscalations() {
+	this.escalations.rules.Store(nil)
+}
+
+// AddEscalation adds an escalation rule to the default logger.
+func AddEscalation(rule EscalationRule) {
+	logging.AddEscalation(rule)
+}
+
+// ClearEscalations removes the escalation rules of the default logger.
+func ClearEscalations() {
+	logging.ClearEscalations()
+}
+
+// rule returns the escalation that applies to records of module at level,
+// or nil.
+func (this *escalations) rule(level Level, module string) *escalation {
+	rules := this.rules.Load()
+	if rules == nil {
+		return nil
+	}
+	for _, e := range *rules {
+		if level == e.rule.Level && (e.rule.Module == "" || module == e.rule.Module) {
+			return e
+		}
+	}
+	return nil
+}
+
+// wantStack tells whether records of module at level get a Stack: those
+// at ERROR and more severe levels, and those that may be escalated to
+// them.
+func (this *logger) wantStack(level Level, module string) bool {
+	if level <= ERROR {
+		return true
+	}
+	e := this.escalations.rule(level, module)
+	return e != nil && e.rule.To <= ERROR
+}
+
+// escalate changes the level of r if a rule says so.
+func (this *logger) escalate(r *Record) {
+	e := this.escalations.rule(r.Level, r.Module)
+	if e == nil {
+		return
+	}
+
+	now := this.now()
+	if now.Sub(e.swept) > e.rule.Window {
+		e.sweep(now)
+	}
+	key := escalationKey{r.Module, r.Code}
+	times := e.times[key]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) > e.rule.Window {
+		i++
+	}
+	times = append(times[i:], now)
+	if len(times) > e.rule.Count+1 {
+		times = times[1:]
+	}
+	e.times[key] = times
+
+	if len(times) > e.rule.Count {
+		r.Args["escalated_from"] = r.Level.String()
+		r.Level = e.rule.To
+	} else if r.Level > ERROR {
+		// The stack was only taken in case r was escalated.
+		r.Stack = r.Stack[:0]
+	}
+}
+
+// sweep removes the keys whose records are all older than the window, so
+// that modules and codes seen once don't stay forever.
+func (this *escalation) sweep(now time.Time) {
+	for key, times := range this.times {
+		if now.Sub(times[len(times)-1]) > this.rule.Window {
+			delete(this.times, key)
+		}
+	}
+	this.swept = now
+}
@@ -0,0 +1,76 @@
+package kslog
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a clock that only moves on add, safe to read from the
+// sink goroutine.
+type testClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (this *testClock) Now() time.Time {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.t
+}
+
+func (this *testClock) add(d time.Duration) {
+	this.mu.Lock()
+	this.t = this.t.Add(d)
+	this.mu.Unlock()
+}
+
+func TestEscalateStack(t *testing.T) {
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	sink := new(recordSink)
+	l.AddSink(sink)
+	l.AddEscalation(EscalationRule{Level: WARNING, Count: 2, Window: time.Minute, To: ERROR})
+
+	module := "test"
+	for i := 0; i < 4; i++ {
+		l.printf(WARNING, &module, 1, "warning %d", i)
+	}
+	l.Flush()
+
+	if len(sink.records) != 4 {
+		t.Fatalf("got %d records, want 4", len(sink.records))
+	}
+	for i, r := range sink.records {
+		if escalated := i >= 2; (r.Level == ERROR) != escalated || (len(r.Stack) > 0) != escalated {
+			t.Errorf("record %d: level %s, %d frames", i, r.Level, len(r.Stack))
+		}
+	}
+}
+
+func TestEscalateSweep(t *testing.T) {
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	l.AddSink(new(recordSink))
+	clock := &testClock{t: time.Now()}
+	l.SetClock(clock)
+	l.AddEscalation(EscalationRule{Level: WARNING, Count: 2, Window: time.Minute, To: ERROR})
+	e := (*l.escalations.rules.Load())[0]
+
+	module := "test"
+	for code := int32(0); code < 100; code++ {
+		l.printf(WARNING, &module, code, "once")
+	}
+	l.Flush()
+	if len(e.times) != 100 {
+		t.Fatalf("got %d keys, want 100", len(e.times))
+	}
+
+	// Once the window passed, only the key of the new record is left.
+	clock.add(2 * time.Minute)
+	l.printf(WARNING, &module, 1000, "later")
+	l.Flush()
+	if len(e.times) != 1 {
+		t.Errorf("got %d keys, want the old ones removed", len(e.times))
+	}
+}
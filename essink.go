@@ -0,0 +1,142 @@
+package kslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ElasticSinkConfig configures an ElasticSink.
+type ElasticSinkConfig struct {
+	// URL is the Elasticsearch/OpenSearch base URL.
+	URL string
+	// Index is the index name, or its prefix when IndexDateFormat is set.
+	Index string
+	// IndexDateFormat, e.g. "2006.01.02" for daily indices, is appended
+	// to Index as "-<date>" using each record's UTC time.
+	IndexDateFormat string
+	// Header is added to every request, e.g. for basic or ApiKey auth.
+	Header http.Header
+	TLS    *tls.Config
+	// BatchSize, FlushInterval and MaxRetries default to 100, 1s and 3;
+	// see NoRetries and RetryForever.
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+}
+
+// ElasticSink bulk-indexes records into Elasticsearch or OpenSearch, one
+// document per record with the structured args under "args". Documents
+// rejected with 429 are retried; other rejected documents are dropped.
+type ElasticSink struct {
+	config ElasticSinkConfig
+	url    string
+	client *http.Client
+	batch  *batcher
+}
+
+type elasticBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+	} `json:"items"`
+}
+
+// NewElasticSink returns a sink indexing into config.URL.
+func NewElasticSink(config ElasticSinkConfig) *ElasticSink {
+	s := &ElasticSink{
+		config: config,
+		url:    strings.TrimRight(config.URL, "/") + "/_bulk",
+		client: newHTTPClient(config.TLS),
+	}
+	s.batch = newBatcher(config.BatchSize, config.FlushInterval, config.MaxRetries, s.flush, nil)
+	return s
+}
+
+func (this *ElasticSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *ElasticSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *ElasticSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close sends what is still pending and stops the sink.
+func (this *ElasticSink) Close() error {
+	this.batch.close()
+	return nil
+}
+
+func (this *ElasticSink) index(r *Record) string {
+	if this.config.IndexDateFormat == "" {
+		return this.config.Index
+	}
+	return this.config.Index + "-" + r.Time.UTC().Format(this.config.IndexDateFormat)
+}
+
+func (this *ElasticSink) flush(records []*Record) error {
+	buf := new(bytes.Buffer)
+	for _, r := range records {
+		action, _ := json.Marshal(map[string]map[string]string{
+			"index": {"_index": this.index(r)},
+		})
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(encodeJSON(r))
+		buf.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest("POST", this.url, buf)
+	if err != nil {
+		return permanentError{err}
+	}
+	for k, v := range this.config.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := httpStatusError(resp); err != nil {
+		return err
+	}
+
+	var bulk elasticBulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&bulk); err != nil || !bulk.Errors {
+		return nil
+	}
+
+	var retry, rejected []*Record
+	for i, item := range bulk.Items {
+		if i >= len(records) {
+			break
+		}
+		for _, result := range item {
+			if result.Status == http.StatusTooManyRequests {
+				retry = append(retry, records[i])
+			} else if result.Status >= 300 {
+				rejected = append(rejected, records[i])
+			}
+		}
+	}
+	if len(retry) == 0 {
+		return partialError{fmt.Errorf("%s: %d documents rejected", this.url, len(rejected)), rejected, true, nil}
+	}
+	// The rejected documents are dropped while the throttled ones are
+	// retried.
+	return partialError{fmt.Errorf("%s: %d documents throttled, %d rejected", this.url, len(retry), len(rejected)), retry, false, rejected}
+}
@@ -0,0 +1,76 @@
+package kslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestElasticSinkMixedRejections(t *testing.T) {
+	var mu sync.Mutex
+	var indexed []string
+	throttled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var items []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			// Skip the action line and take the message of the document.
+			scanner.Scan()
+			var doc struct{ Message string }
+			json.Unmarshal(scanner.Bytes(), &doc)
+			status := http.StatusCreated
+			switch {
+			case doc.Message == "throttled" && !throttled:
+				throttled = true
+				status = http.StatusTooManyRequests
+			case doc.Message == "bad":
+				status = http.StatusBadRequest
+			default:
+				indexed = append(indexed, doc.Message)
+			}
+			items = append(items, fmt.Sprintf(`{"index":{"status":%d}}`, status))
+		}
+		fmt.Fprintf(w, `{"errors":true,"items":[%s]}`, strings.Join(items, ","))
+	}))
+	defer server.Close()
+
+	var errs []error
+	SetErrorHandler(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	defer SetErrorHandler(nil)
+
+	s := NewElasticSink(ElasticSinkConfig{URL: server.URL, Index: "logs", FlushInterval: 10 * time.Millisecond})
+	for _, m := range []string{"ok", "throttled", "bad"} {
+		s.Write(&Record{Message: m, Level: INFO})
+	}
+	for i := 0; i < 200; i++ {
+		mu.Lock()
+		n := len(indexed)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(indexed, ",") != "ok,throttled" {
+		t.Errorf("indexed %v, want the throttled document retried", indexed)
+	}
+	if s.Dropped() != 1 || len(errs) != 1 || !strings.Contains(errs[0].Error(), "1 rejected") {
+		t.Errorf("got %d dropped, errors %v, want the rejected document dropped", s.Dropped(), errs)
+	}
+}
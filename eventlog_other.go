@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package kslog
+
+// systemSinks returns the sinks every logger gets on this platform, at
+// systemSinkLevel.
+func systemSinks() []Sink {
+	return nil
+}
@@ -0,0 +1,190 @@
+package kslog
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	eventlogErrorType       = 0x0001
+	eventlogWarningType     = 0x0002
+	eventlogInformationType = 0x0004
+
+	eventlogKey = `SYSTEM\CurrentControlSet\Services\EventLog\Application\`
+
+	// EventCreate.exe ships with windows and carries a "%1" message for
+	// event ids 1-1000, so it can serve as the message file of any source.
+	eventlogMessageFile = `%SystemRoot%\System32\EventCreate.exe`
+	eventlogEventID     = 1
+)
+
+var (
+	advapi32 = syscall.NewLazyDLL("advapi32.dll")
+
+	procRegisterEventSourceW  = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+	procReportEventW          = advapi32.NewProc("ReportEventW")
+	procRegCreateKeyExW       = advapi32.NewProc("RegCreateKeyExW")
+	procRegSetValueExW        = advapi32.NewProc("RegSetValueExW")
+	procRegDeleteKeyW         = advapi32.NewProc("RegDeleteKeyW")
+)
+
+// InstallEventSource registers source with the Application event log.
+// It needs administrator rights and is usually called once by an installer.
+func InstallEventSource(source string) error {
+	keyname, err := syscall.UTF16PtrFromString(eventlogKey + source)
+	if err != nil {
+		return err
+	}
+
+	var key syscall.Handle
+	var disposition uint32
+	r, _, _ := procRegCreateKeyExW.Call(
+		uintptr(syscall.HKEY_LOCAL_MACHINE),
+		uintptr(unsafe.Pointer(keyname)),
+		0, 0, 0,
+		uintptr(syscall.KEY_WRITE),
+		0,
+		uintptr(unsafe.Pointer(&key)),
+		uintptr(unsafe.Pointer(&disposition)))
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	defer syscall.RegCloseKey(key)
+
+	msgfile, err := syscall.UTF16FromString(eventlogMessageFile)
+	if err != nil {
+		return err
+	}
+	err = regSetValue(key, "EventMessageFile", syscall.REG_EXPAND_SZ,
+		(*byte)(unsafe.Pointer(&msgfile[0])), uint32(len(msgfile)*2))
+	if err != nil {
+		return err
+	}
+
+	types := uint32(eventlogErrorType | eventlogWarningType | eventlogInformationType)
+	return regSetValue(key, "TypesSupported", syscall.REG_DWORD,
+		(*byte)(unsafe.Pointer(&types)), 4)
+}
+
+// RemoveEventSource removes the registration made by InstallEventSource.
+func RemoveEventSource(source string) error {
+	keyname, err := syscall.UTF16PtrFromString(eventlogKey + source)
+	if err != nil {
+		return err
+	}
+
+	r, _, _ := procRegDeleteKeyW.Call(
+		uintptr(syscall.HKEY_LOCAL_MACHINE),
+		uintptr(unsafe.Pointer(keyname)))
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
+
+func regSetValue(key syscall.Handle, name string, vtype uint32, data *byte, size uint32) error {
+	pname, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+
+	r, _, _ := procRegSetValueExW.Call(
+		uintptr(key),
+		uintptr(unsafe.Pointer(pname)),
+		0,
+		uintptr(vtype),
+		uintptr(unsafe.Pointer(data)),
+		uintptr(size))
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
+
+// eventlogSink reports records to the windows Application event log.
+type eventlogSink struct {
+	handle uintptr
+}
+
+// NewEventlogSink returns a sink reporting records to the Application
+// event log as source, see InstallEventSource. Every logger gets one for
+// the program's name, taking WARNING and more severe records; attach your
+// own with AddSinkLevel for another source or level.
+func NewEventlogSink(source string) (Sink, error) {
+	return newEventlogSink(source)
+}
+
+func newEventlogSink(source string) (*eventlogSink, error) {
+	psource, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, err
+	}
+
+	h, _, e := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(psource)))
+	if h == 0 {
+		return nil, e
+	}
+	return &eventlogSink{handle: h}, nil
+}
+
+func eventlogType(level Level) uint16 {
+	switch level {
+	case EMERGE, ALERT, CRIT, ERROR:
+		return eventlogErrorType
+	case WARNING:
+		return eventlogWarningType
+	}
+	return eventlogInformationType
+}
+
+func (this *eventlogSink) Write(r *Record) error {
+	if this.handle == 0 {
+		return errors.New("Event log source is closed")
+	}
+
+	out := fileLine(r)
+	msg, err := syscall.UTF16PtrFromString(out[:len(out)-1])
+	if err != nil {
+		return err
+	}
+
+	ret, _, e := procReportEventW.Call(
+		this.handle,
+		uintptr(eventlogType(r.Level)),
+		0,
+		eventlogEventID,
+		0,
+		1,
+		0,
+		uintptr(unsafe.Pointer(&msg)),
+		0)
+	if ret == 0 {
+		return e
+	}
+	return nil
+}
+
+func (this *eventlogSink) Close() error {
+	if this.handle == 0 {
+		return nil
+	}
+
+	r, _, e := procDeregisterEventSource.Call(this.handle)
+	this.handle = 0
+	if r == 0 {
+		return e
+	}
+	return nil
+}
+
+// systemSinks returns the sinks every logger gets on this platform, at
+// systemSinkLevel.
+func systemSinks() []Sink {
+	s, err := newEventlogSink(getProgram())
+	if err != nil {
+		return nil
+	}
+	return []Sink{s}
+}
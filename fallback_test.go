@@ -0,0 +1,52 @@
+package kslog
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// recordSink keeps copies of the records written to it.
+type recordSink struct {
+	mu      sync.Mutex
+	records []*Record
+}
+
+func (this *recordSink) Write(r *Record) error {
+	this.mu.Lock()
+	this.records = append(this.records, r.Clone())
+	this.mu.Unlock()
+	return nil
+}
+
+func (this *recordSink) Close() error {
+	return nil
+}
+
+func TestFallbackAsyncSink(t *testing.T) {
+	server, _, _ := webhookServer(t, http.StatusBadRequest, 1000)
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	fallback := new(recordSink)
+	l.SetFallbackSink(fallback)
+	l.AddSink(NewHTTPSink(HTTPSinkConfig{URL: server.URL}))
+
+	module := "test"
+	l.printf(ERROR, &module, 1, "lost %d", 1)
+	l.printf(ERROR, &module, 2, "lost %d", 2)
+	l.Flush()
+	// Closing sends the batch, whose failure ends up in the fallback sink
+	// while the logger is busy closing its sinks.
+	l.ResetSinks()
+
+	fallback.mu.Lock()
+	defer fallback.mu.Unlock()
+	if len(fallback.records) != 2 {
+		t.Fatalf("got %d records, want 2", len(fallback.records))
+	}
+	for i, r := range fallback.records {
+		if r.Code != int32(i+1) || r.Args["kslog_sink_error"] == nil {
+			t.Errorf("got %+v", r)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package kslog
+
+import (
+	"math"
+	"time"
+)
+
+type fieldKind uint8
+
+const (
+	fieldAny fieldKind = iota
+	fieldString
+	fieldInt
+	fieldUint
+	fieldFloat
+	fieldBool
+	fieldDuration
+	fieldNoCaller
+	fieldSecurity
+)
+
+// Field is a typed key value pair for the Fields logging calls. Building
+// one doesn't allocate, and it is only turned into an Args entry on the
+// sink goroutine.
+type Field struct {
+	Key  string
+	kind fieldKind
+	num  uint64
+	str  string
+	any  interface{}
+}
+
+// String returns a string field.
+func String(key, value string) Field {
+	return Field{Key: key, kind: fieldString, str: value}
+}
+
+// Int returns an int field.
+func Int(key string, value int) Field {
+	return Field{Key: key, kind: fieldInt, num: uint64(value)}
+}
+
+// Int64 returns an int64 field.
+func Int64(key string, value int64) Field {
+	return Field{Key: key, kind: fieldInt, num: uint64(value)}
+}
+
+// Uint64 returns a uint64 field.
+func Uint64(key string, value uint64) Field {
+	return Field{Key: key, kind: fieldUint, num: value}
+}
+
+// Float64 returns a float64 field.
+func Float64(key string, value float64) Field {
+	return Field{Key: key, kind: fieldFloat, num: math.Float64bits(value)}
+}
+
+// Bool returns a bool field.
+func Bool(key string, value bool) Field {
+	f := Field{Key: key, kind: fieldBool}
+	if value {
+		f.num = 1
+	}
+	return f
+}
+
+// Duration returns a time.Duration field.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, kind: fieldDuration, num: uint64(value)}
+}
+
+// Err returns an "error" field holding err.
+func Err(err error) Field {
+	return Field{Key: "error", any: err}
+}
+
+// Any returns a field of any other type. Storing the value in an
+// interface may allocate.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, any: value}
+}
+
+// NoCaller, given among the fields of a call, skips looking up the file
+// and line it was made from, for hot paths where that lookup is the
+// dominant cost; see also SetCaller.
+var NoCaller = Field{kind: fieldNoCaller}
+
+// Value returns the field's value.
+func (f Field) Value() interface{} {
+	switch f.kind {
+	case fieldString:
+		return f.str
+	case fieldInt:
+		return int64(f.num)
+	case fieldUint:
+		return f.num
+	case fieldFloat:
+		return math.Float64frombits(f.num)
+	case fieldBool:
+		return f.num == 1
+	case fieldDuration:
+		return time.Duration(f.num)
+	}
+	return f.any
+}
+
+// expandFields moves the typed fields of r into its Args.
+func expandFields(r *Record) {
+	for _, f := range r.fields {
+		switch f.kind {
+		case fieldNoCaller:
+		case fieldSecurity:
+			r.Security = SecurityCategory(f.str)
+		default:
+			r.Args[f.Key] = f.Value()
+		}
+	}
+	r.fields = r.fields[:0]
+}
@@ -0,0 +1,717 @@
+package kslog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSinkConfig configures a file sink.
+type FileSinkConfig struct {
+	// Path is the file records are appended to. When it is empty, a file
+	// named <program>.log.<time>.<pid> is created in Dir on the first
+	// write instead, with a <program>.log symlink to the newest one. With
+	// Append set, records are appended to <program>.log in Dir, across
+	// restarts, and rotated files are renamed like Path. Without a Dir
+	// either, it is the default directory, see SetFileConfig.
+	Path   string
+	Dir    string
+	Append bool
+	// Name is the template of the names of the files created in Dir,
+	// "{program}.log.{time}.{pid}" by default: {program} is the program
+	// name, see SetProgramName, {host} the host name, {time} when the file
+	// was created as 20060102-150405 and {pid} the process ID. The symlink
+	// and the file appended to are named by what comes before {time} or
+	// {pid}, without a trailing '.', '-' or '_'; retention only considers
+	// the files whose name starts with that, so it shouldn't be empty.
+	Name string
+	// Format defaults to TextFormatter.
+	Format Formatter
+	// Chain, when set, formats records as ChainFormatter does, instead of
+	// Format, and, given a SigningKey, ends every file closed or rotated
+	// with a checkpoint saying so. The chain goes on across files.
+	Chain *ChainConfig
+	// MaxSize rotates the file before it grows past this many bytes; zero
+	// never rotates on size. A rotated Path is renamed with a timestamp
+	// suffix; in Dir a new timestamped file is started.
+	MaxSize int64
+	// RotateEvery rotates the file at fixed boundaries, e.g. time.Hour or
+	// 24 * time.Hour, aligned on midnight plus RotateOffset in local time,
+	// or in UTC if RotateUTC is set. Daily rotation at 03:00 is
+	// RotateEvery 24h with RotateOffset 3h.
+	RotateEvery  time.Duration
+	RotateOffset time.Duration
+	RotateUTC    bool
+	// Compress, when set, compresses rotated files in the background,
+	// except for the KeepUncompressed most recent ones.
+	Compress         *Compressor
+	KeepUncompressed int
+	// MaxFiles, MaxAge and MaxTotalSize limit the log files kept, counting
+	// the current one; the oldest are removed whenever a file is opened.
+	// Zero means no limit.
+	MaxFiles     int
+	MaxAge       time.Duration
+	MaxTotalSize int64
+	// FileMode and DirMode are the permissions of new log files and of a
+	// created log directory, 0644 and 0770 by default. They are applied
+	// regardless of the umask. Windows files inherit the directory's ACL
+	// instead.
+	FileMode os.FileMode
+	DirMode  os.FileMode
+	// SyncRecords, SyncInterval and SyncOnLevel trade throughput against
+	// losing records on power loss: the file is fsynced after every
+	// SyncRecords records, SyncInterval after the first unsynced record,
+	// and right after records at SyncLevel or more severe. By default it
+	// is never synced.
+	SyncRecords  int
+	SyncInterval time.Duration
+	SyncOnLevel  bool
+	SyncLevel    Level
+	// BufferSize is the size of the write buffer, 64KiB by default; a
+	// negative size writes every record straight to the file. Buffered
+	// records are written out FlushInterval (1s by default) after the
+	// first of them or, after a record at FlushLevel (ERROR if nil, see
+	// LevelPtr) or more severe, as soon as the sink goroutine has no more
+	// queued.
+	BufferSize    int
+	FlushInterval time.Duration
+	FlushLevel    *Level
+	// MinFreeSpace, in bytes, guards the filesystem of the log file: when
+	// less is free the sink degrades as DiskFull says, after rotating and
+	// compressing what it can, until space is available again. Free space
+	// is checked every DiskCheckInterval, 10s by default.
+	MinFreeSpace      uint64
+	DiskFull          int
+	DiskCheckInterval time.Duration
+	// Encrypt, when set, encrypts the file's contents; read it back with
+	// NewDecryptReader.
+	Encrypt *FileEncryption
+	// Clock, when set, is the time the file is rotated, named and
+	// retained by, for tests; see SetClock.
+	Clock Clock
+}
+
+// What a file sink does when its disk is low on space, see MinFreeSpace.
+const (
+	// DiskFullDropDebug stops writing DEBUG and DEBUG2 records.
+	DiskFullDropDebug = iota
+	// DiskFullStop stops writing records altogether.
+	DiskFullStop
+)
+
+// fileSink writes records to a log file. The default logger's file sink
+// is given a directory and creates a timestamped file in it on the first
+// write.
+type fileSink struct {
+	config FileSinkConfig
+	// mu guards the file against the flush and sync timers.
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	cipher *fileCipher
+	size   int64
+	// next is when the file is due for time based rotation.
+	next       time.Time
+	err        error
+	format     Formatter
+	flushLevel Level
+	flushTimer *time.Timer
+	// unsynced counts the records written since the last fsync.
+	unsynced  int
+	syncTimer *time.Timer
+	// flushDue and syncDue are set by records that have the buffer
+	// written out, or the file synced, at the end of the batch.
+	flushDue bool
+	syncDue  bool
+	// degraded is set while the disk is low on space.
+	degraded  bool
+	lastCheck time.Time
+	// rotated are the files rotated away and not compressed yet.
+	rotated     []string
+	compressing sync.WaitGroup
+	// chain is the chain of Chain, and chainHead the last record of it
+	// written to the file, if chained is set.
+	chain     *chainFormatter
+	chainHead chainLink
+	chained   bool
+}
+
+// NewFileSink returns a sink appending records to the file at path with
+// format, creating the file if needed.
+func NewFileSink(path string, format Formatter) (Sink, error) {
+	return OpenFileSink(FileSinkConfig{Path: path, Format: format})
+}
+
+// OpenFileSink returns a file sink configured by config. A Path is opened
+// right away so errors are reported here; a file in Dir is only created
+// once the first record is written.
+func OpenFileSink(config FileSinkConfig) (Sink, error) {
+	s := newFileSink(config)
+	if config.Path != "" {
+		if err := s.open(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func newFileSink(config FileSinkConfig) *fileSink {
+	s := &fileSink{config: config, format: config.Format}
+	if config.Chain != nil {
+		s.chain = newChainFormatter(*config.Chain)
+		s.format = s.chain.format
+	}
+	if s.format == nil {
+		s.format = TextFormatter
+	}
+	if s.config.FileMode == 0 {
+		s.config.FileMode = 0644
+	}
+	if s.config.DirMode == 0 {
+		s.config.DirMode = 0770
+	}
+	if s.config.BufferSize == 0 {
+		s.config.BufferSize = 64 << 10
+	}
+	if s.config.FlushInterval <= 0 {
+		s.config.FlushInterval = time.Second
+	}
+	s.flushLevel = ERROR
+	if s.config.FlushLevel != nil {
+		s.flushLevel = *s.config.FlushLevel
+	}
+	if s.config.DiskCheckInterval <= 0 {
+		s.config.DiskCheckInterval = 10 * time.Second
+	}
+	return s
+}
+
+// nextRotation returns the first rotation boundary after now.
+func nextRotation(now time.Time, every, offset time.Duration, utc bool) time.Time {
+	loc := time.Local
+	if utc {
+		loc = time.UTC
+	}
+	t := now.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+	// Whole days are added by date so that DST changes don't shift them.
+	day := 24 * time.Hour
+	if every%day == 0 {
+		next := midnight.Add(offset % day)
+		if next.After(t) {
+			next = next.AddDate(0, 0, -1)
+		}
+		for !next.After(t) {
+			next = next.AddDate(0, 0, int(every/day))
+		}
+		return next
+	}
+
+	next := midnight.Add(offset % every)
+	for !next.After(t) {
+		next = next.Add(every)
+	}
+	return next
+}
+
+// defaultFileName is the default template of the names of log files.
+const defaultFileName = "{program}.log.{time}.{pid}"
+
+// fileName returns the name of a log file created at t, by template.
+func fileName(template string, t time.Time) string {
+	if template == "" {
+		template = defaultFileName
+	}
+	return expandFileName(template, t)
+}
+
+func expandFileName(template string, t time.Time) string {
+	host, _ := os.Hostname()
+	return strings.NewReplacer(
+		"{program}", getProgram(),
+		"{host}", host,
+		"{time}", t.Format("20060102-150405"),
+		"{pid}", strconv.Itoa(os.Getpid()),
+	).Replace(template)
+}
+
+// fileNamePrefix returns what the names of log files start with, by
+// template: its expansion up to {time} or {pid}.
+func fileNamePrefix(template string) string {
+	if template == "" {
+		template = defaultFileName
+	}
+	for _, varying := range []string{"{time}", "{pid}"} {
+		if i := strings.Index(template, varying); i >= 0 {
+			template = template[:i]
+		}
+	}
+	return expandFileName(template, time.Time{})
+}
+
+func (this *fileSink) open() error {
+	if this.config.RotateEvery > 0 {
+		this.next = nextRotation(this.now(), this.config.RotateEvery, this.config.RotateOffset, this.config.RotateUTC)
+	}
+
+	if this.config.Path != "" {
+		this.file, this.err = this.openAppend(this.config.Path)
+		if this.err != nil {
+			reportError(fmt.Errorf("Error opening file for logging: %w", this.err))
+			return this.err
+		}
+		if this.err = this.begin(); this.err != nil {
+			return this.err
+		}
+		removeOldLogs(filepath.Dir(this.config.Path), filepath.Base(this.config.Path)+".", this.config.Path, &this.config)
+		return nil
+	}
+
+	if this.config.Dir == "" {
+		this.config.Dir = defaultFileDir()
+	}
+	prefix := fileNamePrefix(this.config.Name)
+	current := strings.TrimRight(prefix, ".-_")
+	if current == "" {
+		current = getProgram() + ".log"
+	}
+
+	// Unprivileged users usually can't write to the default directory;
+	// rather than losing the file, log to a directory of their own.
+	dirs := []string{this.config.Dir}
+	if dir, err := os.UserCacheDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "kslog", getProgram()))
+	}
+	dirs = append(dirs, filepath.Join(os.TempDir(), "kslog", getProgram()))
+
+	this.size = 0
+	var firstErr error
+	for i, dir := range dirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if os.MkdirAll(dir, this.config.DirMode) == nil && runtime.GOOS != "windows" {
+				os.Chmod(dir, this.config.DirMode)
+			}
+		}
+		if this.config.Append {
+			name := filepath.Join(dir, current)
+			// A run without Append may have left the symlink behind.
+			if info, err := os.Lstat(name); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				os.Remove(name)
+			}
+			this.file, this.err = this.openAppend(name)
+		} else {
+			this.file, this.err = this.createUnique(filepath.Join(dir, fileName(this.config.Name, this.now())))
+		}
+		if this.err == nil {
+			if i > 0 {
+				reportError(fmt.Errorf("Can't log to %s (%s), logging to %s instead", dirs[0], firstErr, dir))
+				this.config.Dir = dir
+			}
+			break
+		}
+		if i == 0 {
+			firstErr = this.err
+		}
+	}
+	if this.err != nil {
+		reportError(fmt.Errorf("Error opening file for logging: %w", this.err))
+		return this.err
+	}
+	if this.err = this.begin(); this.err != nil {
+		return this.err
+	}
+	removeOldLogs(this.config.Dir, prefix, this.file.Name(), &this.config)
+	if !this.config.Append {
+		linkCurrent(this.file.Name(), filepath.Join(this.config.Dir, current))
+	}
+	return nil
+}
+
+// begin sets up writing to the file just opened, starting an encrypted
+// segment if needed.
+func (this *fileSink) begin() error {
+	this.w = bufio.NewWriterSize(this.file, this.config.BufferSize)
+	this.cipher = nil
+	if this.config.Encrypt == nil {
+		return nil
+	}
+
+	header, c, err := this.config.Encrypt.segment()
+	if err == nil {
+		_, err = this.w.Write(header)
+	}
+	if err != nil {
+		this.file.Close()
+		this.file, this.w = nil, nil
+		return err
+	}
+	this.cipher = c
+	this.size += int64(len(header))
+	return nil
+}
+
+// encode formats r, encrypting it if needed.
+func (this *fileSink) encode(r *Record) []byte {
+	return this.seal(this.format(r))
+}
+
+// seal encrypts data if needed.
+func (this *fileSink) seal(data []byte) []byte {
+	if this.cipher != nil {
+		data = this.cipher.seal(data)
+	}
+	return data
+}
+
+// sealedSize is how long data of size n is once sealed.
+func (this *fileSink) sealedSize(n int) int64 {
+	if this.cipher != nil {
+		return int64(5 + n + this.cipher.aead.Overhead())
+	}
+	return int64(n)
+}
+
+// openAppend opens name for appending, creating it if needed, and sets
+// size to its current size.
+func (this *fileSink) openAppend(name string) (*os.File, error) {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, this.config.FileMode)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	this.size = info.Size()
+	if this.size == 0 && runtime.GOOS != "windows" {
+		file.Chmod(this.config.FileMode)
+	}
+	return file, nil
+}
+
+// linkCurrent points the symlink link at file, replacing it atomically.
+// Failures are ignored, e.g. where symlinks need privileges.
+func linkCurrent(file, link string) {
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if os.Symlink(filepath.Base(file), tmp) != nil {
+		return
+	}
+	if os.Rename(tmp, link) != nil {
+		os.Remove(tmp)
+	}
+}
+
+// createUnique creates the file name, or name.1, name.2, ... if it
+// already exists, compressed or not.
+func (this *fileSink) createUnique(name string) (*os.File, error) {
+	try := name
+	for i := 1; ; i++ {
+		if !this.compressedExists(try) {
+			file, err := os.OpenFile(try, os.O_WRONLY|os.O_CREATE|os.O_EXCL, this.config.FileMode)
+			if err == nil && runtime.GOOS != "windows" {
+				file.Chmod(this.config.FileMode)
+			}
+			if !os.IsExist(err) {
+				return file, err
+			}
+		}
+		try = name + "." + strconv.Itoa(i)
+	}
+}
+
+func (this *fileSink) compressedExists(name string) bool {
+	if this.config.Compress == nil {
+		return false
+	}
+	_, err := os.Lstat(name + this.config.Compress.Ext)
+	return err == nil
+}
+
+// now returns the time of the sink's clock.
+func (this *fileSink) now() time.Time {
+	return clockNow(this.config.Clock)
+}
+
+// rotate closes the current file and starts a new one.
+func (this *fileSink) rotate() error {
+	closed := this.file.Name()
+	this.closeFile()
+
+	if this.config.Path != "" || this.config.Append {
+		stamped := closed + "." + this.now().Format("20060102-150405")
+		rotated := stamped
+		for i := 1; ; i++ {
+			if _, err := os.Lstat(rotated); os.IsNotExist(err) && !this.compressedExists(rotated) {
+				break
+			}
+			rotated = stamped + "." + strconv.Itoa(i)
+		}
+		if err := os.Rename(closed, rotated); err != nil {
+			return err
+		}
+		closed = rotated
+	}
+
+	if this.config.Compress != nil {
+		this.rotated = append(this.rotated, closed)
+		this.compress(this.config.KeepUncompressed)
+	}
+	return this.open()
+}
+
+// compress starts compressing the rotated files but the keep most recent.
+func (this *fileSink) compress(keep int) {
+	for len(this.rotated) > keep {
+		name := this.rotated[0]
+		this.rotated = this.rotated[1:]
+		this.compressing.Add(1)
+		go func() {
+			defer this.compressing.Done()
+			if err := compressFile(name, this.config.Compress); err != nil {
+				reportError(fmt.Errorf("Error compressing log file: %w", err))
+			}
+		}()
+	}
+}
+
+// checkSpace enters or leaves the degraded mode according to the free
+// space left next to the log file. It must be called with mu held.
+func (this *fileSink) checkSpace() {
+	this.lastCheck = this.now()
+	dir := filepath.Dir(this.file.Name())
+	free, err := diskFree(dir)
+	if err != nil {
+		return
+	}
+
+	low := free < this.config.MinFreeSpace
+	if low == this.degraded {
+		return
+	}
+	this.degraded = low
+
+	var msg string
+	if low {
+		action := "DEBUG records"
+		if this.config.DiskFull == DiskFullStop {
+			action = "all records"
+		}
+		msg = fmt.Sprintf("only %d bytes free in %s, dropping %s", free, dir, action)
+	} else {
+		msg = fmt.Sprintf("%d bytes free in %s again, logging resumed", free, dir)
+	}
+	if low {
+		reportError(errors.New(msg))
+	} else if errorHandler.Load() == nil {
+		fmt.Fprintln(os.Stderr, "kslog:", msg)
+	}
+	if !low || this.config.DiskFull != DiskFullStop {
+		this.w.Write(this.encode(&Record{Message: msg, Level: WARNING, Module: "kslog", Time: this.now()}))
+		this.wroteChain()
+		this.flush()
+	}
+
+	// Make room: rotate the current file so it can be compressed along
+	// with everything rotated before, and apply the retention limits.
+	if low && this.config.Compress != nil && this.size > 0 {
+		this.rotate()
+		this.compress(0)
+	}
+}
+
+// flush writes out the buffer. It must be called with mu held.
+func (this *fileSink) flush() error {
+	if this.flushTimer != nil {
+		this.flushTimer.Stop()
+		this.flushTimer = nil
+	}
+	if this.w == nil {
+		return nil
+	}
+	return this.w.Flush()
+}
+
+func (this *fileSink) flushLater() {
+	this.mu.Lock()
+	this.flushTimer = nil
+	this.flush()
+	this.mu.Unlock()
+}
+
+// sync fsyncs what was written since the last sync. It must be called
+// with mu held.
+func (this *fileSink) sync() error {
+	if this.syncTimer != nil {
+		this.syncTimer.Stop()
+		this.syncTimer = nil
+	}
+	if this.file == nil || this.unsynced == 0 {
+		return nil
+	}
+	this.unsynced = 0
+	if err := this.flush(); err != nil {
+		return err
+	}
+	return this.file.Sync()
+}
+
+func (this *fileSink) syncLater() {
+	this.mu.Lock()
+	this.syncTimer = nil
+	this.sync()
+	this.mu.Unlock()
+}
+
+// wroteChain notes that the record formatted last was written, for the
+// checkpoint closing the file.
+func (this *fileSink) wroteChain() {
+	if this.chain != nil {
+		this.chainHead = this.chain.head()
+		this.chained = true
+	}
+}
+
+// closeFile signs a checkpoint of the chain, if any, syncs, if a sync
+// policy is set, and closes the file. It must be called with mu held.
+func (this *fileSink) closeFile() error {
+	if this.file == nil {
+		return nil
+	}
+	if this.chained {
+		if line := this.chain.closing(this.chainHead); line != nil {
+			n, _ := this.w.Write(this.seal(line))
+			this.size += int64(n)
+		}
+		this.chained = false
+	}
+	err := this.flush()
+	if this.config.SyncRecords > 0 || this.config.SyncInterval > 0 || this.config.SyncOnLevel {
+		if serr := this.sync(); err == nil {
+			err = serr
+		}
+	}
+	if cerr := this.file.Close(); err == nil {
+		err = cerr
+	}
+	this.file = nil
+	this.w = nil
+	this.unsynced = 0
+	return err
+}
+
+func (this *fileSink) Write(r *Record) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.file == nil {
+		if this.err != nil {
+			return this.err
+		}
+		if err := this.open(); err != nil {
+			return err
+		}
+	}
+
+	if this.config.MinFreeSpace > 0 && this.now().Sub(this.lastCheck) >= this.config.DiskCheckInterval {
+		this.checkSpace()
+		if this.file == nil {
+			return this.err
+		}
+	}
+	if this.degraded && (this.config.DiskFull == DiskFullStop || r.Level >= DEBUG) {
+		return nil
+	}
+
+	// Sealed after rotating: a new file starts a segment of its own.
+	data := this.format(r)
+	due := this.config.RotateEvery > 0 && !this.now().Before(this.next)
+	if this.config.MaxSize > 0 && this.size+this.sealedSize(len(data)) > this.config.MaxSize {
+		due = true
+	}
+	if due && this.size > 0 {
+		if err := this.rotate(); err != nil {
+			return err
+		}
+	} else if due {
+		// Nothing to rotate away yet, wait for the next boundary.
+		this.next = nextRotation(this.now(), this.config.RotateEvery, this.config.RotateOffset, this.config.RotateUTC)
+	}
+
+	n, err := this.w.Write(this.seal(data))
+	this.size += int64(n)
+	if err != nil {
+		return err
+	}
+	this.wroteChain()
+
+	if this.config.BufferSize < 0 {
+		if err := this.flush(); err != nil {
+			return err
+		}
+	} else {
+		if r.Level <= this.flushLevel {
+			this.flushDue = true
+		}
+		if this.flushTimer == nil {
+			this.flushTimer = time.AfterFunc(this.config.FlushInterval, this.flushLater)
+		}
+	}
+
+	this.unsynced++
+	switch {
+	case this.config.SyncRecords > 0 && this.unsynced >= this.config.SyncRecords:
+		return this.sync()
+	case this.config.SyncOnLevel && r.Level <= this.config.SyncLevel:
+		this.syncDue = true
+	case this.config.SyncInterval > 0 && this.syncTimer == nil:
+		this.syncTimer = time.AfterFunc(this.config.SyncInterval, this.syncLater)
+	}
+	return nil
+}
+
+// EndBatch writes out the buffer, and syncs the file, if a record of the
+// batch asked for it by its level.
+func (this *fileSink) EndBatch() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	syncDue, flushDue := this.syncDue, this.flushDue
+	this.syncDue, this.flushDue = false, false
+	switch {
+	case syncDue:
+		return this.sync()
+	case flushDue:
+		return this.flush()
+	}
+	return nil
+}
+
+// Reopen closes the file; the next record opens Path again, which
+// logrotate may have moved away, or starts a new file in Dir. It also
+// retries after an earlier failure to open the file.
+func (this *fileSink) Reopen() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.err = nil
+	return this.closeFile()
+}
+
+// Close closes the file and waits for compressions in progress.
+func (this *fileSink) Close() error {
+	defer this.compressing.Wait()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.closeFile()
+}
@@ -0,0 +1,43 @@
+package kslog
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSinkFlushLevel(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		level *Level
+		// flushed are levels that flush the buffer, kept levels that don't.
+		flushed []Level
+		kept    []Level
+	}{
+		{"default", nil, []Level{EMERGE, ERROR}, []Level{WARNING, INFO}},
+		{"EMERGE", LevelPtr(EMERGE), []Level{EMERGE}, []Level{ALERT, ERROR}},
+		{"INFO", LevelPtr(INFO), []Level{ERROR, INFO}, []Level{DEBUG}},
+	} {
+		s, err := OpenFileSink(FileSinkConfig{Path: filepath.Join(t.TempDir(), "x.log"), FlushLevel: test.level, FlushInterval: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs := s.(*fileSink)
+		write := func(level Level) bool {
+			fs.flushDue = false
+			s.Write(&Record{Message: "x", Level: level})
+			return fs.flushDue
+		}
+		for _, level := range test.flushed {
+			if !write(level) {
+				t.Errorf("%s: a %s record doesn't flush", test.name, level)
+			}
+		}
+		for _, level := range test.kept {
+			if write(level) {
+				t.Errorf("%s: a %s record flushes", test.name, level)
+			}
+		}
+		s.Close()
+	}
+}
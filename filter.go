@@ -0,0 +1,120 @@
+package kslog
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxFilterCache bounds the modules a filter caches its decision for,
+// should module names be made up on the fly.
+const maxFilterCache = 1024
+
+// moduleFilter holds the patterns of SetModuleFilter, and caches what
+// they decided by module, as there are few modules.
+type moduleFilter struct {
+	include []func(string) bool
+	exclude []func(string) bool
+	cache   atomic.Pointer[map[string]bool]
+	cacheMu sync.Mutex
+}
+
+// SetModuleFilter mutes modules by name, to silence noisy subsystems
+// without changing their code: a record is logged only if its module
+// matches one of include, or include is empty, and none of exclude. A
+// pattern is a glob as path.Match understands it, or a regular expression
+// between slashes:
+//
+//	kslog.SetModuleFilter([]string{"storage.*"}, []string{"http.access", "/^cache\\./"})
+//
+// Records filtered out are not even built. Both empty remove the filter.
+func (this *logger) SetModuleFilter(include, exclude []string) error {
+	if len(include) == 0 && len(exclude) == 0 {
+		this.filter.Store(nil)
+		return nil
+	}
+	f := new(moduleFilter)
+	var err error
+	if f.include, err = modulePatterns(include); err != nil {
+		return err
+	}
+	if f.exclude, err = modulePatterns(exclude); err != nil {
+		return err
+	}
+	this.filter.Store(f)
+	return nil
+}
+
+// SetModuleFilter sets the module filter of the default logger.
+func SetModuleFilter(include, exclude []string) error {
+	return logging.SetModuleFilter(include, exclude)
+}
+
+func modulePatterns(patterns []string) ([]func(string) bool, error) {
+	var matchers []func(string) bool
+	for _, p := range patterns {
+		if len(p) >= 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			re, err := regexp.Compile(p[1 : len(p)-1])
+			if err != nil {
+				return nil, fmt.Errorf("Bad module pattern %s: %v", p, err)
+			}
+			matchers = append(matchers, re.MatchString)
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("Bad module pattern %s: %v", p, err)
+		}
+		glob := p
+		matchers = append(matchers, func(module string) bool {
+			ok, _ := path.Match(glob, module)
+			return ok
+		})
+	}
+	return matchers, nil
+}
+
+// moduleAllowed reports whether the module filter lets records of module
+// through.
+func (this *logger) moduleAllowed(module string) bool {
+	f := this.filter.Load()
+	if f == nil {
+		return true
+	}
+	if cache := f.cache.Load(); cache != nil {
+		if allowed, ok := (*cache)[module]; ok {
+			return allowed
+		}
+	}
+
+	allowed := len(f.include) == 0
+	for _, match := range f.include {
+		if match(module) {
+			allowed = true
+			break
+		}
+	}
+	for _, match := range f.exclude {
+		if !allowed {
+			break
+		}
+		allowed = !match(module)
+	}
+
+	f.cacheMu.Lock()
+	defer f.cacheMu.Unlock()
+	cache := make(map[string]bool)
+	if old := f.cache.Load(); old != nil {
+		if len(*old) >= maxFilterCache {
+			return allowed
+		}
+		for m, a := range *old {
+			cache[m] = a
+		}
+	}
+	cache[module] = allowed
+	f.cache.Store(&cache)
+	return allowed
+}
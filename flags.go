@@ -0,0 +1,113 @@
+package kslog
+
+import (
+	"flag"
+	"strconv"
+)
+
+// RegisterFlags adds flags configuring the default logger to fs, or to
+// flag.CommandLine when fs is nil, as glog does:
+//
+//	-log_level      the most verbose level logged, e.g. INFO
+//	-log_dir        the directory of the log file
+//	-log_format     text, json or console, for the console and the file
+//	-log_to_stderr  log to stderr instead of stdout and the file
+//
+// The flags take effect as they are parsed. Call it before fs.Parse:
+//
+//	kslog.RegisterFlags(nil)
+//	flag.Parse()
+func RegisterFlags(fs *flag.FlagSet) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	toStderr := &stderrFlag{}
+	fs.Var(levelFlag{}, "log_level", "most verbose `level` logged, EMERGE to DEBUG2")
+	fs.Var(&dirFlag{toStderr: toStderr}, "log_dir", "`directory` of the log file")
+	fs.Var(&formatFlag{}, "log_format", "log `format`: text, json or console")
+	fs.Var(toStderr, "log_to_stderr", "log to stderr instead of stdout and the log file")
+}
+
+type levelFlag struct{}
+
+func (levelFlag) String() string {
+	return GetLevel().String()
+}
+
+func (levelFlag) Set(s string) error {
+	level, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	SetLevel(level)
+	return nil
+}
+
+type dirFlag struct {
+	dir      string
+	toStderr *stderrFlag
+}
+
+func (this *dirFlag) String() string {
+	return this.dir
+}
+
+func (this *dirFlag) Set(s string) error {
+	this.dir = s
+	config := defaultFileConfig()
+	config.Dir = s
+	logging.mu.RLock()
+	if logging.file != nil {
+		if fs, ok := logging.file.sink.(*fileSink); ok {
+			config.Format = fs.format
+		}
+	}
+	logging.mu.RUnlock()
+	// Like the default file, the new one is only created once the first
+	// record is written.
+	logging.setFile(newFileSink(config))
+	if this.toStderr.on {
+		logging.setToStderr(true)
+	}
+	return nil
+}
+
+type formatFlag struct {
+	format string
+}
+
+func (this *formatFlag) String() string {
+	return this.format
+}
+
+func (this *formatFlag) Set(s string) error {
+	format, err := parseFormat(s)
+	if err != nil {
+		return err
+	}
+	this.format = s
+	logging.setFormat(format)
+	return nil
+}
+
+type stderrFlag struct {
+	on bool
+}
+
+func (this *stderrFlag) String() string {
+	return strconv.FormatBool(this.on)
+}
+
+func (this *stderrFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (this *stderrFlag) Set(s string) error {
+	on, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	this.on = on
+	logging.setToStderr(on)
+	return nil
+}
@@ -0,0 +1,179 @@
+package kslog
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"time"
+)
+
+const fluentAckTimeout = 10 * time.Second
+
+// FluentSinkConfig configures a FluentSink.
+type FluentSinkConfig struct {
+	// Addr is the host:port of the fluentd/fluent-bit forward input.
+	Addr string
+	// Tag defaults to the program name.
+	Tag string
+	// TLS, when set, connects with TLS (fluentd's secure forward).
+	TLS *tls.Config
+	// RequireAck waits for the server to acknowledge every chunk.
+	RequireAck bool
+	// WriteTimeout is how long sending a batch may take before the
+	// connection is given up and the batch retried, default 10 seconds.
+	WriteTimeout time.Duration
+	// BatchSize, FlushInterval and MaxRetries default to 100, 1s and 3;
+	// see NoRetries and RetryForever.
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+}
+
+// FluentSink sends records to fluentd or fluent-bit using the forward
+// protocol, one Forward mode message per batch.
+type FluentSink struct {
+	config FluentSinkConfig
+	conn   net.Conn
+	reader *bufio.Reader
+	batch  *batcher
+}
+
+// NewFluentSink returns a sink forwarding to config.Addr.
+func NewFluentSink(config FluentSinkConfig) *FluentSink {
+	if config.Tag == "" {
+		config.Tag = getProgram()
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = netWriteTimeout
+	}
+
+	s := &FluentSink{config: config}
+	s.batch = newBatcher(config.BatchSize, config.FlushInterval, config.MaxRetries, s.flush, nil)
+	return s
+}
+
+func (this *FluentSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *FluentSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *FluentSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close sends what is still pending and closes the connection.
+func (this *FluentSink) Close() error {
+	this.batch.close()
+	if this.conn != nil {
+		return this.conn.Close()
+	}
+	return nil
+}
+
+func (this *FluentSink) connect() error {
+	var conn net.Conn
+	var err error
+
+	dialer := &net.Dialer{Timeout: netDialTimeout}
+	if this.config.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", this.config.Addr, this.config.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", this.config.Addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	this.conn = conn
+	this.reader = bufio.NewReader(conn)
+	return nil
+}
+
+func (this *FluentSink) disconnect() {
+	this.conn.Close()
+	this.conn = nil
+	this.reader = nil
+}
+
+func (this *FluentSink) flush(records []*Record) error {
+	if this.conn == nil {
+		if err := this.connect(); err != nil {
+			return err
+		}
+	}
+
+	var chunk string
+	if this.config.RequireAck {
+		id := make([]byte, 16)
+		rand.Read(id)
+		chunk = base64.StdEncoding.EncodeToString(id)
+	}
+
+	w := new(msgpackWriter)
+	if chunk != "" {
+		w.writeArrayHeader(3)
+	} else {
+		w.writeArrayHeader(2)
+	}
+	w.writeString(this.config.Tag)
+	w.writeArrayHeader(len(records))
+	for _, r := range records {
+		w.writeArrayHeader(2)
+		w.writeEventTime(r.Time)
+		if r.Security != "" {
+			w.writeMapHeader(8)
+			w.writeString("security")
+			w.writeString(string(r.Security))
+		} else {
+			w.writeMapHeader(7)
+		}
+		w.writeString("level")
+		w.writeString(r.Level.String())
+		w.writeString("module")
+		w.writeString(r.Module)
+		w.writeString("code")
+		w.writeInt(int64(r.Code))
+		w.writeString("file")
+		w.writeString(r.File)
+		w.writeString("line")
+		w.writeInt(int64(r.Line))
+		w.writeString("message")
+		w.writeString(r.Message)
+		w.writeString("args")
+		w.writeValue(r.Args)
+	}
+	if chunk != "" {
+		w.writeMapHeader(1)
+		w.writeString("chunk")
+		w.writeString(chunk)
+	}
+
+	this.conn.SetWriteDeadline(time.Now().Add(this.config.WriteTimeout))
+	if _, err := this.conn.Write(w.bytes()); err != nil {
+		this.disconnect()
+		return err
+	}
+
+	if chunk != "" {
+		this.conn.SetReadDeadline(time.Now().Add(fluentAckTimeout))
+		resp, err := readMsgpackStringMap(this.reader)
+		this.conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			this.disconnect()
+			return err
+		}
+		if resp["ack"] != chunk {
+			this.disconnect()
+			return errors.New("Fluentd acknowledged the wrong chunk")
+		}
+	}
+	return nil
+}
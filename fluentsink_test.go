@@ -0,0 +1,48 @@
+package kslog
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFluentSinkWriteTimeout(t *testing.T) {
+	// A fluentd that accepts connections and never reads from them.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	s := NewFluentSink(FluentSinkConfig{Addr: ln.Addr().String(), BatchSize: 16, WriteTimeout: 100 * time.Millisecond, MaxRetries: 1})
+	// More than the socket buffers hold.
+	big := strings.Repeat("x", 1<<20)
+	for i := 0; i < 16; i++ {
+		s.Write(&Record{Message: big, Level: INFO})
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close blocked on the stalled fluentd")
+	}
+	if s.Dropped() != 16 {
+		t.Errorf("got %d dropped, want the batch given up on", s.Dropped())
+	}
+}
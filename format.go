@@ -0,0 +1,33 @@
+package kslog
+
+import (
+	"fmt"
+)
+
+// Formatter turns a record into the bytes a text sink writes, including
+// the trailing newline.
+type Formatter func(r *Record) []byte
+
+// TextFormatter is the log file format:
+//
+//	<level>: <file>:<line> <code> #<seq> <security> : "<message>" [ key: value ] ...
+//
+// where #<seq> is left out for records without a sequence number, and
+// <security> for records that aren't security events.
+func TextFormatter(r *Record) []byte {
+	return []byte(fileLine(r))
+}
+
+// ConsoleFormatter is the column aligned format used on the console.
+func ConsoleFormatter(r *Record) []byte {
+	s := fmt.Sprintf("%d: %s:%d %d", r.Level, r.File, r.Line, r.Code)
+	if r.Security != "" {
+		s += " " + string(r.Security)
+	}
+	return []byte(fmt.Sprintf("%-30s : %s %s\n", s, r.Message, map2str(r.Args)))
+}
+
+// JSONFormatter writes one JSON object per line.
+func JSONFormatter(r *Record) []byte {
+	return append(encodeJSON(r), '\n')
+}
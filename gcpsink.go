@@ -0,0 +1,228 @@
+package kslog
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gcpMetadataURL = "http://metadata.google.internal/computeMetadata/v1/"
+	gcpWriteURL    = "https://logging.googleapis.com/v2/entries:write"
+)
+
+var gcpSeverities = [MAXLEVEL]string{
+	"EMERGENCY",
+	"ALERT",
+	"CRITICAL",
+	"ERROR",
+	"WARNING",
+	"NOTICE",
+	"INFO",
+	"DEBUG",
+	"DEBUG",
+}
+
+// GCPSinkConfig configures a GCPSink.
+type GCPSinkConfig struct {
+	// ProjectID defaults to the project of the GCE/GKE metadata server.
+	ProjectID string
+	// LogID defaults to the program name.
+	LogID string
+	// ResourceType and ResourceLabels describe the monitored resource,
+	// e.g. "k8s_container" with project_id, location, cluster_name,
+	// namespace_name, pod_name and container_name. The default is "global".
+	ResourceType   string
+	ResourceLabels map[string]string
+	// Labels are attached to every entry.
+	Labels map[string]string
+	// Token returns an OAuth2 access token; it defaults to the service
+	// account token of the metadata server.
+	Token func() (string, error)
+	// BatchSize, FlushInterval and MaxRetries default to 100, 1s and 3;
+	// see NoRetries and RetryForever.
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+}
+
+// GCPSink writes records to Google Cloud Logging as structured entries,
+// mapping levels to Cloud Logging severities.
+type GCPSink struct {
+	config GCPSinkConfig
+	client *http.Client
+	batch  *batcher
+}
+
+type gcpEntry struct {
+	Timestamp      string                 `json:"timestamp"`
+	Severity       string                 `json:"severity"`
+	JSONPayload    map[string]interface{} `json:"jsonPayload"`
+	SourceLocation map[string]interface{} `json:"sourceLocation"`
+}
+
+// NewGCPSink returns a sink writing to Cloud Logging. It fails when no
+// project was given and none can be read from the metadata server.
+func NewGCPSink(config GCPSinkConfig) (*GCPSink, error) {
+	client := newHTTPClient(nil)
+
+	if config.ProjectID == "" {
+		project, err := gcpMetadata(client, "project/project-id")
+		if err != nil {
+			return nil, err
+		}
+		config.ProjectID = project
+	}
+	if config.LogID == "" {
+		config.LogID = getProgram()
+	}
+	if config.ResourceType == "" {
+		config.ResourceType = "global"
+		config.ResourceLabels = map[string]string{"project_id": config.ProjectID}
+	}
+	if config.Token == nil {
+		config.Token = gcpMetadataToken(client)
+	}
+
+	s := &GCPSink{
+		config: config,
+		client: client,
+	}
+	s.batch = newBatcher(config.BatchSize, config.FlushInterval, config.MaxRetries, s.flush, nil)
+	return s, nil
+}
+
+func gcpMetadata(client *http.Client, path string) (string, error) {
+	req, err := http.NewRequest("GET", gcpMetadataURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := httpStatusError(resp); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	return strings.TrimSpace(string(data)), err
+}
+
+// gcpMetadataToken returns a token function caching the metadata server's
+// service account token until shortly before it expires.
+func gcpMetadataToken(client *http.Client) func() (string, error) {
+	var mu sync.Mutex
+	var token string
+	var expiry time.Time
+
+	return func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if token != "" && time.Now().Before(expiry) {
+			return token, nil
+		}
+
+		data, err := gcpMetadata(client, "instance/service-accounts/default/token")
+		if err != nil {
+			return "", err
+		}
+		var resp struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}
+		if err := json.Unmarshal([]byte(data), &resp); err != nil {
+			return "", err
+		}
+		if resp.AccessToken == "" {
+			return "", errors.New("Metadata server returned no access token")
+		}
+
+		token = resp.AccessToken
+		expiry = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+		return token, nil
+	}
+}
+
+func gcpSeverity(level Level) string {
+	if level < MAXLEVEL {
+		return gcpSeverities[level]
+	}
+	return "DEFAULT"
+}
+
+func (this *GCPSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *GCPSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *GCPSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close sends what is still pending and stops the sink.
+func (this *GCPSink) Close() error {
+	this.batch.close()
+	return nil
+}
+
+func (this *GCPSink) flush(records []*Record) error {
+	entries := make([]gcpEntry, len(records))
+	for i, r := range records {
+		payload := map[string]interface{}{
+			"message": r.Message,
+			"module":  r.Module,
+			"code":    r.Code,
+		}
+		if len(r.Args) > 0 {
+			payload["args"] = jsonArgs(r.Args)
+		}
+		entries[i] = gcpEntry{
+			Timestamp:      r.Time.UTC().Format(time.RFC3339Nano),
+			Severity:       gcpSeverity(r.Level),
+			JSONPayload:    payload,
+			SourceLocation: map[string]interface{}{"file": r.File, "line": r.Line},
+		}
+	}
+
+	write := map[string]interface{}{
+		"logName":  "projects/" + this.config.ProjectID + "/logs/" + this.config.LogID,
+		"resource": map[string]interface{}{"type": this.config.ResourceType, "labels": this.config.ResourceLabels},
+		"entries":  entries,
+	}
+	if len(this.config.Labels) > 0 {
+		write["labels"] = this.config.Labels
+	}
+
+	body, err := json.Marshal(write)
+	if err != nil {
+		for i, r := range records {
+			if len(r.Args) > 0 {
+				entries[i].JSONPayload["args"] = stringArgs(r.Args)
+			}
+		}
+		if body, err = json.Marshal(write); err != nil {
+			return permanentError{err}
+		}
+	}
+
+	token, err := this.config.Token()
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	return postHTTP(this.client, gcpWriteURL, "application/json", header, body, false)
+}
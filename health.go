@@ -0,0 +1,53 @@
+package kslog
+
+import "time"
+
+// HealthReport describes the state of a logger's pipeline, see Health.
+type HealthReport struct {
+	// QueueDepth is how many records are queued for the sink goroutine,
+	// out of QueueSize; HighWater is the most there ever were.
+	QueueDepth int
+	QueueSize  int
+	HighWater  int
+	// Lag is how long ago the oldest record not written yet was logged,
+	// zero when the sink goroutine has caught up.
+	Lag   time.Duration
+	Sinks []SinkHealth
+}
+
+// SinkHealth is the state of one attached sink.
+type SinkHealth struct {
+	Sink Sink
+	// LastError is the last error the sink returned, at LastErrorTime.
+	LastError     error
+	LastErrorTime time.Time
+}
+
+// Health returns the state of the logger's pipeline, for services to
+// include in their readiness probes.
+func (this *logger) Health() HealthReport {
+	h := HealthReport{
+		QueueDepth: this.queue.len(),
+		QueueSize:  this.queue.size(),
+		HighWater:  int(this.highWater.Load()),
+	}
+	if taken := this.taken.Load(); taken != 0 {
+		h.Lag = this.now().Sub(time.Unix(0, taken))
+	}
+
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	for _, e := range this.sinks {
+		sh := SinkHealth{Sink: e.sink}
+		if last := e.lastError.Load(); last != nil {
+			sh.LastError, sh.LastErrorTime = last.err, last.time
+		}
+		h.Sinks = append(h.Sinks, sh)
+	}
+	return h
+}
+
+// Health returns the state of the default logger's pipeline.
+func Health() HealthReport {
+	return logging.Health()
+}
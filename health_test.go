@@ -0,0 +1,30 @@
+package kslog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthLag(t *testing.T) {
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	sink := &blockingSink{entered: make(chan struct{}), release: make(chan struct{})}
+	entered, release := sink.entered, sink.release
+	l.AddSink(sink)
+	clock := &testClock{t: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l.SetClock(clock)
+
+	module := "test"
+	l.printf(INFO, &module, 0, "stuck")
+	<-entered
+	clock.add(5 * time.Second)
+	if lag := l.Health().Lag; lag != 5*time.Second {
+		t.Errorf("got lag %v, want 5s", lag)
+	}
+
+	close(release)
+	l.Flush()
+	if lag := l.Health().Lag; lag != 0 {
+		t.Errorf("got lag %v after Flush, want 0", lag)
+	}
+}
@@ -0,0 +1,79 @@
+package kslog
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Hook sees every record before the sinks do, and returns the record to
+// write: r itself, changed or not, another record, or nil to drop it.
+type Hook func(r *Record) *Record
+
+// hooks are the hooks of a logger, replaced as a whole when one is added.
+type hooks struct {
+	list atomic.Pointer[[]Hook]
+	mu   sync.Mutex
+}
+
+// RegisterHook adds hook to those records go through before the sinks, in
+// the order they were registered, e.g. to enrich records with fields:
+//
+//	kslog.RegisterHook(func(r *kslog.Record) *kslog.Record {
+//		r.Args["region"] = region
+//		return r
+//	})
+//
+// Hooks run on the goroutine writing records, after typed fields were
+// moved to Args; they must not log, nor keep r past their return. The
+// record they return is redacted, scrubbed and sanitized again, so what
+// they add doesn't get around SetRedactKeys, AddScrubber and sanitizing.
+func (this *logger) RegisterHook(hook Hook) {
+	this.hooks.mu.Lock()
+	defer this.hooks.mu.Unlock()
+
+	var list []Hook
+	if old := this.hooks.list.Load(); old != nil {
+		list = append(list, *old...)
+	}
+	list = append(list, hook)
+	this.hooks.list.Store(&list)
+}
+
+// ClearHooks removes the hooks.
+func (this *logger) ClearHooks() {
+	this.hooks.list.Store(nil)
+}
+
+// RegisterHook adds a hook to the default logger.
+func RegisterHook(hook Hook) {
+	logging.RegisterHook(hook)
+}
+
+// ClearHooks removes the hooks of the default logger.
+func ClearHooks() {
+	logging.ClearHooks()
+}
+
+// runHooks runs r through the hooks, returning the record to write, or
+// nil. r is released if it isn't the record returned.
+func (this *logger) runHooks(r *Record) *Record {
+	list := this.hooks.list.Load()
+	if list == nil {
+		return r
+	}
+	out := r
+	for _, hook := range *list {
+		if out = hook(out); out == nil {
+			break
+		}
+	}
+	if out != r {
+		releaseRecord(r)
+	}
+	if out != nil {
+		redactRecord(out)
+		scrubRecord(out)
+		sanitizeRecord(out)
+	}
+	return out
+}
@@ -0,0 +1,30 @@
+package kslog
+
+import "testing"
+
+func TestHookRedacted(t *testing.T) {
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	sink := new(recordSink)
+	l.AddSink(sink)
+	AddScrubber(ScrubEmails)
+	defer ClearScrubbers()
+	l.RegisterHook(func(r *Record) *Record {
+		r.Message += " for jane.doe@example.com"
+		r.Args["password"] = "hunter2"
+		r.Args["note"] = "two\nlines"
+		return r
+	})
+
+	module := "test"
+	l.printf(INFO, &module, 1, "login")
+	l.Flush()
+
+	if len(sink.records) != 1 {
+		t.Fatalf("got %d records, want 1", len(sink.records))
+	}
+	r := sink.records[0]
+	if r.Message != "login for j***@example.com" || r.Args["password"] != Redacted || r.Args["note"] != `two\nlines` {
+		t.Errorf("got %q %v", r.Message, r.Args)
+	}
+}
@@ -0,0 +1,153 @@
+package kslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPSinkConfig configures an HTTPSink.
+type HTTPSinkConfig struct {
+	// URL is the endpoint batches are POSTed to.
+	URL string
+	// NDJSON sends one JSON object per line instead of a JSON array.
+	NDJSON bool
+	// Gzip compresses request bodies.
+	Gzip bool
+	// Header is added to every request, e.g. for Authorization.
+	Header http.Header
+	// TLS is used for https endpoints; see TLSConfig.
+	TLS *tls.Config
+	// BatchSize, FlushInterval and MaxRetries default to 100, 1s and 3;
+	// see NoRetries and RetryForever.
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+}
+
+// HTTPSink batches records and POSTs them as JSON to an HTTP endpoint.
+// Network errors, 429 and 5xx responses are retried with backoff.
+type HTTPSink struct {
+	config HTTPSinkConfig
+	client *http.Client
+	batch  *batcher
+}
+
+// NewHTTPSink returns a sink pushing to config.URL.
+func NewHTTPSink(config HTTPSinkConfig) *HTTPSink {
+	s := &HTTPSink{
+		config: config,
+		client: newHTTPClient(config.TLS),
+	}
+	s.batch = newBatcher(config.BatchSize, config.FlushInterval, config.MaxRetries, s.flush, nil)
+	return s
+}
+
+func newHTTPClient(config *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config},
+	}
+}
+
+func (this *HTTPSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *HTTPSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *HTTPSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close sends what is still pending and stops the sink.
+func (this *HTTPSink) Close() error {
+	this.batch.close()
+	return nil
+}
+
+func (this *HTTPSink) flush(records []*Record) error {
+	buf := new(bytes.Buffer)
+	if this.config.NDJSON {
+		for _, r := range records {
+			buf.Write(encodeJSON(r))
+			buf.WriteByte('\n')
+		}
+	} else {
+		buf.WriteByte('[')
+		for i, r := range records {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(encodeJSON(r))
+		}
+		buf.WriteByte(']')
+	}
+
+	contentType := "application/json"
+	if this.config.NDJSON {
+		contentType = "application/x-ndjson"
+	}
+	return postHTTP(this.client, this.config.URL, contentType, this.config.Header, buf.Bytes(), this.config.Gzip)
+}
+
+// postHTTP POSTs body to url, returning a permanentError for responses
+// that are not worth retrying.
+func postHTTP(client *http.Client, url, contentType string, header http.Header, body []byte, compress bool) error {
+	if compress {
+		buf := new(bytes.Buffer)
+		zw := gzip.NewWriter(buf)
+		zw.Write(body)
+		zw.Close()
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return httpStatusError(resp)
+}
+
+// httpStatusError maps a response status to nil, a retryable error
+// (429 and 5xx) or a permanentError. A Retry-After header in seconds is
+// passed on to the batcher as a retryAfterError.
+func httpStatusError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	err := fmt.Errorf("%s: %s", resp.Request.URL, resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		if secs, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil && secs > 0 {
+			return retryAfterError{err, time.Duration(secs) * time.Second}
+		}
+		return err
+	}
+	return permanentError{err}
+}
@@ -0,0 +1,113 @@
+package kslog
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+type jsonRecord struct {
+	Time     time.Time              `json:"time"`
+	Seq      uint64                 `json:"seq,omitempty"`
+	Program  string                 `json:"program"`
+	Level    string                 `json:"level"`
+	Module   string                 `json:"module"`
+	Code     int32                  `json:"code"`
+	File     string                 `json:"file"`
+	Line     int                    `json:"line"`
+	Message  string                 `json:"message"`
+	Security SecurityCategory       `json:"security,omitempty"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+}
+
+// encodeJSON encodes r as a single JSON object. Errors are written as
+// their text, see jsonArgs, and arguments that can't be marshaled in their
+// fmt %v form.
+func encodeJSON(r *Record) []byte {
+	jr := jsonRecord{
+		Time:     r.Time,
+		Seq:      r.Seq,
+		Program:  getProgram(),
+		Level:    r.Level.String(),
+		Module:   r.Module,
+		Code:     r.Code,
+		File:     r.File,
+		Line:     r.Line,
+		Message:  r.Message,
+		Security: r.Security,
+		Args:     jsonArgs(r.Args),
+	}
+
+	out, err := json.Marshal(&jr)
+	if err != nil {
+		notifyError(fmt.Errorf("Encoding record: %w", err))
+		jr.Args = stringArgs(r.Args)
+		out, _ = json.Marshal(&jr)
+	}
+	return out
+}
+
+// stringArgs returns args with every value in its fmt %v form, for
+// encoders that failed on the original values.
+func stringArgs(args map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		out[k] = fmt.Sprintf("%v", v)
+	}
+	return out
+}
+
+// encodeJSONArgs encodes args as a JSON object, falling back to
+// stringArgs like encodeJSON.
+func encodeJSONArgs(args map[string]interface{}) []byte {
+	out, err := json.Marshal(jsonArgs(args))
+	if err != nil {
+		notifyError(fmt.Errorf("Encoding arguments: %w", err))
+		out, _ = json.Marshal(stringArgs(args))
+	}
+	return out
+}
+
+// jsonArgs returns args with the values JSON would lose as text: errors,
+// which mostly have no exported fields and would be written as {}, and
+// fmt.Stringer structs. Values that marshal themselves are kept, as are
+// Stringers of other kinds, like time.Duration, written as numbers.
+func jsonArgs(args map[string]interface{}) map[string]interface{} {
+	var out map[string]interface{}
+	for k, v := range args {
+		if !asText(v) {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]interface{}, len(args))
+			for k, v := range args {
+				out[k] = v
+			}
+		}
+		// fmt recovers from methods panicking on nil receivers.
+		out[k] = fmt.Sprint(v)
+	}
+	if out == nil {
+		return args
+	}
+	return out
+}
+
+// asText tells whether jsonArgs writes v as text.
+func asText(v interface{}) bool {
+	switch v.(type) {
+	case json.Marshaler, encoding.TextMarshaler:
+		return false
+	case error:
+		return true
+	case fmt.Stringer:
+		t := reflect.TypeOf(v)
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		return t.Kind() == reflect.Struct
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package kslog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type point struct{ x, y int }
+
+func (p point) String() string { return fmt.Sprintf("(%d,%d)", p.x, p.y) }
+
+func TestJSONArgs(t *testing.T) {
+	err := errors.New("boom")
+	var nilErr *wrapError
+	r := &Record{Message: "m", Level: ERROR, Args: map[string]interface{}{
+		"error":    err,
+		"wrapped":  fmt.Errorf("saving: %w", err),
+		"nil":      nilErr,
+		"duration": 1500 * time.Millisecond,
+		"time":     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"point":    point{1, 2},
+		"n":        3,
+	}}
+	out := string(JSONFormatter(r))
+	want := `"args":{"duration":1500000000,"error":"boom","n":3,"nil":"\u003cnil\u003e","point":"(1,2)","time":"2024-01-02T03:04:05Z","wrapped":"saving: boom"}`
+	if !strings.Contains(out, want) {
+		t.Errorf("got %s, want it to contain %s", out, want)
+	}
+	if _, ok := r.Args["error"].(error); !ok {
+		t.Error("the record's arguments were changed")
+	}
+
+	if out := string(encodeJSONArgs(r.Args)); !strings.Contains(out, `"error":"boom"`) {
+		t.Errorf("got %s", out)
+	}
+}
+
+type wrapError struct{ err error }
+
+func (e *wrapError) Error() string { return "wrap: " + e.err.Error() }
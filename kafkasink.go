@@ -0,0 +1,101 @@
+package kslog
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// How KafkaSink keys its messages, which decides their partition.
+const (
+	KafkaPartitionNone = iota
+	KafkaPartitionByModule
+	KafkaPartitionByCode
+)
+
+// KafkaMessage is a single message handed to a KafkaProducer.
+type KafkaMessage struct {
+	Key   []byte
+	Value []byte
+}
+
+// KafkaProducer is the part of a Kafka client KafkaSink needs. kslog does
+// not pull in a Kafka client itself; adapting sarama's SyncProducer or
+// kafka-go's Writer takes a few lines.
+type KafkaProducer interface {
+	Produce(topic string, msgs []KafkaMessage) error
+}
+
+// KafkaSinkConfig configures a KafkaSink.
+type KafkaSinkConfig struct {
+	Producer KafkaProducer
+	Topic    string
+	// PartitionBy is one of the KafkaPartition constants.
+	PartitionBy int
+	// BatchSize, FlushInterval and MaxRetries default to 100, 1s and 3;
+	// see NoRetries and RetryForever.
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+	// OnFailure, if set, is called with records that could not be delivered.
+	OnFailure func(records []*Record, err error)
+}
+
+// KafkaSink publishes JSON encoded records to a Kafka topic in batches.
+type KafkaSink struct {
+	config KafkaSinkConfig
+	batch  *batcher
+}
+
+// NewKafkaSink returns a sink producing to config.Topic with
+// config.Producer, both of which must be set.
+func NewKafkaSink(config KafkaSinkConfig) (*KafkaSink, error) {
+	if config.Producer == nil {
+		return nil, errors.New("Kafka sink without a producer")
+	}
+	if config.Topic == "" {
+		return nil, errors.New("Kafka sink without a topic")
+	}
+
+	s := &KafkaSink{config: config}
+	s.batch = newBatcher(config.BatchSize, config.FlushInterval, config.MaxRetries, s.flush, config.OnFailure)
+	return s, nil
+}
+
+func (this *KafkaSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *KafkaSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *KafkaSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close sends what is still pending and stops the sink.
+func (this *KafkaSink) Close() error {
+	this.batch.close()
+	return nil
+}
+
+func (this *KafkaSink) key(r *Record) []byte {
+	switch this.config.PartitionBy {
+	case KafkaPartitionByModule:
+		return []byte(r.Module)
+	case KafkaPartitionByCode:
+		return []byte(strconv.Itoa(int(r.Code)))
+	}
+	return nil
+}
+
+func (this *KafkaSink) flush(records []*Record) error {
+	msgs := make([]KafkaMessage, len(records))
+	for i, r := range records {
+		msgs[i] = KafkaMessage{Key: this.key(r), Value: encodeJSON(r)}
+	}
+	return this.config.Producer.Produce(this.config.Topic, msgs)
+}
@@ -0,0 +1,38 @@
+package kslog
+
+import (
+	"sync"
+	"testing"
+)
+
+type testProducer struct {
+	mu   sync.Mutex
+	msgs []KafkaMessage
+}
+
+func (this *testProducer) Produce(topic string, msgs []KafkaMessage) error {
+	this.mu.Lock()
+	this.msgs = append(this.msgs, msgs...)
+	this.mu.Unlock()
+	return nil
+}
+
+func TestKafkaSinkConfig(t *testing.T) {
+	if _, err := NewKafkaSink(KafkaSinkConfig{Topic: "logs"}); err == nil {
+		t.Error("accepted a config without a producer")
+	}
+	if _, err := NewKafkaSink(KafkaSinkConfig{Producer: new(testProducer)}); err == nil {
+		t.Error("accepted a config without a topic")
+	}
+
+	producer := new(testProducer)
+	s, err := NewKafkaSink(KafkaSinkConfig{Producer: producer, Topic: "logs", PartitionBy: KafkaPartitionByModule})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write(&Record{Module: "db", Message: "x"})
+	s.Close()
+	if len(producer.msgs) != 1 || string(producer.msgs[0].Key) != "db" {
+		t.Errorf("got %+v", producer.msgs)
+	}
+}
@@ -2,22 +2,24 @@ package kslog
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"path"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var logging = NewLogger()
+var logging = newDefaultLogger()
 
-type loglevel uint8
+type Level uint8
 
 const (
-	EMERGE loglevel = iota
+	EMERGE Level = iota
 	ALERT
 	CRIT
 	ERROR
@@ -29,34 +31,272 @@ const (
 	MAXLEVEL = 9
 )
 
+var levelNames = [MAXLEVEL]string{
+	"EMERGE",
+	"ALERT",
+	"CRIT",
+	"ERROR",
+	"WARNING",
+	"NOTICE",
+	"INFO",
+	"DEBUG",
+	"DEBUG2",
+}
+
+// LevelPtr returns a pointer to l, for the levels of configs that are
+// optional, like FileSinkConfig.FlushLevel, where nil stands for the
+// default.
+func LevelPtr(l Level) *Level {
+	return &l
+}
+
+func (l Level) String() string {
+	if l < MAXLEVEL {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("LEVEL%d", l)
+}
+
+// ParseLevel returns the level named s, in any case, or given by its
+// number; WARN is accepted for WARNING.
+func ParseLevel(s string) (Level, error) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+	if name == "WARN" {
+		return WARNING, nil
+	}
+	for l, n := range levelNames {
+		if n == name {
+			return Level(l), nil
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 0 && n < MAXLEVEL {
+		return Level(n), nil
+	}
+	return 0, fmt.Errorf("Unknown log level %q", s)
+}
+
 type logger struct {
-	sink  chan *logItem
-	level loglevel
-	file  *os.File
+	queue queue
+	// level is the most verbose level logged, see SetLevel, and modules
+	// the levels of modules set apart, see SetModuleLevel.
+	level     int32
+	modules   atomic.Pointer[moduleLevels]
+	modulesMu sync.Mutex
+	mu        sync.RWMutex
+	sinks     []*sinkEntry
+	// fallback receives records a sink failed to write or gave up on
+	// sending; it is guarded by fallbackMu, not mu, since sinks give up on
+	// records from their own goroutines, even while mu is held to close
+	// them.
+	fallback   Sink
+	fallbackMu sync.Mutex
+	// console is the default console sink, attached or not.
+	console *sinkEntry
+	// file is the default file sink, nil if there is none.
+	file *sinkEntry
+	// verbosest is the most verbose level any sink accepts, or -1
+	// without sinks; records beyond it are not even built.
+	verbosest int32
+	// securitySinks counts the security sinks, see AddSecuritySink.
+	securitySinks atomic.Int32
+	// backpressure is the policy of each level for a full queue. kept
+	// counts the queued records BackpressureDropOldest may not drop, see
+	// pushKept.
+	backpressure [MAXLEVEL]int32
+	kept         atomic.Int64
+	keeping      sync.RWMutex
+	// emitted and dropped count records by level for Stats.
+	emitted [MAXLEVEL]atomic.Uint64
+	dropped [MAXLEVEL]atomic.Uint64
+	sampler sampler
+	sampled [MAXLEVEL]atomic.Uint64
+	limiter rateLimiter
+	limited [MAXLEVEL]atomic.Uint64
+	dedup   dedup
+	// closed is set by Shutdown.
+	closed bool
+	// sync is set in synchronous mode; writing serializes handing records
+	// to the sinks between the sink goroutine and synchronous calls.
+	sync    atomic.Bool
+	writing sync.Mutex
+	// noCaller is set when SetCaller turned caller lookup off.
+	noCaller atomic.Bool
+	// seq is the sequence number of the last record.
+	seq atomic.Uint64
+	// highWater is the most records queued at once, and taken the time
+	// of the record the sink goroutine took last, zero once the queue is
+	// drained.
+	highWater atomic.Int64
+	taken     atomic.Int64
+	// bump is the level change of BumpLevelOnSignal.
+	bump levelBump
+	// metrics counts records by module and code, see MetricsHandler.
+	metrics metrics
+	// filter is the module filter, see SetModuleFilter.
+	filter atomic.Pointer[moduleFilter]
+	// codeRules are the levels and routes of code ranges, see
+	// SetCodeLevel and RouteCodes.
+	codeRules   atomic.Pointer[codeRules]
+	codeRulesMu sync.Mutex
+	// clock stamps records, nil for the system clock, see SetClock.
+	clock atomic.Pointer[Clock]
+	// audit is the audit trail, see Audit.
+	audit auditLog
+	// alerts are the alert rules, see AddAlert.
+	alerts alerts
+	// hooks are the hooks of RegisterHook.
+	hooks hooks
+	// traces are the records kept for trace on error, see
+	// EnableTraceOnError.
+	traces atomic.Pointer[traceBuffer]
+	// escalations are the rules of AddEscalation.
+	escalations escalations
 }
 
+type sinkEntry struct {
+	sink  Sink
+	level Level
+	// disabled is set by SetSinkEnabled; it is guarded by mu.
+	disabled bool
+	// security is set for sinks of security events of categories, see
+	// AddSecuritySink.
+	security   bool
+	categories []SecurityCategory
+	// owned is set for the sinks the logger opened itself, the default
+	// and configured ones, which ApplyConfig replaces.
+	owned    bool
+	failures atomic.Uint64
+	// lastError is the sink's last failure, for Health.
+	lastError atomic.Pointer[sinkError]
+}
+
+// sinkError is an error a sink returned and when.
+type sinkError struct {
+	err  error
+	time time.Time
+}
+
+// failed counts a failure of the sink and reports it to the error
+// handler.
+func (this *sinkEntry) failed(err error) {
+	this.failures.Add(1)
+	this.lastError.Store(&sinkError{err, time.Now()})
+	notifyError(fmt.Errorf("Sink %T: %w", this.sink, err))
+}
+
+// Sink is a destination the sink goroutine, or in synchronous mode the
+// logging call, hands every record to. A sink's methods are never called
+// concurrently. Records are reused after Write returns; a sink that keeps
+// one keeps its Clone.
+type Sink interface {
+	Write(r *Record) error
+	Close() error
+}
+
+// BatchSink is a Sink that may hold the records it is written until
+// EndBatch, which the sink goroutine calls whenever it has drained the
+// queue, and at least every 256 records.
+type BatchSink interface {
+	Sink
+	EndBatch() error
+}
+
+// defaultQueueSize is how many records a logger queues for its sink
+// goroutine by default.
+const defaultQueueSize = 1000
+
 func NewLogger() *logger {
-	var err error = nil
+	return NewLoggerQueue(defaultQueueSize)
+}
 
-	l := new(logger)
-	l.sink = make(chan *logItem, 1000)
-	l.level = DEBUG2
+// NewLoggerQueue returns a logger like NewLogger that queues up to size
+// records for its sinks. A bigger queue absorbs bursts at the cost of
+// memory; with size 0 every logging call waits for the sink goroutine to
+// take its record.
+func NewLoggerQueue(size int) *logger {
+	return withDefaultSinks(newLogger(newChanQueue(size)))
+}
 
-	name := logName(time.Now())
-	logpath := "/var/log/kslog/" + getProgram()
-	os.MkdirAll(logpath, 770)
+// NewLoggerRing returns a logger like NewLoggerQueue that queues records
+// on a lock-free ring instead of a channel, for services logging from
+// many goroutines at once: they then don't contend on a lock to queue
+// their records. The ring holds size records rounded up to a power of
+// two, at least 2. What it had to drop shows in Stats.
+func NewLoggerRing(size int) *logger {
+	return withDefaultSinks(newLogger(newRingQueue(size)))
+}
 
-	l.file, err = os.Create(logpath + "/" + name)
-	if err != nil {
-		fmt.Println("Error oppening file for logging", err)
+// systemSinkLevel is the most verbose level the system sinks get, so that
+// DEBUG records don't flood e.g. the windows event log.
+const systemSinkLevel = WARNING
+
+// withDefaultSinks gives l the default console and file sinks and the
+// system sinks.
+func withDefaultSinks(l *logger) *logger {
+	l.console = &sinkEntry{sink: &consoleSink{w: os.Stdout, format: ConsoleFormatter}, level: DEBUG2}
+	l.sinks = append(l.sinks, l.console)
+
+	// The log file is only created once the first record is written.
+	l.file = &sinkEntry{sink: newFileSink(defaultFileConfig()), level: DEBUG2, owned: true}
+	l.sinks = append(l.sinks, l.file)
+
+	for _, s := range systemSinks() {
+		l.setFallbackOf(s)
+		l.sinks = append(l.sinks, &sinkEntry{sink: s, level: systemSinkLevel, owned: true})
+	}
+	l.updateVerbosest()
+
+	return l
+}
+
+// NewDiscardLogger returns a logger without any sinks: calls are filtered
+// out before a record is even built, and nothing touches the disk or the
+// console. Sinks can still be added later.
+func NewDiscardLogger() *logger {
+	return newLogger(newChanQueue(defaultQueueSize))
+}
+
+// Discard detaches and closes all sinks of the default logger, including
+// its console. Call it before logging to avoid creating the log file.
+func Discard() {
+	logging.SetConsole(ConsoleOff)
+	logging.ResetSinks()
+}
+
+func newChanQueue(size int) queue {
+	if size < 0 {
+		size = 0
 	}
+	return make(chanQueue, size)
+}
+
+func newLogger(q queue) *logger {
+	l := new(logger)
+	l.queue = q
+	l.level = int32(DEBUG2)
+	l.verbosest = -1
+	l.fallback = &writerSink{w: os.Stderr, format: TextFormatter}
 
 	go l.sinkLoop()
 
 	return l
 }
 
+// programName is the program name set by SetProgramName.
+var programName atomic.Pointer[string]
+
+// SetProgramName sets the program name log files and records are named
+// and tagged with, in place of the base name of os.Args[0], for processes
+// started through wrappers or with a changed argv. Call it before the
+// first record is logged.
+func SetProgramName(name string) {
+	programName.Store(&name)
+}
+
 func getProgram() string {
+	if name := programName.Load(); name != nil {
+		return *name
+	}
 	progpath := os.Args[0]
 	progpath = strings.Replace(progpath, "\\", "/", -1)
 	program := path.Base(progpath)
@@ -64,121 +304,817 @@ func getProgram() string {
 	return program
 }
 
-func logName(t time.Time) string {
-	name := fmt.Sprintf("%s.log.%04d%02d%02d-%02d%02d%02d.%d",
-		getProgram(),
-		t.Year(),
-		t.Month(),
-		t.Day(),
-		t.Hour(),
-		t.Minute(),
-		t.Second(),
-		os.Getpid())
-	return name
+// Record is a single log entry as handed to the sinks.
+type Record struct {
+	Message string
+	Args    map[string]interface{}
+	Level   Level
+	Line    int
+	File    string
+	Module  string
+	Code    int32
+	Time    time.Time
+	// Seq numbers the records of a logger in the order they were logged,
+	// from 1 on, so that readers can tell records were lost or put
+	// records from several goroutines back in order.
+	Seq uint64
+	// Stack holds the caller's program counters for ERROR and more
+	// severe records, escalated ones included; see
+	// runtime.CallersFrames.
+	Stack []uintptr
+	// Security is the category of a security event, see Security, or
+	// empty.
+	Security SecurityCategory
+
+	// fields are typed fields, moved to Args on the sink goroutine.
+	fields []Field
+	// flushed marks a Flush request rather than a real record, and
+	// repeatsDue a check whether a run of repeated records timed out.
+	flushed    chan struct{}
+	repeatsDue bool
+	// securityOnly marks a security event only security sinks get, as
+	// it was let through for them alone.
+	securityOnly bool
+	// traced marks a record kept for trace on error, which sinks get
+	// whatever their level once it is written.
+	traced bool
+	// keep marks a queued record BackpressureDropOldest may not drop.
+	keep bool
 }
 
-type logItem struct {
-	message *string
-	args    *map[string]interface{}
-	level   loglevel
-	line    int
-	file    *string
-	module  *string
-	code    int32
+// marker reports whether r is a request to the sink goroutine rather than
+// a real record.
+func (r *Record) marker() bool {
+	return r.flushed != nil || r.repeatsDue
 }
 
-func map2str(args *map[string]interface{}) string {
+func map2str(args map[string]interface{}) string {
 	buf := bytes.NewBuffer(nil)
 
-	for k, v := range *args {
+	for k, v := range args {
 		buf.WriteString(fmt.Sprintf("[ %s: %v ] ", k, v))
 	}
 	return buf.String()
 }
 
-func args2map(args ...interface{}) (*map[string]interface{}, error) {
-	argsMap := make(map[string]interface{})
+// badKey is the key of a value given without one, and keyWarning that
+// of what was wrong with a key that wasn't a string.
+const (
+	badKey     = "!BADKEY"
+	keyWarning = "kslog_warning"
+)
+
+// args2map adds the key value pairs of args to argsMap. A struct in
+// place of a key is expanded into its fields, see expandStruct. A last
+// value without a key is added under badKey. A key that isn't a string is
+// used in its fmt.Sprint form, and noted under keyWarning.
+func args2map(argsMap map[string]interface{}, args ...interface{}) {
 	key := "_unknown"
-	if argsLen := len(args); argsLen > 0 {
-		if argsLen%2 != 0 {
-			return nil, errors.New("Bad key value match")
+	for argNum := 0; argNum < len(args); argNum += 2 {
+		arg := args[argNum]
+		if v, ok := structValue(arg); ok {
+			expandStruct(argsMap, "", v, 0)
+			// The struct takes the place of a key value pair.
+			argNum--
+			continue
 		}
-		for argNum := 0; argNum < argsLen; argNum++ {
-			arg := args[argNum]
-			switch argNum % 2 {
-			case 1:
-				argsMap[key] = arg
-			case 0:
-				if arg != nil {
-					if strArg, ok := arg.(string); ok {
-						key = strArg
-					} else {
-						return nil, errors.New("Key is not a string")
-					}
-				}
+		if argNum == len(args)-1 {
+			argsMap[badKey] = arg
+			break
+		}
+		if arg != nil {
+			if strArg, ok := arg.(string); ok {
+				key = strArg
+			} else {
+				key = fmt.Sprint(arg)
+				argsMap[keyWarning] = fmt.Sprintf("Key %s is a %T, not a string", key, arg)
 			}
 		}
+		argsMap[key] = args[argNum+1]
+	}
+}
+
+// callerInfo is where a logging call was made.
+type callerInfo struct {
+	file string
+	line int
+}
+
+// callers caches callerInfo by program counter, as there are few call
+// sites and resolving them for every record is costly. The map is only
+// ever replaced, so reading it takes no lock.
+var (
+	callers   atomic.Pointer[map[uintptr]callerInfo]
+	callersMu sync.Mutex
+)
+
+func getCaller(depth int) (string, int) {
+	var pc [1]uintptr
+	if runtime.Callers(depth+1, pc[:]) == 0 {
+		return "???", 1
+	}
+	if m := callers.Load(); m != nil {
+		if c, ok := (*m)[pc[0]]; ok {
+			return c.file, c.line
+		}
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc[0]}).Next()
+	c := callerInfo{file: frame.File, line: frame.Line}
+	if slash := strings.LastIndex(c.file, "/"); slash >= 0 {
+		c.file = c.file[slash+1:]
+	}
+
+	callersMu.Lock()
+	m := make(map[uintptr]callerInfo)
+	if old := callers.Load(); old != nil {
+		for k, v := range *old {
+			m[k] = v
+		}
+	}
+	m[pc[0]] = c
+	callers.Store(&m)
+	callersMu.Unlock()
+
+	return c.file, c.line
+}
+
+// getStack returns the program counters of the logging call's stack,
+// reusing pcs if it is big enough.
+func getStack(pcs []uintptr) []uintptr {
+	if cap(pcs) < 32 {
+		pcs = make([]uintptr, 32)
+	}
+	n := runtime.Callers(5, pcs[:32])
+	return pcs[:n]
+}
+
+func (this *logger) output(level Level, code int32, module *string, message *string, depth int, args ...interface{}) bool {
+	file, line := "", 0
+	if !this.noCaller.Load() {
+		file, line = getCaller(4)
+	}
+
+	item := this.newItem(level, code, *module, *message, file, line)
+	args2map(item.Args, args...)
+	if this.wantStack(level, *module) {
+		item.Stack = getStack(item.Stack)
+	}
+
+	return this.enqueue(item)
+}
+
+// outputFields is output for typed fields; it doesn't allocate.
+func (this *logger) outputFields(level Level, code int32, module string, message string, fields []Field, securityOnly bool) {
+	file, line := "", 0
+	if this.wantCaller(fields) {
+		file, line = getCaller(4)
+	}
+
+	item := this.newItem(level, code, module, message, file, line)
+	item.fields = append(item.fields, fields...)
+	item.securityOnly = securityOnly
+	if this.wantStack(level, module) {
+		item.Stack = getStack(item.Stack)
+	}
+
+	this.enqueue(item)
+}
+
+// wantCaller reports whether a call with fields records its file and
+// line.
+func (this *logger) wantCaller(fields []Field) bool {
+	if this.noCaller.Load() {
+		return false
+	}
+	for i := range fields {
+		if fields[i].kind == fieldNoCaller {
+			return false
+		}
+	}
+	return true
+}
+
+// SetCaller switches looking up the file and line of logging calls on or
+// off; records logged with it off have an empty File and Line 0.
+func (this *logger) SetCaller(on bool) {
+	this.noCaller.Store(!on)
+}
+
+// SetCaller switches caller lookup of the default logger.
+func SetCaller(on bool) {
+	logging.SetCaller(on)
+}
+
+func (this *logger) newItem(level Level, code int32, module, message, file string, line int) *Record {
+	item := newRecord()
+	item.Message = message
+	item.Level = level
+	item.Module = module
+	item.Line = line
+	item.File = file
+	item.Code = code
+	item.Time = this.now()
+	return item
+}
+
+// AddSink attaches s to the logger; it receives every record from then on.
+func (this *logger) AddSink(s Sink) {
+	this.AddSinkLevel(s, DEBUG2)
+}
+
+// AddSinkLevel attaches s to the logger; it receives records at level and
+// more severe ones.
+func (this *logger) AddSinkLevel(s Sink, level Level) {
+	this.setFallbackOf(s)
+	this.mu.Lock()
+	this.sinks = append(this.sinks, &sinkEntry{sink: s, level: level})
+	this.updateVerbosest()
+	this.mu.Unlock()
+}
+
+// setFallbackOf makes s, if it drops records in the background, hand them
+// to the fallback sink.
+func (this *logger) setFallbackOf(s Sink) {
+	if fs, ok := s.(interface{ setFallback(func(*Record, error)) }); ok {
+		fs.setFallback(this.writeFallback)
+	}
+}
+
+// ResetSinks closes and detaches all of the logger's sinks, including the
+// default console and file sinks.
+func (this *logger) ResetSinks() {
+	this.mu.Lock()
+	for _, e := range this.sinks {
+		e.sink.Close()
+	}
+	this.sinks = nil
+	this.updateVerbosest()
+	this.mu.Unlock()
+}
+
+// updateVerbosest must be called with mu held.
+func (this *logger) updateVerbosest() {
+	verbosest, security := int32(-1), int32(0)
+	for _, e := range this.sinks {
+		switch {
+		case e.disabled || this.closed:
+		case e.security:
+			security++
+		case int32(e.level) > verbosest:
+			verbosest = int32(e.level)
+		}
 	}
-	return &argsMap, nil
+	atomic.StoreInt32(&this.verbosest, verbosest)
+	this.securitySinks.Store(security)
+}
+
+// enabled reports whether a record at level would reach any sink, for a
+// module at the most verbose module level if that is more verbose.
+func (this *logger) enabled(level Level) bool {
+	if level > CompiledLevel {
+		return false
+	}
+	limit := atomic.LoadInt32(&this.level)
+	if ml := this.modules.Load(); ml != nil && int32(ml.verbosest) > limit {
+		limit = int32(ml.verbosest)
+	}
+	return limit >= int32(level) && atomic.LoadInt32(&this.verbosest) >= int32(level)
+}
+
+// SetLevel sets the most verbose level the logger logs; records less
+// severe are dropped whatever their sinks accept. It is DEBUG2 by default.
+func (this *logger) SetLevel(level Level) {
+	atomic.StoreInt32(&this.level, int32(level))
+}
+
+// GetLevel returns the most verbose level the logger logs.
+func (this *logger) GetLevel() Level {
+	return Level(atomic.LoadInt32(&this.level))
+}
+
+// SetLevel sets the level of the default logger.
+func SetLevel(level Level) {
+	logging.SetLevel(level)
+}
+
+// GetLevel returns the level of the default logger.
+func GetLevel() Level {
+	return logging.GetLevel()
+}
+
+// admit reports whether a record is enabled, passes the module filter and
+// the level of its code, and passes the sampling and the rate limit of its
+// level.
+func (this *logger) admit(level Level, module string, code int32) bool {
+	return level <= CompiledLevel && this.moduleEnabled(level, module) && this.moduleAllowed(module) && this.codeAllowed(level, code) &&
+		this.sample(level, module, code) && this.limit(level, module, code)
 }
-func getCaller(depth int) (*string, int) {
-	_, file, line, ok := runtime.Caller(4)
-	if !ok {
-		file = "???"
-		line = 1
+
+// Enabled reports whether a record at level would reach any sink of the
+// default logger, to skip building costly arguments.
+func Enabled(level Level) bool {
+	return logging.enabled(level)
+}
+
+// SetConsole sends the logger's console output to stdout, stderr or
+// nowhere, according to one of the Console constants. This also
+// reattaches the console after ResetSinks.
+func (this *logger) SetConsole(dest int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for i, e := range this.sinks {
+		if e == this.console {
+			this.sinks = append(this.sinks[:i:i], this.sinks[i+1:]...)
+			break
+		}
+	}
+
+	cs := this.console.sink.(*consoleSink)
+	switch dest {
+	case ConsoleStdout:
+		cs.w = os.Stdout
+	case ConsoleStderr:
+		cs.w = os.Stderr
+	default:
+		this.updateVerbosest()
+		return
+	}
+	this.sinks = append(this.sinks, this.console)
+	this.updateVerbosest()
+}
+
+// setFormat sets the format of the console and of the default file sink.
+func (this *logger) setFormat(format Formatter) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.console != nil {
+		this.console.sink.(*consoleSink).format = format
+	}
+	if this.file != nil {
+		if fs, ok := this.file.sink.(*fileSink); ok {
+			fs.format = format
+		}
+	}
+}
+
+// setToStderr sends the console to stderr and detaches the file, or sends
+// it back to stdout and reattaches the file.
+func (this *logger) setToStderr(on bool) {
+	if on {
+		this.SetConsole(ConsoleStderr)
 	} else {
-		slash := strings.LastIndex(file, "/")
-		if slash >= 0 {
-			file = file[slash+1:]
+		this.SetConsole(ConsoleStdout)
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.file == nil {
+		return
+	}
+	for i, e := range this.sinks {
+		if e == this.file {
+			if on {
+				this.sinks = append(this.sinks[:i:i], this.sinks[i+1:]...)
+				this.updateVerbosest()
+			}
+			return
 		}
 	}
+	if !on {
+		this.sinks = append(this.sinks, this.file)
+		this.updateVerbosest()
+	}
+}
+
+// defaultFileConfig is the configuration of the default file sink, which
+// logs to the default directory.
+func defaultFileConfig() FileSinkConfig {
+	return FileSinkConfig{Format: TextFormatter}
+}
+
+// defaultFileDir is the default directory of log files,
+// /var/log/kslog/<program>, or %ProgramData%\<program>\logs on Windows,
+// unless KSLOG_DIR is set. It is looked up when the file is opened, so
+// that SetProgramName is taken into account.
+func defaultFileDir() string {
+	if dir := os.Getenv("KSLOG_DIR"); dir != "" {
+		return dir
+	}
+	return defaultLogDir()
+}
 
-	return &file, line
+// SetFileConfig replaces the logger's default file sink with one
+// configured by config; without a Path or Dir it keeps logging to the
+// default directory. This also reattaches the file after ResetSinks.
+//
+// When a Dir isn't writable, the file is created in the user's cache
+// directory or the temporary directory instead, with a note on stderr.
+func (this *logger) SetFileConfig(config FileSinkConfig) error {
+	s, err := OpenFileSink(config)
+	if err != nil {
+		return err
+	}
+	this.setFile(s)
+	return nil
 }
 
-func (this *logger) output(level loglevel, code int32, module *string, message *string, depth int, args ...interface{}) {
-	file, line := getCaller(4)
-	argMap, err := args2map(args...)
+// SetLevelFiles replaces the logger's default file sink with files split
+// by severity, see NewLevelFileSink.
+func (this *logger) SetLevelFiles(files []LevelFile) error {
+	s, err := NewLevelFileSink(files)
 	if err != nil {
-		log.Printf("ERROR: %s at %s:%d", err.Error(), file, line)
+		return err
 	}
+	this.setFile(s)
+	return nil
+}
+
+// setFile makes s the logger's file sink, closing the previous one.
+func (this *logger) setFile(s Sink) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	entry := &sinkEntry{sink: s, level: DEBUG2, owned: true}
+	if this.file != nil {
+		entry.level = this.file.level
+	}
+	for i, e := range this.sinks {
+		if e == this.file {
+			e.sink.Close()
+			this.sinks = append(this.sinks[:i:i], this.sinks[i+1:]...)
+			break
+		}
+	}
+	this.file = entry
+	this.sinks = append(this.sinks, entry)
+	this.updateVerbosest()
+}
+
+// SetSinkEnabled stops handing records to the attached sink s, or starts
+// again, without closing it. It reports whether s is attached.
+func (this *logger) SetSinkEnabled(s Sink, on bool) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for _, e := range this.sinks {
+		if e.sink == s {
+			e.disabled = !on
+			this.updateVerbosest()
+			return true
+		}
+	}
+	return false
+}
+
+// SetSinkLevel sets the most verbose level the attached sink s gets, so
+// that e.g. a network sink gets only errors while the file keeps
+// everything. It reports whether s is attached.
+func (this *logger) SetSinkLevel(s Sink, level Level) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for _, e := range this.sinks {
+		if e.sink == s {
+			e.level = level
+			this.updateVerbosest()
+			return true
+		}
+	}
+	return false
+}
+
+// SetConsoleLevel sets the most verbose level the console prints.
+func (this *logger) SetConsoleLevel(level Level) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.console != nil {
+		this.console.level = level
+		this.updateVerbosest()
+	}
+}
+
+// SetFileLevel sets the most verbose level the default file sink gets; it
+// is kept when the file is reconfigured.
+func (this *logger) SetFileLevel(level Level) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
 
-	item := &logItem{
-		message: message,
-		level:   level,
-		module:  module,
-		line:    line,
-		file:    file,
-		code:    code,
-		args:    argMap,
+	if this.file != nil {
+		this.file.level = level
+		this.updateVerbosest()
 	}
+}
+
+// SetFallbackSink sets the sink that gets a record when a sink returns an
+// error writing it, or when a batching network sink, like HTTPSink, or
+// WebhookSink gives up sending it, with the error added under the
+// "kslog_sink_error" key. It defaults to stderr; nil drops such records.
+// NetSink queues formatted lines rather than records and doesn't hand
+// what it drops to the fallback sink; see its Dropped method.
+func (this *logger) SetFallbackSink(s Sink) {
+	this.fallbackMu.Lock()
+	this.fallback = s
+	this.fallbackMu.Unlock()
+}
+
+// AddSink attaches s to the default logger.
+func AddSink(s Sink) {
+	logging.AddSink(s)
+}
+
+// AddSinkLevel attaches s to the default logger for records at level and
+// more severe ones.
+func AddSinkLevel(s Sink, level Level) {
+	logging.AddSinkLevel(s, level)
+}
+
+// ResetSinks closes and detaches all sinks of the default logger.
+func ResetSinks() {
+	logging.ResetSinks()
+}
 
-	this.sink <- item
+// SetConsole sets the console destination of the default logger.
+func SetConsole(dest int) {
+	logging.SetConsole(dest)
 }
 
+// SetFileConfig reconfigures the file sink of the default logger.
+func SetFileConfig(config FileSinkConfig) error {
+	return logging.SetFileConfig(config)
+}
+
+// SetLevelFiles splits the file output of the default logger by severity.
+func SetLevelFiles(files []LevelFile) error {
+	return logging.SetLevelFiles(files)
+}
+
+// SetSinkEnabled enables or disables a sink of the default logger.
+func SetSinkEnabled(s Sink, on bool) bool {
+	return logging.SetSinkEnabled(s, on)
+}
+
+// SetSinkLevel sets the level of a sink of the default logger.
+func SetSinkLevel(s Sink, level Level) bool {
+	return logging.SetSinkLevel(s, level)
+}
+
+// SetConsoleLevel sets the console level of the default logger.
+func SetConsoleLevel(level Level) {
+	logging.SetConsoleLevel(level)
+}
+
+// SetFileLevel sets the file level of the default logger.
+func SetFileLevel(level Level) {
+	logging.SetFileLevel(level)
+}
+
+// SetFallbackSink sets the fallback sink of the default logger.
+func SetFallbackSink(s Sink) {
+	logging.SetFallbackSink(s)
+}
+
+// sinkBatchSize is the most records the sink goroutine takes off the
+// queue before it ends a batch.
+const sinkBatchSize = 256
+
+// sinkLoop hands records to the sinks in batches: it takes whatever is
+// queued, up to sinkBatchSize records, and then ends the batch of every
+// BatchSink, so that under load they write many records at once.
 func (this *logger) sinkLoop() {
+	var flushed []chan struct{}
 	for {
-		select {
-		case li := <-this.sink:
-			this.sinkLogItem(li)
-			this.sinkLogItemToFile(li)
+		r := this.queue.pop(true)
+		this.writing.Lock()
+		this.mu.RLock()
+		for n := 0; r != nil; n++ {
+			if r.keep {
+				this.kept.Add(-1)
+			}
+			if !r.marker() {
+				this.taken.Store(r.Time.UnixNano())
+			}
+			switch {
+			case r.flushed != nil:
+				this.endRun()
+				flushed = append(flushed, r.flushed)
+			case r.repeatsDue:
+				this.repeatsDue()
+			case this.repeated(r):
+				releaseRecord(r)
+			default:
+				this.write(r)
+			}
+
+			r = nil
+			if n+1 < sinkBatchSize {
+				r = this.queue.pop(false)
+			}
+		}
+		this.endBatch()
+		this.mu.RUnlock()
+		this.writing.Unlock()
+		if this.queue.len() == 0 {
+			this.taken.Store(0)
+		}
+
+		for _, done := range flushed {
+			close(done)
 		}
+		flushed = flushed[:0]
 	}
 }
 
-func (this *logger) sinkLogItem(li *logItem) {
-	s := fmt.Sprintf("%d: %s:%d %d", li.level, *li.file, li.line, li.code)
-	//fmt.Printf("%d: %s:%d %d : \"%s\" %s\n", li.level, *li.file, li.line, li.code, *li.message, map2str(li.args))
-	fmt.Printf("%-30s : %s %s\n", s, *li.message, map2str(li.args))
+// write hands r to the sinks. It must be called with mu held.
+func (this *logger) write(r *Record) {
+	expandFields(r)
+	describeCode(r)
+	redactRecord(r)
+	scrubRecord(r)
+	sanitizeRecord(r)
+	this.escalate(r)
+	if r.traced {
+		this.keepTrace(r)
+		return
+	}
+	if r.Level <= ERROR && this.traces.Load() != nil {
+		this.flushTrace(r)
+	}
+	this.deliver(r)
 }
 
-func (this *logger) sinkLogItemToFile(li *logItem) {
-	out := fmt.Sprintf("%d: %s:%d %d : \"%s\" %s\n", li.level, *li.file, li.line, li.code, *li.message, map2str(li.args))
-	this.file.WriteString(out)
+// deliver runs r through the hooks and hands it to the sinks.
+func (this *logger) deliver(r *Record) {
+	hooked := this.runHooks(r)
+	if hooked == nil {
+		return
+	}
+	this.writeRecord(hooked)
+	// A record of a hook's own isn't pooled.
+	if hooked == r {
+		releaseRecord(r)
+	}
+}
+
+// writeRecord hands r to the sinks.
+func (this *logger) writeRecord(r *Record) {
+	this.checkAlerts(r)
+	rules := this.codeRules.Load()
+	for _, e := range this.sinks {
+		if e.security {
+			if !e.disabled && e.getsSecurity(r) {
+				if err := e.sink.Write(r); err != nil {
+					e.failed(err)
+					this.writeFallback(r, err)
+				}
+			}
+			continue
+		}
+		if (r.Level <= e.level || r.traced) && !e.disabled && !r.securityOnly && (rules == nil || rules.gets(e, r.Code)) {
+			if err := e.sink.Write(r); err != nil {
+				e.failed(err)
+				this.writeFallback(r, err)
+			}
+		}
+	}
 }
 
-func (this *logger) print(level loglevel, module *string, code int32, args ...interface{}) {
-	if this.level >= level {
+// endBatch ends the batch of the sinks that buffer records. A failure
+// is counted; the sink reports it again with the next record it fails to
+// write. It must be called with mu held.
+func (this *logger) endBatch() {
+	for _, e := range this.sinks {
+		if bs, ok := e.sink.(BatchSink); ok {
+			if err := bs.EndBatch(); err != nil {
+				e.failed(err)
+			}
+		}
+	}
+}
+
+// Flush returns once every record logged before the call was handed to
+// the sinks and their batch ended. Sinks that deliver in the background
+// may still hold them.
+func (this *logger) Flush() {
+	done := make(chan struct{})
+	this.pushKept(&Record{flushed: done}, true)
+	<-done
+}
+
+// Reopen makes the logger's sinks that write to files, like the default
+// file sink, close and reopen them, so that files moved away by logrotate
+// stop being written to.
+func (this *logger) Reopen() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	var first error
+	for _, e := range this.sinks {
+		if rs, ok := e.sink.(interface{ Reopen() error }); ok {
+			if err := rs.Reopen(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Flush waits until the default logger handed all records to its sinks.
+func Flush() {
+	logging.Flush()
+}
+
+// Reopen reopens the files of the default logger's sinks.
+func Reopen() error {
+	return logging.Reopen()
+}
+
+// writeFallback hands r, which a sink failed to write with err, to the
+// fallback sink.
+func (this *logger) writeFallback(r *Record, err error) {
+	this.fallbackMu.Lock()
+	defer this.fallbackMu.Unlock()
+
+	if this.fallback == nil {
+		return
+	}
+
+	fr := *r
+	fr.Args = make(map[string]interface{}, len(r.Args)+1)
+	for k, v := range r.Args {
+		fr.Args[k] = v
+	}
+	fr.Args["kslog_sink_error"] = err.Error()
+	this.fallback.Write(&fr)
+}
+
+// Destinations of the console sink, see SetConsole.
+const (
+	ConsoleStdout = iota
+	ConsoleStderr
+	ConsoleOff
+)
+
+// consoleSink prints records to stdout or stderr.
+type consoleSink struct {
+	w      io.Writer
+	format Formatter
+}
+
+// NewConsoleSink returns a sink printing records to stdout with format.
+func NewConsoleSink(format Formatter) Sink {
+	return &consoleSink{w: os.Stdout, format: format}
+}
+
+func (this *consoleSink) Write(r *Record) error {
+	_, err := this.w.Write(this.format(r))
+	return err
+}
+
+func (this *consoleSink) Close() error {
+	return nil
+}
+
+// writerSink writes formatted records to an io.Writer.
+type writerSink struct {
+	w      io.Writer
+	format Formatter
+}
+
+// NewWriterSink returns a sink writing records formatted with format to w.
+// Writes happen on the logger's sink goroutine; closing the sink leaves w
+// open.
+func NewWriterSink(w io.Writer, format Formatter) Sink {
+	return &writerSink{w: w, format: format}
+}
+
+func (this *writerSink) Write(r *Record) error {
+	_, err := this.w.Write(this.format(r))
+	return err
+}
+
+func (this *writerSink) Close() error {
+	return nil
+}
+
+// fileLine formats a record the way it is written to the log file.
+func fileLine(r *Record) string {
+	tags := ""
+	if r.Seq != 0 {
+		tags = " #" + strconv.FormatUint(r.Seq, 10)
+	}
+	if r.Security != "" {
+		tags += " " + string(r.Security)
+	}
+	return fmt.Sprintf("%d: %s:%d %d%s : \"%s\" %s\n", r.Level, r.File, r.Line, r.Code, tags, r.Message, map2str(r.Args))
+}
+
+func (this *logger) print(level Level, module *string, code int32, args ...interface{}) {
+	if this.admit(level, *module, code) {
 		buf := new(bytes.Buffer)
 		fmt.Fprint(buf, args...)
 		str := buf.String()
@@ -186,14 +1122,22 @@ func (this *logger) print(level loglevel, module *string, code int32, args ...in
 	}
 }
 
-func (this *logger) printex(level loglevel, module *string, code int32, message *string, args ...interface{}) {
-	if this.level >= level {
+func (this *logger) printex(level Level, module *string, code int32, message *string, args ...interface{}) {
+	if this.admit(level, *module, code) {
 		this.output(level, code, module, message, 0, args...)
 	}
 }
 
-func (this *logger) printf(level loglevel, module *string, code int32, format string, args ...interface{}) {
-	if this.level >= level {
+func (this *logger) printFields(level Level, module string, code int32, message string, fields ...Field) {
+	if this.admit(level, module, code) {
+		this.outputFields(level, code, module, message, fields, false)
+	} else if this.securitySinks.Load() > 0 && securityOf(fields) != "" {
+		this.outputFields(level, code, module, message, fields, true)
+	}
+}
+
+func (this *logger) printf(level Level, module *string, code int32, format string, args ...interface{}) {
+	if this.admit(level, *module, code) {
 		buf := new(bytes.Buffer)
 		fmt.Fprintf(buf, format, args...)
 		str := buf.String()
@@ -219,6 +1163,11 @@ func EmergeEx(module string, code int32, message string, args ...interface{}) {
 	logging.printex(EMERGE, &module, code, &message, args...)
 }
 
+// EmergeFields logs to the EMERGE log with typed fields; it doesn't allocate.
+func EmergeFields(module string, code int32, message string, fields ...Field) {
+	logging.printFields(EMERGE, module, code, message, fields...)
+}
+
 // Errorf logs to the ERROR log.
 // Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
 func Errorf(module string, code int32, format string, args ...interface{}) {
@@ -237,6 +1186,11 @@ func ErrorEx(module string, code int32, message string, args ...interface{}) {
 	logging.printex(ERROR, &module, code, &message, args...)
 }
 
+// ErrorFields logs to the ERROR log with typed fields; it doesn't allocate.
+func ErrorFields(module string, code int32, message string, fields ...Field) {
+	logging.printFields(ERROR, module, code, message, fields...)
+}
+
 // Noticef logs to the NOTICE log.
 // Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
 func Noticef(module string, code int32, format string, args ...interface{}) {
@@ -255,6 +1209,11 @@ func NoticeEx(module string, code int32, message string, args ...interface{}) {
 	logging.printex(NOTICE, &module, code, &message, args...)
 }
 
+// NoticeFields logs to the NOTICE log with typed fields; it doesn't allocate.
+func NoticeFields(module string, code int32, message string, fields ...Field) {
+	logging.printFields(NOTICE, module, code, message, fields...)
+}
+
 // Infof logs to the INFO log.
 // Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
 func Infof(module string, code int32, format string, args ...interface{}) {
@@ -273,20 +1232,13 @@ func InfoEx(module string, code int32, message string, args ...interface{}) {
 	logging.printex(INFO, &module, code, &message, args...)
 }
 
-// Debugf logs to the DEBUG log.
-// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
-func Debugf(module string, code int32, format string, args ...interface{}) {
-	logging.printf(DEBUG, &module, code, format, args...)
-}
-
-// Debug logs to the DEBUG log.
-// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
-func Debug(module string, code int32, args ...interface{}) {
-	logging.print(DEBUG, &module, code, args...)
+// InfoFields logs to the INFO log with typed fields; it doesn't allocate.
+func InfoFields(module string, code int32, message string, fields ...Field) {
+	logging.printFields(INFO, module, code, message, fields...)
 }
 
-// Debug logs to the DEBUG log.
-// Argument are string and anonymous struct
-func DebugEx(module string, code int32, message string, args ...interface{}) {
-	logging.printex(DEBUG, &module, code, &message, args...)
+// LogFields logs to the log of level with typed fields, for callers that
+// pick the level at run time.
+func LogFields(level Level, module string, code int32, message string, fields ...Field) {
+	logging.printFields(level, module, code, message, fields...)
 }
@@ -0,0 +1,60 @@
+// Package kslogecho routes the logs of Echo and its access log into kslog.
+//
+//	e := echo.New()
+//	kslogecho.RouteLogs(e)
+//	e.Use(kslogecho.Middleware(kslog.AccessLogConfig{}))
+//	admin := e.Group("/admin", kslogecho.Middleware(kslog.AccessLogConfig{Module: "admin"}))
+package kslogecho
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	kslog "github.com/aviz/go-kslog"
+	"github.com/labstack/echo/v4"
+)
+
+// RouteLogs logs what e and its HTTP server write as records of module
+// "echo", at INFO and ERROR respectively.
+func RouteLogs(e *echo.Echo) {
+	e.Logger.SetOutput(kslog.NewLogWriter(kslog.INFO, "echo"))
+	e.StdLogger = log.New(kslog.NewLogWriter(kslog.ERROR, "echo"), "", 0)
+}
+
+// Middleware logs every request the routes it is used by serve, like
+// kslog.HTTPMiddlewareConfig, with the error the handler returned. Without
+// a Module in config, the module is "http." followed by the first segment
+// of the route, e.g. "http.api" for /api/v1/users/:id. Use it once, on
+// the router or on a group: used on both, a request is logged twice.
+func Middleware(config kslog.AccessLogConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			var fields []kslog.Field
+			if err != nil {
+				// Let the error handler answer, so that its status is logged.
+				c.Error(err)
+				fields = append(fields, kslog.Err(err))
+			}
+
+			request := config
+			if request.Module == "" {
+				request.Module = routeModule(c.Path())
+			}
+			resp := c.Response()
+			request.LogRequest(c.Request(), resp.Header(), resp.Status, resp.Size, time.Since(start), fields...)
+			return nil
+		}
+	}
+}
+
+// routeModule returns the module of requests to route.
+func routeModule(route string) string {
+	group, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+	if group == "" || strings.HasPrefix(group, ":") || strings.HasPrefix(group, "*") {
+		return "http"
+	}
+	return "http." + group
+}
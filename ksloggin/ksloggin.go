@@ -0,0 +1,54 @@
+// Package ksloggin routes the logs of Gin and its access log into kslog.
+//
+//	ksloggin.RouteLogs()
+//	router := gin.New()
+//	router.Use(ksloggin.Middleware(kslog.AccessLogConfig{}))
+//	admin := router.Group("/admin", ksloggin.Middleware(kslog.AccessLogConfig{Module: "admin"}))
+package ksloggin
+
+import (
+	"strings"
+	"time"
+
+	kslog "github.com/aviz/go-kslog"
+	"github.com/gin-gonic/gin"
+)
+
+// RouteLogs logs what Gin writes as records of module "gin", its debug
+// output at DEBUG and its errors at ERROR.
+func RouteLogs() {
+	gin.DefaultWriter = kslog.NewLogWriter(kslog.DEBUG, "gin")
+	gin.DefaultErrorWriter = kslog.NewLogWriter(kslog.ERROR, "gin")
+}
+
+// Middleware logs every request the routes it is used by serve, like
+// kslog.HTTPMiddlewareConfig, with the errors handlers attached to the
+// request. Without a Module in config, the module is "http." followed by
+// the first segment of the route, e.g. "http.api" for /api/v1/users/:id.
+// Use it once, on the router or on a group: used on both, a request is
+// logged twice.
+func Middleware(config kslog.AccessLogConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		request := config
+		if request.Module == "" {
+			request.Module = routeModule(c.FullPath())
+		}
+		var fields []kslog.Field
+		if len(c.Errors) > 0 {
+			fields = append(fields, kslog.String("error", c.Errors.String()))
+		}
+		request.LogRequest(c.Request, c.Writer.Header(), c.Writer.Status(), int64(max(c.Writer.Size(), 0)), time.Since(start), fields...)
+	}
+}
+
+// routeModule returns the module of requests to route.
+func routeModule(route string) string {
+	group, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+	if group == "" || strings.HasPrefix(group, ":") || strings.HasPrefix(group, "*") {
+		return "http"
+	}
+	return "http." + group
+}
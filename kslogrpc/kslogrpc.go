@@ -0,0 +1,206 @@
+// Package kslogrpc logs gRPC calls through kslog: their method, peer,
+// status code and latency, and their messages at DEBUG2.
+//
+//	server := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(kslogrpc.UnaryServerInterceptor(kslogrpc.Config{})),
+//		grpc.ChainStreamInterceptor(kslogrpc.StreamServerInterceptor(kslogrpc.Config{})),
+//	)
+package kslogrpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kslog "github.com/aviz/go-kslog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Config configures the interceptors.
+type Config struct {
+	// Module is the module of the records, "grpc" by default.
+	Module string
+	// Levels are the levels of calls by status code. Codes missing are
+	// logged at INFO for OK, at WARNING for codes caused by the client,
+	// such as InvalidArgument or NotFound, and at ERROR otherwise.
+	Levels map[codes.Code]kslog.Level
+	// MaxPayload caps the bytes of a message logged at DEBUG2, 1KiB by
+	// default; a negative cap logs no messages.
+	MaxPayload int
+}
+
+// clientCodes are the codes logged at WARNING by default.
+var clientCodes = map[codes.Code]bool{
+	codes.Canceled:           true,
+	codes.InvalidArgument:    true,
+	codes.NotFound:           true,
+	codes.AlreadyExists:      true,
+	codes.PermissionDenied:   true,
+	codes.FailedPrecondition: true,
+	codes.OutOfRange:         true,
+	codes.Unauthenticated:    true,
+}
+
+func (this *Config) init() {
+	if this.Module == "" {
+		this.Module = "grpc"
+	}
+	if this.MaxPayload == 0 {
+		this.MaxPayload = 1024
+	}
+}
+
+func (this *Config) level(code codes.Code) kslog.Level {
+	if level, ok := this.Levels[code]; ok {
+		return level
+	}
+	switch {
+	case code == codes.OK:
+		return kslog.INFO
+	case clientCodes[code]:
+		return kslog.WARNING
+	}
+	return kslog.ERROR
+}
+
+// logCall logs a finished call.
+func (this *Config) logCall(ctx context.Context, message, method string, remote string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := append(kslog.ContextFields(ctx),
+		kslog.String("method", method),
+		kslog.String("peer", remote),
+		kslog.String("code", code.String()),
+		kslog.Duration("duration", time.Since(start)),
+		kslog.NoCaller,
+	)
+	if err != nil {
+		fields = append(fields, kslog.Err(err))
+	}
+	kslog.LogFields(this.level(code), this.Module, 0, message, fields...)
+}
+
+// logPayload logs a message of a call at DEBUG2, capped to MaxPayload.
+func (this *Config) logPayload(ctx context.Context, message, method string, m interface{}) {
+	if this.MaxPayload < 0 || !kslog.Enabled(kslog.DEBUG2) {
+		return
+	}
+	payload := fmt.Sprintf("%v", m)
+	size := len(payload)
+	if size > this.MaxPayload {
+		payload = payload[:this.MaxPayload] + "..."
+	}
+	fields := append(kslog.ContextFields(ctx),
+		kslog.String("method", method),
+		kslog.String("payload", payload),
+		kslog.Int("payload_size", size),
+		kslog.NoCaller,
+	)
+	kslog.LogFields(kslog.DEBUG2, this.Module, 0, message, fields...)
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// UnaryServerInterceptor logs the unary calls a server serves.
+func UnaryServerInterceptor(config Config) grpc.UnaryServerInterceptor {
+	config.init()
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		config.logPayload(ctx, "RPC request", info.FullMethod, req)
+		resp, err := handler(ctx, req)
+		if err == nil {
+			config.logPayload(ctx, "RPC response", info.FullMethod, resp)
+		}
+		config.logCall(ctx, "RPC served", info.FullMethod, peerAddr(ctx), start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs the streaming calls a server serves, once
+// they end.
+func StreamServerInterceptor(config Config) grpc.StreamServerInterceptor {
+	config.init()
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, &serverStream{ss, &config, info.FullMethod})
+		config.logCall(ss.Context(), "RPC stream served", info.FullMethod, peerAddr(ss.Context()), start, err)
+		return err
+	}
+}
+
+// UnaryClientInterceptor logs the unary calls a client makes.
+func UnaryClientInterceptor(config Config) grpc.UnaryClientInterceptor {
+	config.init()
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		config.logPayload(ctx, "RPC request", method, req)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil {
+			config.logPayload(ctx, "RPC response", method, reply)
+		}
+		config.logCall(ctx, "RPC called", method, cc.Target(), start, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor logs the streaming calls a client makes: their
+// start, as their end can't be told apart from an abandoned stream.
+func StreamClientInterceptor(config Config) grpc.StreamClientInterceptor {
+	config.init()
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		config.logCall(ctx, "RPC stream opened", method, cc.Target(), start, err)
+		if err != nil {
+			return nil, err
+		}
+		return &clientStream{cs, &config, method}, nil
+	}
+}
+
+// serverStream logs the messages of a server stream.
+type serverStream struct {
+	grpc.ServerStream
+	config *Config
+	method string
+}
+
+func (this *serverStream) SendMsg(m interface{}) error {
+	this.config.logPayload(this.Context(), "RPC stream sent", this.method, m)
+	return this.ServerStream.SendMsg(m)
+}
+
+func (this *serverStream) RecvMsg(m interface{}) error {
+	err := this.ServerStream.RecvMsg(m)
+	if err == nil {
+		this.config.logPayload(this.Context(), "RPC stream received", this.method, m)
+	}
+	return err
+}
+
+// clientStream logs the messages of a client stream.
+type clientStream struct {
+	grpc.ClientStream
+	config *Config
+	method string
+}
+
+func (this *clientStream) SendMsg(m interface{}) error {
+	this.config.logPayload(this.Context(), "RPC stream sent", this.method, m)
+	return this.ClientStream.SendMsg(m)
+}
+
+func (this *clientStream) RecvMsg(m interface{}) error {
+	err := this.ClientStream.RecvMsg(m)
+	if err == nil {
+		this.config.logPayload(this.Context(), "RPC stream received", this.method, m)
+	}
+	return err
+}
@@ -0,0 +1,410 @@
+// Package kslogsql logs what a database/sql driver does through kslog:
+// queries, their arguments, durations and errors.
+//
+//	sql.Register("postgres+kslog", kslogsql.Wrap(&pq.Driver{}, kslogsql.Config{}))
+//	db, err := sql.Open("postgres+kslog", dsn)
+//
+// or, with a connector:
+//
+//	db := sql.OpenDB(kslogsql.WrapConnector(connector, kslogsql.Config{}))
+package kslogsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	kslog "github.com/aviz/go-kslog"
+)
+
+// The codes records of failures are logged with, by class of error; see
+// RegisterCodes.
+const (
+	CodeError    int32 = 9000
+	CodeConn     int32 = 9001
+	CodeTimeout  int32 = 9002
+	CodeCanceled int32 = 9003
+)
+
+// RegisterCodes registers the codes of the package with kslog.
+func RegisterCodes() error {
+	codes := []struct {
+		code        int32
+		name, about string
+		level       kslog.Level
+	}{
+		{CodeError, "SQL_ERROR", "A statement failed", kslog.ERROR},
+		{CodeConn, "SQL_CONN", "The connection to the database failed", kslog.ERROR},
+		{CodeTimeout, "SQL_TIMEOUT", "A statement ran past its deadline", kslog.ERROR},
+		{CodeCanceled, "SQL_CANCELED", "A statement was canceled", kslog.WARNING},
+	}
+	for _, c := range codes {
+		if err := kslog.RegisterCode(c.code, "sql", c.name, c.about, c.level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Config configures the logging of a wrapped driver.
+type Config struct {
+	// Module is the module of the records, "sql" by default.
+	Module string
+	// Level is the level of statements that succeed, DEBUG by default,
+	// and ErrorLevel that of statements that fail, ERROR by default.
+	// Statements taking Slow or longer, if set, are logged at SlowLevel,
+	// WARNING by default.
+	Level      kslog.Level
+	ErrorLevel kslog.Level
+	Slow       time.Duration
+	SlowLevel  kslog.Level
+	// Args logs the arguments of statements, each as Redact returns it if
+	// set; byte slices are logged by length.
+	Args   bool
+	Redact func(arg driver.NamedValue) interface{}
+}
+
+func (this *Config) init() {
+	if this.Module == "" {
+		this.Module = "sql"
+	}
+	if this.Level == kslog.EMERGE {
+		this.Level = kslog.DEBUG
+	}
+	if this.ErrorLevel == kslog.EMERGE {
+		this.ErrorLevel = kslog.ERROR
+	}
+	if this.SlowLevel == kslog.EMERGE {
+		this.SlowLevel = kslog.WARNING
+	}
+}
+
+// errorCode returns the code of err by class.
+func errorCode(err error) int32 {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr):
+		return CodeConn
+	}
+	return CodeError
+}
+
+// log logs a statement that ran from start.
+func (this *Config) log(ctx context.Context, op, query string, args []driver.NamedValue, start time.Time, err error) {
+	if err == driver.ErrSkip {
+		return
+	}
+	elapsed := time.Since(start)
+	level, code := this.Level, int32(0)
+	switch {
+	case err != nil:
+		level, code = this.ErrorLevel, errorCode(err)
+	case this.Slow > 0 && elapsed >= this.Slow:
+		level = this.SlowLevel
+	}
+	if !kslog.Enabled(level) {
+		return
+	}
+
+	fields := append(kslog.ContextFields(ctx), kslog.String("op", op))
+	if query != "" {
+		fields = append(fields, kslog.String("query", query))
+	}
+	if this.Args && len(args) > 0 {
+		fields = append(fields, kslog.Any("args", this.redact(args)))
+	}
+	fields = append(fields, kslog.Duration("duration", elapsed), kslog.NoCaller)
+	if err != nil {
+		fields = append(fields, kslog.Err(err))
+	}
+	kslog.LogFields(level, this.Module, code, "SQL "+op, fields...)
+}
+
+// redact returns the values of args as they are logged.
+func (this *Config) redact(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch {
+		case this.Redact != nil:
+			values[i] = this.Redact(arg)
+		default:
+			if b, ok := arg.Value.([]byte); ok {
+				values[i] = fmt.Sprintf("[%d bytes]", len(b))
+			} else {
+				values[i] = arg.Value
+			}
+		}
+	}
+	return values
+}
+
+// Wrap returns d logging what it does as configured by config, to be
+// registered with sql.Register.
+func Wrap(d driver.Driver, config Config) driver.Driver {
+	config.init()
+	return &wrappedDriver{d, &config}
+}
+
+// WrapConnector returns c logging what it does as configured by config,
+// for sql.OpenDB.
+func WrapConnector(c driver.Connector, config Config) driver.Connector {
+	config.init()
+	return &wrappedConnector{c, &wrappedDriver{c.Driver(), &config}}
+}
+
+type wrappedDriver struct {
+	driver.Driver
+	config *Config
+}
+
+func (this *wrappedDriver) Open(name string) (driver.Conn, error) {
+	start := time.Now()
+	c, err := this.Driver.Open(name)
+	if err != nil {
+		this.config.log(context.Background(), "connect", "", nil, start, err)
+		return nil, err
+	}
+	return &wrappedConn{c, this.config}, nil
+}
+
+func (this *wrappedDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := this.Driver.(driver.DriverContext); ok {
+		c, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &wrappedConnector{c, this}, nil
+	}
+	return &nameConnector{name, this}, nil
+}
+
+type wrappedConnector struct {
+	connector driver.Connector
+	driver    *wrappedDriver
+}
+
+func (this *wrappedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	start := time.Now()
+	c, err := this.connector.Connect(ctx)
+	if err != nil {
+		this.driver.config.log(ctx, "connect", "", nil, start, err)
+		return nil, err
+	}
+	return &wrappedConn{c, this.driver.config}, nil
+}
+
+func (this *wrappedConnector) Driver() driver.Driver {
+	return this.driver
+}
+
+// nameConnector connects by name with a driver that has no connectors.
+type nameConnector struct {
+	name   string
+	driver *wrappedDriver
+}
+
+func (this *nameConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return this.driver.Open(this.name)
+}
+
+func (this *nameConnector) Driver() driver.Driver {
+	return this.driver
+}
+
+// wrappedConn logs the statements run on a connection. The optional
+// interfaces the connection lacks are reported as driver.ErrSkip, or met
+// the way database/sql would without them.
+type wrappedConn struct {
+	driver.Conn
+	config *Config
+}
+
+func (this *wrappedConn) Prepare(query string) (driver.Stmt, error) {
+	return this.PrepareContext(context.Background(), query)
+}
+
+func (this *wrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	start := time.Now()
+	var s driver.Stmt
+	var err error
+	if pc, ok := this.Conn.(driver.ConnPrepareContext); ok {
+		s, err = pc.PrepareContext(ctx, query)
+	} else {
+		s, err = this.Conn.Prepare(query)
+	}
+	if err != nil {
+		this.config.log(ctx, "prepare", query, nil, start, err)
+		return nil, err
+	}
+	return &wrappedStmt{s, query, this.config}, nil
+}
+
+func (this *wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := this.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := ec.ExecContext(ctx, query, args)
+	this.config.log(ctx, "exec", query, args, start, err)
+	return result, err
+}
+
+func (this *wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := this.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	this.config.log(ctx, "query", query, args, start, err)
+	return rows, err
+}
+
+func (this *wrappedConn) Begin() (driver.Tx, error) {
+	return this.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (this *wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	var tx driver.Tx
+	var err error
+	if bc, ok := this.Conn.(driver.ConnBeginTx); ok {
+		tx, err = bc.BeginTx(ctx, opts)
+	} else if opts.Isolation != 0 || opts.ReadOnly {
+		err = errors.New("Driver doesn't support transaction options")
+	} else {
+		tx, err = this.Conn.Begin()
+	}
+	this.config.log(ctx, "begin", "", nil, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedTx{tx, ctx, this.config}, nil
+}
+
+func (this *wrappedConn) Ping(ctx context.Context) error {
+	if p, ok := this.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (this *wrappedConn) ResetSession(ctx context.Context) error {
+	if sr, ok := this.Conn.(driver.SessionResetter); ok {
+		return sr.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (this *wrappedConn) IsValid() bool {
+	if v, ok := this.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (this *wrappedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := this.Conn.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type wrappedTx struct {
+	driver.Tx
+	ctx    context.Context
+	config *Config
+}
+
+func (this *wrappedTx) Commit() error {
+	start := time.Now()
+	err := this.Tx.Commit()
+	this.config.log(this.ctx, "commit", "", nil, start, err)
+	return err
+}
+
+func (this *wrappedTx) Rollback() error {
+	start := time.Now()
+	err := this.Tx.Rollback()
+	this.config.log(this.ctx, "rollback", "", nil, start, err)
+	return err
+}
+
+type wrappedStmt struct {
+	driver.Stmt
+	query  string
+	config *Config
+}
+
+func (this *wrappedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return this.ExecContext(context.Background(), namedValues(args))
+}
+
+func (this *wrappedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return this.QueryContext(context.Background(), namedValues(args))
+}
+
+func (this *wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var result driver.Result
+	var err error
+	if ec, ok := this.Stmt.(driver.StmtExecContext); ok {
+		result, err = ec.ExecContext(ctx, args)
+	} else if values, verr := plainValues(args); verr != nil {
+		err = verr
+	} else {
+		result, err = this.Stmt.Exec(values)
+	}
+	this.config.log(ctx, "exec", this.query, args, start, err)
+	return result, err
+}
+
+func (this *wrappedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if qc, ok := this.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = qc.QueryContext(ctx, args)
+	} else if values, verr := plainValues(args); verr != nil {
+		err = verr
+	} else {
+		rows, err = this.Stmt.Query(values)
+	}
+	this.config.log(ctx, "query", this.query, args, start, err)
+	return rows, err
+}
+
+func (this *wrappedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := this.Stmt.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+// plainValues returns args for a driver without named arguments.
+func plainValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("Driver doesn't support named arguments")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
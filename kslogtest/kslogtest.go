@@ -0,0 +1,136 @@
+// Package kslogtest helps tests assert on what code logs through kslog.
+//
+//	c := kslogtest.Capture()
+//	defer kslog.ResetSinks()
+//	doSomething()
+//	if !c.Contains(kslog.ERROR, 1203) {
+//		t.Error("expected error 1203 to be logged")
+//	}
+package kslogtest
+
+import (
+	"sync"
+	"time"
+
+	kslog "github.com/aviz/go-kslog"
+)
+
+// CaptureSink records every record it is given. Its query methods first
+// flush the default logger, so records logged before the call are seen.
+type CaptureSink struct {
+	mu      sync.Mutex
+	entries []kslog.Record
+	flush   func()
+}
+
+// NewCaptureSink returns an empty capture sink. flush is called before
+// every query; pass the Flush method of the logger the sink is attached
+// to, or nil for the default logger.
+func NewCaptureSink(flush func()) *CaptureSink {
+	if flush == nil {
+		flush = kslog.Flush
+	}
+	return &CaptureSink{flush: flush}
+}
+
+// Capture attaches a new capture sink to the default logger.
+func Capture() *CaptureSink {
+	c := NewCaptureSink(nil)
+	kslog.AddSink(c)
+	return c
+}
+
+func (this *CaptureSink) Write(r *kslog.Record) error {
+	this.mu.Lock()
+	this.entries = append(this.entries, *r.Clone())
+	this.mu.Unlock()
+	return nil
+}
+
+func (this *CaptureSink) Close() error {
+	return nil
+}
+
+// Entries returns everything captured so far, oldest first.
+func (this *CaptureSink) Entries() []kslog.Record {
+	this.flush()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return append([]kslog.Record(nil), this.entries...)
+}
+
+// Reset forgets everything captured so far.
+func (this *CaptureSink) Reset() {
+	this.flush()
+
+	this.mu.Lock()
+	this.entries = nil
+	this.mu.Unlock()
+}
+
+// Contains reports whether a record with level and code was captured.
+func (this *CaptureSink) Contains(level kslog.Level, code int32) bool {
+	for _, e := range this.Entries() {
+		if e.Level == level && e.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// LastEntry returns the most recent record; ok is false if there is none.
+func (this *CaptureSink) LastEntry() (e kslog.Record, ok bool) {
+	entries := this.Entries()
+	if len(entries) == 0 {
+		return e, false
+	}
+	return entries[len(entries)-1], true
+}
+
+// EntriesForModule returns the captured records logged for module.
+func (this *CaptureSink) EntriesForModule(module string) []kslog.Record {
+	var out []kslog.Record
+	for _, e := range this.Entries() {
+		if e.Module == module {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Clock is a kslog.Clock that only moves when told, for deterministic
+// timestamps, rotation and retention:
+//
+//	clock := kslogtest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+//	kslog.SetClock(clock)
+//	clock.Advance(time.Hour)
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock stopped at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (this *Clock) Now() time.Time {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.now
+}
+
+// Set sets the clock to now.
+func (this *Clock) Set(now time.Time) {
+	this.mu.Lock()
+	this.now = now
+	this.mu.Unlock()
+}
+
+// Advance moves the clock on by d.
+func (this *Clock) Advance(d time.Duration) {
+	this.mu.Lock()
+	this.now = this.now.Add(d)
+	this.mu.Unlock()
+}
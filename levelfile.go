@@ -0,0 +1,93 @@
+package kslog
+
+import (
+	"errors"
+	"sort"
+)
+
+// LevelFile is a file that gets the records of a severity band: those at
+// Level and more severe, down to the Level of the previous band.
+type LevelFile struct {
+	Level Level
+	File  FileSinkConfig
+}
+
+// levelFileSink splits records by severity between several file sinks.
+type levelFileSink struct {
+	levels []Level
+	files  []*fileSink
+}
+
+// NewLevelFileSink returns a sink writing each record to the file of its
+// severity band, each file rotated on its own, e.g.
+//
+//	kslog.NewLevelFileSink([]kslog.LevelFile{
+//		{kslog.ERROR, kslog.FileSinkConfig{Path: "/var/log/app/error.log"}},
+//		{kslog.INFO, kslog.FileSinkConfig{Path: "/var/log/app/app.log"}},
+//		{kslog.DEBUG2, kslog.FileSinkConfig{Path: "/var/log/app/debug.log"}},
+//	})
+//
+// Records less severe than every band are dropped. Files in a Dir need
+// different directories.
+func NewLevelFileSink(files []LevelFile) (Sink, error) {
+	if len(files) == 0 {
+		return nil, errors.New("No level files given")
+	}
+	files = append([]LevelFile(nil), files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Level < files[j].Level
+	})
+
+	s := &levelFileSink{}
+	for _, lf := range files {
+		fs, err := OpenFileSink(lf.File)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.levels = append(s.levels, lf.Level)
+		s.files = append(s.files, fs.(*fileSink))
+	}
+	return s, nil
+}
+
+func (this *levelFileSink) Write(r *Record) error {
+	for i, level := range this.levels {
+		if r.Level <= level {
+			return this.files[i].Write(r)
+		}
+	}
+	return nil
+}
+
+// EndBatch ends the batch of every file.
+func (this *levelFileSink) EndBatch() error {
+	var first error
+	for _, f := range this.files {
+		if err := f.EndBatch(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Reopen reopens every file.
+func (this *levelFileSink) Reopen() error {
+	var first error
+	for _, f := range this.files {
+		if err := f.Reopen(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (this *levelFileSink) Close() error {
+	var first error
+	for _, f := range this.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,59 @@
+package kslog
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxLogLine bounds what a log writer buffers of a line before logging
+// it anyway.
+const maxLogLine = 64 * 1024
+
+// logWriter logs every line written to it.
+type logWriter struct {
+	level  Level
+	module string
+	mu     sync.Mutex
+	buf    []byte
+}
+
+// NewLogWriter returns an io.Writer logging every line written to it as
+// a record of module at level, to route what libraries and frameworks
+// write to a writer into the default logger:
+//
+//	log.SetOutput(kslog.NewLogWriter(kslog.INFO, "stdlog"))
+func NewLogWriter(level Level, module string) *logWriter {
+	return &logWriter{level: level, module: module}
+}
+
+func (this *logWriter) Write(p []byte) (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.buf = append(this.buf, p...)
+	for {
+		i := bytes.IndexByte(this.buf, '\n')
+		if i < 0 {
+			if len(this.buf) < maxLogLine {
+				break
+			}
+			i = len(this.buf)
+		}
+		this.log(this.buf[:i])
+		if i < len(this.buf) {
+			i++
+		}
+		this.buf = this.buf[i:]
+	}
+	if len(this.buf) == 0 {
+		this.buf = nil
+	}
+	return len(p), nil
+}
+
+func (this *logWriter) log(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) > 0 {
+		logging.printFields(this.level, this.module, 0, string(line), NoCaller)
+	}
+}
@@ -0,0 +1,137 @@
+package kslog
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LokiSinkConfig configures a LokiSink.
+type LokiSinkConfig struct {
+	// URL is the Loki base URL, e.g. http://loki:3100.
+	URL string
+	// TenantID is sent as X-Scope-OrgID for multi-tenant Loki.
+	TenantID string
+	// Labels are added to the program/module/level labels of every stream.
+	Labels map[string]string
+	Header http.Header
+	TLS    *tls.Config
+	// BatchSize, FlushInterval and MaxRetries default to 100, 1s and 3;
+	// see NoRetries and RetryForever.
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+}
+
+// LokiSink pushes records to Grafana Loki. Program, module and level become
+// stream labels; the rest of the record is the JSON line body. Rate limited
+// pushes (429) are retried honouring Retry-After.
+type LokiSink struct {
+	config LokiSinkConfig
+	url    string
+	header http.Header
+	client *http.Client
+	batch  *batcher
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiLine struct {
+	Code    int32                  `json:"code"`
+	File    string                 `json:"file"`
+	Line    int                    `json:"line"`
+	Message string                 `json:"message"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+}
+
+// NewLokiSink returns a sink pushing to config.URL.
+func NewLokiSink(config LokiSinkConfig) *LokiSink {
+	s := &LokiSink{
+		config: config,
+		url:    strings.TrimRight(config.URL, "/") + "/loki/api/v1/push",
+		header: http.Header{},
+		client: newHTTPClient(config.TLS),
+	}
+	for k, v := range config.Header {
+		s.header[k] = v
+	}
+	if config.TenantID != "" {
+		s.header.Set("X-Scope-OrgID", config.TenantID)
+	}
+	s.batch = newBatcher(config.BatchSize, config.FlushInterval, config.MaxRetries, s.flush, nil)
+	return s
+}
+
+func (this *LokiSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *LokiSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *LokiSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close sends what is still pending and stops the sink.
+func (this *LokiSink) Close() error {
+	this.batch.close()
+	return nil
+}
+
+func (this *LokiSink) flush(records []*Record) error {
+	streams := make(map[string]*lokiStream)
+	var order []string
+
+	for _, r := range records {
+		key := r.Module + "\x00" + r.Level.String()
+		st, ok := streams[key]
+		if !ok {
+			labels := map[string]string{
+				"program": getProgram(),
+				"module":  r.Module,
+				"level":   r.Level.String(),
+			}
+			for k, v := range this.config.Labels {
+				labels[k] = v
+			}
+			st = &lokiStream{Stream: labels}
+			streams[key] = st
+			order = append(order, key)
+		}
+
+		line, err := json.Marshal(&lokiLine{
+			Code:    r.Code,
+			File:    r.File,
+			Line:    r.Line,
+			Message: r.Message,
+			Args:    jsonArgs(r.Args),
+		})
+		if err != nil {
+			line = []byte(fileLine(r))
+		}
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(r.Time.UnixNano(), 10), string(line)})
+	}
+
+	push := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range order {
+		push.Streams = append(push.Streams, streams[key])
+	}
+
+	body, err := json.Marshal(&push)
+	if err != nil {
+		return permanentError{err}
+	}
+	return postHTTP(this.client, this.url, "application/json", this.header, body, true)
+}
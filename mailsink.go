@@ -0,0 +1,176 @@
+package kslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// MailSinkConfig configures a MailSink.
+type MailSinkConfig struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	From string
+	To   []string
+	// Username and Password, when set, authenticate with PLAIN auth.
+	Username string
+	Password string
+	// TLS is used for STARTTLS, or for the whole connection when
+	// ImplicitTLS is set (usually port 465).
+	TLS         *tls.Config
+	ImplicitTLS bool
+	// Level is the least severe level mailed; it defaults to EMERGE.
+	Level Level
+	// Digest, when set, mails the records collected every Digest together,
+	// up to 100 in a mail, instead of a mail per record.
+	Digest time.Duration
+	// Subject defaults to "<program> <level>".
+	Subject string
+	// MaxRetries is how often a failed mail is tried again, 3 by default;
+	// see NoRetries and RetryForever.
+	MaxRetries int
+}
+
+// mailMaxPending is how many records at most wait to be mailed.
+const mailMaxPending = 100
+
+// MailSink mails EMERGE records, one per mail or digested, over SMTP. One
+// goroutine sends the mails, retrying failed ones with backoff; when more
+// than 100 records wait, the oldest are dropped.
+type MailSink struct {
+	config MailSinkConfig
+	batch  *batcher
+}
+
+// NewMailSink returns a sink mailing config.To.
+func NewMailSink(config MailSinkConfig) *MailSink {
+	s := &MailSink{config: config}
+	size, interval := 1, time.Duration(0)
+	if config.Digest > 0 {
+		size, interval = mailMaxPending, config.Digest
+	}
+	s.batch = newBatcher(size, interval, config.MaxRetries, s.send, nil)
+	s.batch.setLimit(mailMaxPending)
+	return s
+}
+
+func (this *MailSink) Write(r *Record) error {
+	if r.Level > this.config.Level {
+		return nil
+	}
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *MailSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *MailSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close mails what is still pending and stops the sink.
+func (this *MailSink) Close() error {
+	this.batch.close()
+	return nil
+}
+
+// send mails records, returning a permanentError for SMTP replies that are
+// not worth retrying.
+func (this *MailSink) send(records []*Record) error {
+	subject := this.config.Subject
+	if subject == "" {
+		subject = getProgram() + " " + records[0].Level.String()
+	}
+	if len(records) > 1 {
+		subject = fmt.Sprintf("%s (%d records)", subject, len(records))
+	}
+
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\n", this.config.From)
+	fmt.Fprintf(msg, "To: %s\n", strings.Join(this.config.To, ", "))
+	fmt.Fprintf(msg, "Subject: %s\n", subject)
+	fmt.Fprintf(msg, "Date: %s\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\n\n")
+	for _, r := range records {
+		fmt.Fprintf(msg, "%s %s", r.Time.Format(time.RFC3339), fileLine(r))
+	}
+
+	err := this.deliver(strings.ReplaceAll(msg.String(), "\n", "\r\n"))
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return permanentError{err}
+	}
+	return err
+}
+
+func (this *MailSink) deliver(msg string) error {
+	host, _, err := net.SplitHostPort(this.config.Addr)
+	if err != nil {
+		return err
+	}
+	config := this.config.TLS
+	if config == nil {
+		config = &tls.Config{ServerName: host}
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: netDialTimeout}
+	if this.config.ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", this.config.Addr, config)
+	} else {
+		conn, err = dialer.Dial("tcp", this.config.Addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if !this.config.ImplicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(config); err != nil {
+				return err
+			}
+		}
+	}
+	if this.config.Username != "" {
+		auth := smtp.PlainAuth("", this.config.Username, this.config.Password, host)
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(this.config.From); err != nil {
+		return err
+	}
+	for _, to := range this.config.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
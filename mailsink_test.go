@@ -0,0 +1,181 @@
+package kslog
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpServer is a fake SMTP server refusing the first fail mails with
+// code, and counting connections.
+type smtpServer struct {
+	ln   net.Listener
+	code int
+	fail int
+
+	mu      sync.Mutex
+	mails   []string
+	conns   int
+	open    int
+	maxOpen int
+}
+
+func newSMTPServer(t *testing.T, code, fail int) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	s := &smtpServer{ln: ln, code: code, fail: fail}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (this *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	this.mu.Lock()
+	this.conns++
+	if this.open++; this.open > this.maxOpen {
+		this.maxOpen = this.open
+	}
+	this.mu.Unlock()
+	defer func() {
+		this.mu.Lock()
+		this.open--
+		this.mu.Unlock()
+	}()
+	// Hold the connection a little, as a real server would.
+	time.Sleep(5 * time.Millisecond)
+
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "220 test\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			fmt.Fprintf(conn, "250 test\r\n")
+		case strings.HasPrefix(cmd, "MAIL"):
+			this.mu.Lock()
+			refuse := this.fail > 0
+			if refuse {
+				this.fail--
+			}
+			this.mu.Unlock()
+			if refuse {
+				fmt.Fprintf(conn, "%d refused\r\n", this.code)
+			} else {
+				fmt.Fprintf(conn, "250 ok\r\n")
+			}
+		case strings.HasPrefix(cmd, "RCPT"):
+			fmt.Fprintf(conn, "250 ok\r\n")
+		case cmd == "DATA":
+			fmt.Fprintf(conn, "354 go on\r\n")
+			var mail strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				mail.WriteString(line)
+			}
+			this.mu.Lock()
+			this.mails = append(this.mails, mail.String())
+			this.mu.Unlock()
+			fmt.Fprintf(conn, "250 queued\r\n")
+		case cmd == "QUIT":
+			fmt.Fprintf(conn, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprintf(conn, "250 ok\r\n")
+		}
+	}
+}
+
+func (this *smtpServer) stats() (mails []string, conns, maxOpen int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return append([]string(nil), this.mails...), this.conns, this.maxOpen
+}
+
+func TestMailSinkStorm(t *testing.T) {
+	server := newSMTPServer(t, 0, 0)
+	s := NewMailSink(MailSinkConfig{Addr: server.ln.Addr().String(), From: "a@example.com", To: []string{"b@example.com"}})
+	for i := 0; i < 1000; i++ {
+		s.Write(&Record{Message: fmt.Sprintf("storm %d", i), Level: EMERGE})
+	}
+	s.Close()
+
+	mails, conns, maxOpen := server.stats()
+	if maxOpen != 1 {
+		t.Errorf("got %d SMTP connections at once, want 1", maxOpen)
+	}
+	if conns > mailMaxPending+1 || len(mails) != conns {
+		t.Errorf("got %d connections and %d mails", conns, len(mails))
+	}
+	if uint64(len(mails))+s.Dropped() != 1000 {
+		t.Errorf("got %d mails and %d dropped, want 1000 in all", len(mails), s.Dropped())
+	}
+	if !strings.Contains(mails[len(mails)-1], "storm 999") {
+		t.Errorf("the last mail isn't the last record: %q", mails[len(mails)-1])
+	}
+	if strings.Contains(mails[0], "\r\r\n") || !strings.Contains(mails[0], "Subject: ") {
+		t.Errorf("bad mail %q", mails[0])
+	}
+}
+
+func TestMailSinkRetry(t *testing.T) {
+	var errs []error
+	var mu sync.Mutex
+	SetErrorHandler(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	defer SetErrorHandler(nil)
+
+	// A transient refusal is retried.
+	server := newSMTPServer(t, 451, 2)
+	s := NewMailSink(MailSinkConfig{Addr: server.ln.Addr().String(), From: "a@example.com", To: []string{"b@example.com"}})
+	s.Write(&Record{Message: "down", Level: EMERGE})
+	// Closing gives up retrying, wait for the retries first.
+	for i := 0; i < 200; i++ {
+		if mails, _, _ := server.stats(); len(mails) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Close()
+	if mails, _, _ := server.stats(); len(mails) != 1 || s.Dropped() != 0 {
+		t.Errorf("got %d mails and %d dropped, want the mail retried", len(mails), s.Dropped())
+	}
+
+	// A permanent one isn't, and is reported.
+	server = newSMTPServer(t, 550, 1)
+	s = NewMailSink(MailSinkConfig{Addr: server.ln.Addr().String(), From: "a@example.com", To: []string{"b@example.com"}})
+	s.Write(&Record{Message: "refused", Level: EMERGE})
+	s.Close()
+	_, conns, _ := server.stats()
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 1 || s.Dropped() != 1 || len(errs) != 1 || !strings.Contains(errs[0].Error(), "550") {
+		t.Errorf("got %d connections, %d dropped, errors %v", conns, s.Dropped(), errs)
+	}
+}
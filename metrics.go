@@ -0,0 +1,195 @@
+package kslog
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// metricKey identifies the records counted together for metrics.
+type metricKey struct {
+	level  Level
+	module string
+	code   int32
+}
+
+// metrics counts the records a logger emitted by level, module and code,
+// once PublishExpvar or MetricsHandler asked for them.
+type metrics struct {
+	on     atomic.Bool
+	mu     sync.RWMutex
+	counts map[metricKey]*atomic.Uint64
+}
+
+// count counts r if metrics are on.
+func (this *metrics) count(r *Record) {
+	if !this.on.Load() {
+		return
+	}
+	key := metricKey{r.Level, r.Module, r.Code}
+	this.mu.RLock()
+	c := this.counts[key]
+	this.mu.RUnlock()
+	if c == nil {
+		this.mu.Lock()
+		if c = this.counts[key]; c == nil {
+			if this.counts == nil {
+				this.counts = make(map[metricKey]*atomic.Uint64)
+			}
+			c = new(atomic.Uint64)
+			this.counts[key] = c
+		}
+		this.mu.Unlock()
+	}
+	c.Add(1)
+}
+
+// MetricCount is how many records of a level, module and code were
+// emitted.
+type MetricCount struct {
+	Level  string `json:"level"`
+	Module string `json:"module"`
+	Code   int32  `json:"code"`
+	Count  uint64 `json:"count"`
+}
+
+// snapshot returns the counts sorted by level, module and code.
+func (this *metrics) snapshot() []MetricCount {
+	this.mu.RLock()
+	keys := make([]metricKey, 0, len(this.counts))
+	for key := range this.counts {
+		keys = append(keys, key)
+	}
+	this.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.level != b.level {
+			return a.level < b.level
+		}
+		if a.module != b.module {
+			return a.module < b.module
+		}
+		return a.code < b.code
+	})
+
+	counts := make([]MetricCount, len(keys))
+	this.mu.RLock()
+	for i, key := range keys {
+		counts[i] = MetricCount{key.level.String(), key.module, key.code, this.counts[key].Load()}
+	}
+	this.mu.RUnlock()
+	return counts
+}
+
+// expvarMetrics is what PublishExpvar publishes.
+type expvarMetrics struct {
+	Records    []MetricCount     `json:"records"`
+	Dropped    map[string]uint64 `json:"dropped"`
+	Sampled    map[string]uint64 `json:"sampled"`
+	Limited    map[string]uint64 `json:"limited"`
+	QueueDepth int               `json:"queue_depth"`
+	QueueSize  int               `json:"queue_size"`
+	HighWater  int               `json:"high_water"`
+}
+
+// PublishExpvar publishes the logger's metrics as the expvar name, "kslog"
+// if empty: the records emitted by level, module and code, those dropped,
+// sampled out and rate limited by level, and the queue. Records are
+// counted by module and code from then on. Like expvar.Publish, it panics
+// if name is already published.
+func (this *logger) PublishExpvar(name string) {
+	if name == "" {
+		name = "kslog"
+	}
+	this.metrics.on.Store(true)
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		h, st := this.Health(), this.Stats()
+		return &expvarMetrics{
+			Records:    this.metrics.snapshot(),
+			Dropped:    byLevel(&st.Dropped),
+			Sampled:    byLevel(&st.Sampled),
+			Limited:    byLevel(&st.Limited),
+			QueueDepth: h.QueueDepth,
+			QueueSize:  h.QueueSize,
+			HighWater:  h.HighWater,
+		}
+	}))
+}
+
+// PublishExpvar publishes the metrics of the default logger.
+func PublishExpvar(name string) {
+	logging.PublishExpvar(name)
+}
+
+// MetricsHandler returns an http.Handler serving the logger's metrics in
+// the Prometheus text format, for Prometheus to scrape without a client
+// library:
+//
+//	kslog_records_total{level,module,code}  records emitted
+//	kslog_dropped_total{level}              dropped as the queue was full
+//	kslog_sampled_total{level}              sampled out
+//	kslog_limited_total{level}              suppressed by the rate limit
+//	kslog_sink_failures_total{sink,type}    records a sink failed to write
+//	kslog_queue_depth, kslog_queue_size, kslog_queue_high_water
+//
+// Records are counted by module and code from then on.
+func (this *logger) MetricsHandler() http.Handler {
+	this.metrics.on.Store(true)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		this.writeMetrics(bw)
+		bw.Flush()
+	})
+}
+
+// MetricsHandler serves the metrics of the default logger.
+func MetricsHandler() http.Handler {
+	return logging.MetricsHandler()
+}
+
+func (this *logger) writeMetrics(w *bufio.Writer) {
+	h, st := this.Health(), this.Stats()
+
+	metricHeader(w, "kslog_records_total", "counter", "Records emitted by level, module and code.")
+	for _, c := range this.metrics.snapshot() {
+		fmt.Fprintf(w, "kslog_records_total{level=%s,module=%s,code=\"%d\"} %d\n", labelValue(c.Level), labelValue(c.Module), c.Code, c.Count)
+	}
+	levelCounter := func(name, help string, counts *[MAXLEVEL]uint64) {
+		metricHeader(w, name, "counter", help)
+		for l, n := range counts {
+			fmt.Fprintf(w, "%s{level=%s} %d\n", name, labelValue(Level(l).String()), n)
+		}
+	}
+	levelCounter("kslog_dropped_total", "Records dropped as the queue was full.", &st.Dropped)
+	levelCounter("kslog_sampled_total", "Records sampled out.", &st.Sampled)
+	levelCounter("kslog_limited_total", "Records suppressed by the rate limit.", &st.Limited)
+
+	metricHeader(w, "kslog_sink_failures_total", "counter", "Records a sink failed to write.")
+	for i, s := range st.Sinks {
+		fmt.Fprintf(w, "kslog_sink_failures_total{sink=\"%d\",type=%s} %d\n", i, labelValue(fmt.Sprintf("%T", s.Sink)), s.Failures)
+	}
+
+	metricHeader(w, "kslog_queue_depth", "gauge", "Records queued for the sinks.")
+	fmt.Fprintf(w, "kslog_queue_depth %d\n", h.QueueDepth)
+	metricHeader(w, "kslog_queue_size", "gauge", "Records the queue holds.")
+	fmt.Fprintf(w, "kslog_queue_size %d\n", h.QueueSize)
+	metricHeader(w, "kslog_queue_high_water", "gauge", "Most records ever queued at once.")
+	fmt.Fprintf(w, "kslog_queue_high_water %d\n", h.HighWater)
+}
+
+func metricHeader(w *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue quotes s as a Prometheus label value.
+func labelValue(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package kslog
+
+import (
+	"errors"
+	"os"
+)
+
+func mapFile(file *os.File, offset int64, size int) ([]byte, error) {
+	return nil, errors.New("Memory mapped log files are not supported on this platform")
+}
+
+func unmapFile(region []byte) error {
+	return nil
+}
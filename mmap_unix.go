@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package kslog
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps size bytes of file from offset on, shared and writable.
+func mapFile(file *os.File, offset int64, size int) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), offset, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+func unmapFile(region []byte) error {
+	return syscall.Munmap(region)
+}
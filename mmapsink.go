@@ -0,0 +1,274 @@
+package kslog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	mmapChunkAlign = 1 << 20
+	mmapChunkSize  = 16 << 20
+)
+
+// MmapSinkConfig configures a memory mapped file sink.
+type MmapSinkConfig struct {
+	Path string
+	// Format defaults to TextFormatter.
+	Format Formatter
+	// ChunkSize is how much of the file is mapped at a time, and how much
+	// it grows by when that is full; 16MiB by default, rounded up to a
+	// multiple of 1MiB.
+	ChunkSize int64
+	// MaxSize rotates the file before it grows past this many bytes,
+	// renaming it with a timestamp suffix; zero never rotates.
+	MaxSize int64
+	// SyncInterval is how long after the first unsynced record the mapped
+	// pages are written back to disk, 1s by default; negative leaves that
+	// to the kernel.
+	SyncInterval time.Duration
+}
+
+// mmapSink appends records to a file by copying them into a shared memory
+// mapping of it, so that logging a record makes no system call at all.
+type mmapSink struct {
+	config MmapSinkConfig
+	format Formatter
+	mu     sync.Mutex
+	file   *os.File
+	// region maps the file from base on; size is how much of the file
+	// holds records.
+	region    []byte
+	base      int64
+	size      int64
+	syncTimer *time.Timer
+}
+
+// NewMmapSink returns a sink appending records to the file at
+// config.Path through a memory mapping, for latency critical services
+// where even buffered writes jitter too much. The file is grown a chunk
+// at a time and cut to its records when the sink is closed; after a crash
+// it ends in zero bytes, which are overwritten when it is opened again.
+// Memory mapped files are supported on Linux, macOS and the BSDs.
+func NewMmapSink(config MmapSinkConfig) (Sink, error) {
+	if config.Path == "" {
+		return nil, errors.New("No path given for memory mapped log file")
+	}
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = mmapChunkSize
+	}
+	config.ChunkSize = (config.ChunkSize + mmapChunkAlign - 1) / mmapChunkAlign * mmapChunkAlign
+	if config.SyncInterval == 0 {
+		config.SyncInterval = time.Second
+	}
+
+	s := &mmapSink{config: config, format: config.Format}
+	if s.format == nil {
+		s.format = TextFormatter
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the file and maps the chunk its records end in.
+func (this *mmapSink) open() error {
+	file, err := os.OpenFile(this.config.Path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err == nil {
+		this.size, err = dataEnd(file, info.Size())
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	this.file = file
+	base := this.size / mmapChunkAlign * mmapChunkAlign
+	if err := this.mapChunk(base); err != nil {
+		this.file = nil
+		file.Close()
+		return err
+	}
+	return nil
+}
+
+// dataEnd returns where the records of a file of size end, before the
+// zero bytes of the chunk being filled when the process died.
+func dataEnd(file *os.File, size int64) (int64, error) {
+	buf := make([]byte, 64<<10)
+	for size > 0 {
+		n := int64(len(buf))
+		if n > size {
+			n = size
+		}
+		if _, err := file.ReadAt(buf[:n], size-n); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := n - 1; i >= 0; i-- {
+			if buf[i] != 0 {
+				return size - n + i + 1, nil
+			}
+		}
+		size -= n
+	}
+	return 0, nil
+}
+
+// mapChunk maps a chunk of the file from base on, growing the file to
+// hold it.
+func (this *mmapSink) mapChunk(base int64) error {
+	if err := this.unmap(); err != nil {
+		return err
+	}
+	end := base + this.config.ChunkSize
+	if info, err := this.file.Stat(); err != nil {
+		return err
+	} else if info.Size() < end {
+		if err := this.file.Truncate(end); err != nil {
+			return err
+		}
+	}
+	region, err := mapFile(this.file, base, int(this.config.ChunkSize))
+	if err != nil {
+		return err
+	}
+	this.region, this.base = region, base
+	return nil
+}
+
+func (this *mmapSink) unmap() error {
+	if this.region == nil {
+		return nil
+	}
+	err := unmapFile(this.region)
+	this.region = nil
+	return err
+}
+
+// sync writes the mapped pages back to disk; fsync covers them as well as
+// msync would. It must be called with mu held.
+func (this *mmapSink) sync() error {
+	if this.syncTimer != nil {
+		this.syncTimer.Stop()
+		this.syncTimer = nil
+	}
+	if this.file == nil {
+		return nil
+	}
+	return this.file.Sync()
+}
+
+func (this *mmapSink) syncLater() {
+	this.mu.Lock()
+	this.syncTimer = nil
+	this.sync()
+	this.mu.Unlock()
+}
+
+// closeFile unmaps the file and cuts it to its records. It must be called
+// with mu held.
+func (this *mmapSink) closeFile() error {
+	if this.file == nil {
+		return nil
+	}
+	err := this.sync()
+	if uerr := this.unmap(); err == nil {
+		err = uerr
+	}
+	if terr := this.file.Truncate(this.size); err == nil {
+		err = terr
+	}
+	if cerr := this.file.Close(); err == nil {
+		err = cerr
+	}
+	this.file = nil
+	return err
+}
+
+// rotate renames the file with a timestamp and starts a new one.
+func (this *mmapSink) rotate() error {
+	if err := this.closeFile(); err != nil {
+		return err
+	}
+	stamped := this.config.Path + "." + time.Now().Format("20060102-150405")
+	rotated := stamped
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(rotated); os.IsNotExist(err) {
+			break
+		}
+		rotated = stamped + "." + strconv.Itoa(i)
+	}
+	if err := os.Rename(this.config.Path, rotated); err != nil {
+		return err
+	}
+	return this.open()
+}
+
+func (this *mmapSink) Write(r *Record) (err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.file == nil {
+		if err := this.open(); err != nil {
+			return err
+		}
+	}
+
+	data := this.format(r)
+	if this.config.MaxSize > 0 && this.size > 0 && this.size+int64(len(data)) > this.config.MaxSize {
+		if err := this.rotate(); err != nil {
+			return err
+		}
+	}
+
+	// Touching a page the filesystem has no room for raises SIGBUS; make
+	// it an error rather than a crash.
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if p := recover(); p != nil {
+			this.closeFile()
+			err = fmt.Errorf("Memory mapped log file: %v", p)
+		}
+	}()
+
+	for len(data) > 0 {
+		pos := this.size - this.base
+		if pos == int64(len(this.region)) {
+			if err := this.mapChunk(this.base + pos); err != nil {
+				return err
+			}
+			pos = 0
+		}
+		n := copy(this.region[pos:], data)
+		data = data[n:]
+		this.size += int64(n)
+	}
+
+	if this.config.SyncInterval > 0 && this.syncTimer == nil {
+		this.syncTimer = time.AfterFunc(this.config.SyncInterval, this.syncLater)
+	}
+	return nil
+}
+
+// Reopen closes the file; the next record opens Path again.
+func (this *mmapSink) Reopen() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.closeFile()
+}
+
+func (this *mmapSink) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.closeFile()
+}
@@ -0,0 +1,86 @@
+package kslog
+
+import "sync/atomic"
+
+// moduleLevels are the levels of the modules SetModuleLevel was called
+// for; verbosest is the most verbose of them.
+type moduleLevels struct {
+	levels    map[string]Level
+	verbosest Level
+}
+
+// SetModuleLevel sets the most verbose level logged for module, in place
+// of the logger's level, e.g. to debug one module of a busy service.
+func (this *logger) SetModuleLevel(module string, level Level) {
+	this.setModuleLevel(module, &level)
+}
+
+// ClearModuleLevel makes module follow the logger's level again.
+func (this *logger) ClearModuleLevel(module string) {
+	this.setModuleLevel(module, nil)
+}
+
+// ModuleLevels returns the levels SetModuleLevel set by module.
+func (this *logger) ModuleLevels() map[string]Level {
+	levels := make(map[string]Level)
+	if ml := this.modules.Load(); ml != nil {
+		for module, level := range ml.levels {
+			levels[module] = level
+		}
+	}
+	return levels
+}
+
+// setModuleLevel replaces the module levels with a copy that sets, or
+// with a nil level clears, the level of module.
+func (this *logger) setModuleLevel(module string, level *Level) {
+	this.modulesMu.Lock()
+	defer this.modulesMu.Unlock()
+
+	levels := this.ModuleLevels()
+	if level != nil {
+		levels[module] = *level
+	} else {
+		delete(levels, module)
+	}
+	if len(levels) == 0 {
+		this.modules.Store(nil)
+		return
+	}
+	ml := &moduleLevels{levels: levels}
+	for _, l := range levels {
+		if l > ml.verbosest {
+			ml.verbosest = l
+		}
+	}
+	this.modules.Store(ml)
+}
+
+// moduleEnabled reports whether a record of module at level would reach
+// any sink.
+func (this *logger) moduleEnabled(level Level, module string) bool {
+	ml := this.modules.Load()
+	if ml == nil {
+		return this.enabled(level)
+	}
+	limit, ok := ml.levels[module]
+	if !ok {
+		limit = Level(atomic.LoadInt32(&this.level))
+	}
+	return limit >= level && atomic.LoadInt32(&this.verbosest) >= int32(level)
+}
+
+// SetModuleLevel sets the level of module in the default logger.
+func SetModuleLevel(module string, level Level) {
+	logging.SetModuleLevel(module, level)
+}
+
+// ClearModuleLevel clears the level of module in the default logger.
+func ClearModuleLevel(module string) {
+	logging.ClearModuleLevel(module)
+}
+
+// ModuleLevels returns the module levels of the default logger.
+func ModuleLevels() map[string]Level {
+	return logging.ModuleLevels()
+}
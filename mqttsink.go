@@ -0,0 +1,266 @@
+package kslog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	mqttKeepAlive = 60 * time.Second
+	mqttTimeout   = 10 * time.Second
+)
+
+// MQTT control packet types.
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttPubrec     = 5
+	mqttPubrel     = 6
+	mqttPubcomp    = 7
+	mqttDisconnect = 14
+)
+
+// MQTTSinkConfig configures an MQTTSink.
+type MQTTSinkConfig struct {
+	// Addr is the host:port of the broker.
+	Addr     string
+	Username string
+	Password string
+	TLS      *tls.Config
+	// DeviceID identifies the device; it defaults to the host name and is
+	// used in the client ID and the default topic.
+	DeviceID string
+	// Topic defaults to kslog/<device>/<program>.
+	Topic string
+	// QoS is the MQTT quality of service, 0, 1 or 2.
+	QoS byte
+	// Buffer is how many records are kept while the broker can't be
+	// reached, 10000 by default; past that the oldest are dropped.
+	Buffer int
+	// BatchSize and FlushInterval default to 100 and 1s.
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// MQTTSink publishes JSON encoded records to an MQTT 3.1.1 broker. While
+// the broker is unreachable records are buffered and publishing is retried
+// until the sink is closed.
+type MQTTSink struct {
+	config   MQTTSinkConfig
+	conn     net.Conn
+	reader   *bufio.Reader
+	lastSent time.Time
+	packetID uint16
+	batch    *batcher
+}
+
+// NewMQTTSink returns a sink publishing to the broker at config.Addr.
+func NewMQTTSink(config MQTTSinkConfig) (*MQTTSink, error) {
+	if config.QoS > 2 {
+		return nil, errors.New("MQTT QoS must be 0, 1 or 2")
+	}
+	if config.DeviceID == "" {
+		config.DeviceID, _ = os.Hostname()
+	}
+	if config.Topic == "" {
+		config.Topic = "kslog/" + config.DeviceID + "/" + getProgram()
+	}
+	if config.Buffer <= 0 {
+		config.Buffer = 10000
+	}
+
+	s := &MQTTSink{config: config}
+	s.batch = newBatcher(config.BatchSize, config.FlushInterval, RetryForever, s.flush, nil)
+	s.batch.setLimit(config.Buffer)
+	return s, nil
+}
+
+func (this *MQTTSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *MQTTSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *MQTTSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close publishes what is still pending, if the broker is reachable, and
+// disconnects.
+func (this *MQTTSink) Close() error {
+	this.batch.close()
+	if this.conn != nil {
+		this.conn.Write([]byte{mqttDisconnect << 4, 0})
+		this.disconnect()
+	}
+	return nil
+}
+
+func mqttString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func mqttPacket(w io.Writer, header byte, body []byte) error {
+	packet := binary.AppendUvarint([]byte{header}, uint64(len(body)))
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+// readPacket returns the type and body of the next packet.
+func (this *MQTTSink) readPacket() (byte, []byte, error) {
+	header, err := this.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	size, err := binary.ReadUvarint(this.reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(this.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+func (this *MQTTSink) connect() error {
+	dialer := &net.Dialer{Timeout: netDialTimeout}
+	var conn net.Conn
+	var err error
+	if this.config.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", this.config.Addr, this.config.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", this.config.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	this.conn = conn
+	this.reader = bufio.NewReader(conn)
+
+	flags := byte(0x02) // clean session
+	if this.config.Username != "" {
+		flags |= 0x80
+	}
+	if this.config.Password != "" {
+		flags |= 0x40
+	}
+	body := mqttString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(mqttKeepAlive/time.Second))
+	body = mqttString(body, "kslog-"+this.config.DeviceID)
+	if this.config.Username != "" {
+		body = mqttString(body, this.config.Username)
+	}
+	if this.config.Password != "" {
+		body = mqttString(body, this.config.Password)
+	}
+
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+	if err := mqttPacket(conn, mqttConnect<<4, body); err != nil {
+		this.disconnect()
+		return err
+	}
+	kind, ack, err := this.readPacket()
+	if err == nil && (kind != mqttConnack || len(ack) != 2) {
+		err = errors.New("MQTT: expected CONNACK")
+	}
+	if err == nil && ack[1] != 0 {
+		err = errors.New("MQTT: connection refused, code " + strconv.Itoa(int(ack[1])))
+	}
+	if err != nil {
+		this.disconnect()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+	this.lastSent = time.Now()
+	return nil
+}
+
+func (this *MQTTSink) disconnect() {
+	this.conn.Close()
+	this.conn = nil
+	this.reader = nil
+}
+
+func (this *MQTTSink) flush(records []*Record) error {
+	// Nothing is sent between batches, so a connection idle for longer
+	// than the keep alive may have been dropped by the broker.
+	if this.conn != nil && time.Since(this.lastSent) > mqttKeepAlive {
+		this.disconnect()
+	}
+	if this.conn == nil {
+		if err := this.connect(); err != nil {
+			return err
+		}
+	}
+
+	this.conn.SetDeadline(time.Now().Add(mqttTimeout))
+	err := this.publish(records)
+	if err != nil {
+		this.disconnect()
+		return err
+	}
+	this.conn.SetDeadline(time.Time{})
+	this.lastSent = time.Now()
+	return nil
+}
+
+// publish sends records and, above QoS 0, waits for the broker to
+// acknowledge every one of them.
+func (this *MQTTSink) publish(records []*Record) error {
+	qos := this.config.QoS
+	w := bufio.NewWriter(this.conn)
+	pending := make(map[uint16]bool)
+
+	for _, r := range records {
+		body := mqttString(nil, this.config.Topic)
+		if qos > 0 {
+			if this.packetID++; this.packetID == 0 {
+				this.packetID = 1
+			}
+			body = binary.BigEndian.AppendUint16(body, this.packetID)
+			pending[this.packetID] = true
+		}
+		body = append(body, encodeJSON(r)...)
+		mqttPacket(w, mqttPublish<<4|qos<<1, body)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for len(pending) > 0 {
+		kind, body, err := this.readPacket()
+		if err != nil {
+			return err
+		}
+		if len(body) < 2 {
+			continue
+		}
+		id := binary.BigEndian.Uint16(body)
+
+		switch kind {
+		case mqttPuback, mqttPubcomp:
+			delete(pending, id)
+		case mqttPubrec:
+			if err := mqttPacket(this.conn, mqttPubrel<<4|0x02, body[:2]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package kslog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// msgpackWriter is a minimal MessagePack encoder covering the types that
+// show up in records. Anything else is written as its fmt %v string.
+type msgpackWriter struct {
+	buf []byte
+}
+
+func (this *msgpackWriter) bytes() []byte {
+	return this.buf
+}
+
+func (this *msgpackWriter) writeNil() {
+	this.buf = append(this.buf, 0xc0)
+}
+
+func (this *msgpackWriter) writeBool(v bool) {
+	if v {
+		this.buf = append(this.buf, 0xc3)
+	} else {
+		this.buf = append(this.buf, 0xc2)
+	}
+}
+
+func (this *msgpackWriter) writeInt(v int64) {
+	switch {
+	case v >= 0:
+		this.writeUint(uint64(v))
+	case v >= -32:
+		this.buf = append(this.buf, byte(v))
+	case v >= math.MinInt8:
+		this.buf = append(this.buf, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		this.buf = append(this.buf, 0xd1)
+		this.buf = binary.BigEndian.AppendUint16(this.buf, uint16(v))
+	case v >= math.MinInt32:
+		this.buf = append(this.buf, 0xd2)
+		this.buf = binary.BigEndian.AppendUint32(this.buf, uint32(v))
+	default:
+		this.buf = append(this.buf, 0xd3)
+		this.buf = binary.BigEndian.AppendUint64(this.buf, uint64(v))
+	}
+}
+
+func (this *msgpackWriter) writeUint(v uint64) {
+	switch {
+	case v < 128:
+		this.buf = append(this.buf, byte(v))
+	case v <= math.MaxUint8:
+		this.buf = append(this.buf, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		this.buf = append(this.buf, 0xcd)
+		this.buf = binary.BigEndian.AppendUint16(this.buf, uint16(v))
+	case v <= math.MaxUint32:
+		this.buf = append(this.buf, 0xce)
+		this.buf = binary.BigEndian.AppendUint32(this.buf, uint32(v))
+	default:
+		this.buf = append(this.buf, 0xcf)
+		this.buf = binary.BigEndian.AppendUint64(this.buf, v)
+	}
+}
+
+func (this *msgpackWriter) writeFloat(v float64) {
+	this.buf = append(this.buf, 0xcb)
+	this.buf = binary.BigEndian.AppendUint64(this.buf, math.Float64bits(v))
+}
+
+func (this *msgpackWriter) writeString(v string) {
+	n := len(v)
+	switch {
+	case n < 32:
+		this.buf = append(this.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		this.buf = append(this.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		this.buf = append(this.buf, 0xda)
+		this.buf = binary.BigEndian.AppendUint16(this.buf, uint16(n))
+	default:
+		this.buf = append(this.buf, 0xdb)
+		this.buf = binary.BigEndian.AppendUint32(this.buf, uint32(n))
+	}
+	this.buf = append(this.buf, v...)
+}
+
+func (this *msgpackWriter) writeBinary(v []byte) {
+	n := len(v)
+	switch {
+	case n <= math.MaxUint8:
+		this.buf = append(this.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		this.buf = append(this.buf, 0xc5)
+		this.buf = binary.BigEndian.AppendUint16(this.buf, uint16(n))
+	default:
+		this.buf = append(this.buf, 0xc6)
+		this.buf = binary.BigEndian.AppendUint32(this.buf, uint32(n))
+	}
+	this.buf = append(this.buf, v...)
+}
+
+func (this *msgpackWriter) writeArrayHeader(n int) {
+	switch {
+	case n < 16:
+		this.buf = append(this.buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		this.buf = append(this.buf, 0xdc)
+		this.buf = binary.BigEndian.AppendUint16(this.buf, uint16(n))
+	default:
+		this.buf = append(this.buf, 0xdd)
+		this.buf = binary.BigEndian.AppendUint32(this.buf, uint32(n))
+	}
+}
+
+func (this *msgpackWriter) writeMapHeader(n int) {
+	switch {
+	case n < 16:
+		this.buf = append(this.buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		this.buf = append(this.buf, 0xde)
+		this.buf = binary.BigEndian.AppendUint16(this.buf, uint16(n))
+	default:
+		this.buf = append(this.buf, 0xdf)
+		this.buf = binary.BigEndian.AppendUint32(this.buf, uint32(n))
+	}
+}
+
+// writeEventTime writes t as a fluentd EventTime (ext type 0).
+func (this *msgpackWriter) writeEventTime(t time.Time) {
+	this.buf = append(this.buf, 0xd7, 0x00)
+	this.buf = binary.BigEndian.AppendUint32(this.buf, uint32(t.Unix()))
+	this.buf = binary.BigEndian.AppendUint32(this.buf, uint32(t.Nanosecond()))
+}
+
+func (this *msgpackWriter) writeValue(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		this.writeNil()
+	case bool:
+		this.writeBool(v)
+	case int:
+		this.writeInt(int64(v))
+	case int8:
+		this.writeInt(int64(v))
+	case int16:
+		this.writeInt(int64(v))
+	case int32:
+		this.writeInt(int64(v))
+	case int64:
+		this.writeInt(v)
+	case uint:
+		this.writeUint(uint64(v))
+	case uint8:
+		this.writeUint(uint64(v))
+	case uint16:
+		this.writeUint(uint64(v))
+	case uint32:
+		this.writeUint(uint64(v))
+	case uint64:
+		this.writeUint(v)
+	case float32:
+		this.writeFloat(float64(v))
+	case float64:
+		this.writeFloat(v)
+	case string:
+		this.writeString(v)
+	case []byte:
+		this.writeBinary(v)
+	case []interface{}:
+		this.writeArrayHeader(len(v))
+		for _, e := range v {
+			this.writeValue(e)
+		}
+	case map[string]interface{}:
+		this.writeMapHeader(len(v))
+		for k, e := range v {
+			this.writeString(k)
+			this.writeValue(e)
+		}
+	case error:
+		this.writeString(v.Error())
+	default:
+		this.writeString(fmt.Sprintf("%v", v))
+	}
+}
+
+// readMsgpackStringMap decodes a map of string keys to string values, which
+// is all fluentd sends back. Values of other types are skipped.
+func readMsgpackStringMap(r *bufio.Reader) (map[string]string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	switch {
+	case b&0xf0 == 0x80:
+		n = int(b & 0x0f)
+	case b == 0xde:
+		var v uint16
+		err = binary.Read(r, binary.BigEndian, &v)
+		n = int(v)
+	case b == 0xdf:
+		var v uint32
+		err = binary.Read(r, binary.BigEndian, &v)
+		n = int(v)
+	default:
+		return nil, errors.New("Msgpack: expected a map")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		k, err := readMsgpackString(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readMsgpackString(r)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func readMsgpackString(r *bufio.Reader) (string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	var n int
+	switch {
+	case b&0xe0 == 0xa0:
+		n = int(b & 0x1f)
+	case b == 0xd9:
+		var v uint8
+		err = binary.Read(r, binary.BigEndian, &v)
+		n = int(v)
+	case b == 0xda:
+		var v uint16
+		err = binary.Read(r, binary.BigEndian, &v)
+		n = int(v)
+	case b == 0xdb:
+		var v uint32
+		err = binary.Read(r, binary.BigEndian, &v)
+		n = int(v)
+	default:
+		return "", errors.New("Msgpack: expected a string")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
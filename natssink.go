@@ -0,0 +1,295 @@
+package kslog
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const natsTimeout = 10 * time.Second
+
+// NATSSinkConfig configures a NATSSink.
+type NATSSinkConfig struct {
+	// Addr is the host:port of a NATS server.
+	Addr string
+	// Token, or User and Password, authenticate the connection.
+	Token    string
+	User     string
+	Password string
+	// TLS is used when set or when the server requires TLS.
+	TLS *tls.Config
+	// SubjectPrefix defaults to "kslog"; records are published to
+	// <prefix>.<program>.<module>.
+	SubjectPrefix string
+	// JetStream waits for the stream's acknowledgement of every record,
+	// retrying those that were not stored. A stream must capture the
+	// subjects.
+	JetStream bool
+	// BatchSize, FlushInterval and MaxRetries default to 100, 1s and 3;
+	// see NoRetries and RetryForever.
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+}
+
+// NATSSink publishes JSON encoded records to NATS subjects derived from
+// the program and module.
+type NATSSink struct {
+	config NATSSinkConfig
+	conn   net.Conn
+	reader *bufio.Reader
+	inbox  string
+	batch  *batcher
+}
+
+// NewNATSSink returns a sink publishing to the server at config.Addr.
+func NewNATSSink(config NATSSinkConfig) *NATSSink {
+	if config.SubjectPrefix == "" {
+		config.SubjectPrefix = "kslog"
+	}
+
+	s := &NATSSink{config: config}
+	s.batch = newBatcher(config.BatchSize, config.FlushInterval, config.MaxRetries, s.flush, nil)
+	return s
+}
+
+func (this *NATSSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *NATSSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *NATSSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close publishes what is still pending and closes the connection.
+func (this *NATSSink) Close() error {
+	this.batch.close()
+	if this.conn != nil {
+		this.disconnect()
+	}
+	return nil
+}
+
+// natsToken makes s usable as a single subject token.
+func natsToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n', '*', '>', '.':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func (this *NATSSink) subject(r *Record) string {
+	return this.config.SubjectPrefix + "." + natsToken(getProgram()) + "." + natsToken(r.Module)
+}
+
+func (this *NATSSink) connect() error {
+	conn, err := net.DialTimeout("tcp", this.config.Addr, netDialTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	reader := bufio.NewReader(conn)
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return errors.New("NATS: expected INFO, got " + strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(line[5:]), &info)
+
+	if info.TLSRequired || this.config.TLS != nil {
+		config := this.config.TLS
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName, _, _ = net.SplitHostPort(this.config.Addr)
+		}
+		tconn := tls.Client(conn, config)
+		if err := tconn.Handshake(); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tconn
+		reader = bufio.NewReader(conn)
+	}
+
+	opts := map[string]interface{}{
+		"verbose":      false,
+		"pedantic":     false,
+		"name":         getProgram(),
+		"lang":         "go",
+		"version":      "1.0",
+		"protocol":     1,
+		"tls_required": info.TLSRequired || this.config.TLS != nil,
+	}
+	if this.config.Token != "" {
+		opts["auth_token"] = this.config.Token
+	}
+	if this.config.User != "" {
+		opts["user"] = this.config.User
+		opts["pass"] = this.config.Password
+	}
+	connect, _ := json.Marshal(opts)
+
+	this.conn = conn
+	this.reader = reader
+	cmd := "CONNECT " + string(connect) + "\r\n"
+	if this.config.JetStream {
+		id := make([]byte, 8)
+		rand.Read(id)
+		this.inbox = "_INBOX." + hex.EncodeToString(id)
+		cmd += "SUB " + this.inbox + ".* 1\r\n"
+	}
+	if _, err := io.WriteString(conn, cmd+"PING\r\n"); err != nil {
+		this.disconnect()
+		return err
+	}
+	if _, err := this.await(0); err != nil {
+		this.disconnect()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+	return nil
+}
+
+func (this *NATSSink) disconnect() {
+	this.conn.Close()
+	this.conn = nil
+	this.reader = nil
+}
+
+// await reads until the server's PONG and, with JetStream, until acks
+// replies have arrived. It returns which replies reported a failure.
+func (this *NATSSink) await(acks int) (map[int]bool, error) {
+	failed := make(map[int]bool)
+	pong := false
+
+	for !pong || acks > 0 {
+		line, err := this.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "PING":
+			if _, err := io.WriteString(this.conn, "PONG\r\n"); err != nil {
+				return nil, err
+			}
+		case line == "PONG":
+			pong = true
+		case strings.HasPrefix(line, "-ERR"):
+			return nil, errors.New("NATS: " + line)
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply] <size>
+			fields := strings.Fields(line)
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return nil, errors.New("NATS: bad MSG line")
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(this.reader, payload); err != nil {
+				return nil, err
+			}
+
+			index, err := strconv.Atoi(fields[1][strings.LastIndex(fields[1], ".")+1:])
+			if err != nil {
+				continue
+			}
+			var ack struct {
+				Error *struct {
+					Description string `json:"description"`
+				} `json:"error"`
+			}
+			if json.Unmarshal(payload[:size], &ack) != nil || ack.Error != nil {
+				failed[index] = true
+			}
+			acks--
+		}
+	}
+	return failed, nil
+}
+
+func (this *NATSSink) flush(records []*Record) error {
+	if this.conn == nil {
+		if err := this.connect(); err != nil {
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(this.conn)
+	for i, r := range records {
+		payload := encodeJSON(r)
+		if this.config.JetStream {
+			fmt.Fprintf(w, "PUB %s %s.%d %d\r\n", this.subject(r), this.inbox, i, len(payload))
+		} else {
+			fmt.Fprintf(w, "PUB %s %d\r\n", this.subject(r), len(payload))
+		}
+		w.Write(payload)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("PING\r\n")
+
+	this.conn.SetDeadline(time.Now().Add(natsTimeout))
+	defer func() {
+		if this.conn != nil {
+			this.conn.SetDeadline(time.Time{})
+		}
+	}()
+
+	if err := w.Flush(); err != nil {
+		this.disconnect()
+		return err
+	}
+
+	acks := 0
+	if this.config.JetStream {
+		acks = len(records)
+	}
+	failed, err := this.await(acks)
+	if err != nil {
+		this.disconnect()
+		return err
+	}
+
+	if len(failed) > 0 {
+		var retry []*Record
+		for i := range records {
+			if failed[i] {
+				retry = append(retry, records[i])
+			}
+		}
+		return partialError{fmt.Errorf("NATS: JetStream rejected %d records", len(retry)), retry, false, nil}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package kslog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	netDialTimeout  = 5 * time.Second
+	netWriteTimeout = 10 * time.Second
+	netMinBackoff   = 100 * time.Millisecond
+	netMaxBackoff   = 30 * time.Second
+)
+
+// NetSink streams records to a remote collector over tcp or udp, one line
+// per record. Records are queued in a bounded buffer and sent from a
+// separate goroutine, which reconnects with exponential backoff whenever
+// the connection is lost or a write fails, or takes longer than the write
+// timeout. When the buffer is full the oldest records are dropped. Over udp, records are truncated to what a
+// datagram holds; a datagram the socket refuses as too long is dropped.
+type NetSink struct {
+	dial   func() (net.Conn, error)
+	format Formatter
+
+	mu      sync.Mutex
+	pending [][]byte
+	limit   int
+	dropped uint64
+	// timeout is the write timeout, see SetWriteTimeout.
+	timeout atomic.Int64
+
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	exit      chan struct{}
+}
+
+// NewNetSink returns a sink sending to addr over network ("tcp", "udp", ...),
+// buffering up to bufsize records while the collector is unreachable.
+func NewNetSink(network, addr string, bufsize int) *NetSink {
+	return newNetSink(bufsize, func() (net.Conn, error) {
+		return net.DialTimeout(network, addr, netDialTimeout)
+	})
+}
+
+func newNetSink(bufsize int, dial func() (net.Conn, error)) *NetSink {
+	if bufsize < 1 {
+		bufsize = 1
+	}
+
+	s := &NetSink{
+		dial:   dial,
+		format: TextFormatter,
+		limit:  bufsize,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		exit:   make(chan struct{}),
+	}
+	s.timeout.Store(int64(netWriteTimeout))
+	go s.sendLoop()
+	return s
+}
+
+// SetWriteTimeout sets how long a write may take before the connection is
+// given up and the records are sent again on a new one, 10 seconds by
+// default, so that a stalled collector can't hold the sink up; 0 waits
+// forever.
+func (this *NetSink) SetWriteTimeout(d time.Duration) {
+	this.timeout.Store(int64(d))
+}
+
+func (this *NetSink) Write(r *Record) error {
+	this.push(this.format(r))
+	return nil
+}
+
+// Dropped returns how many records were discarded because the buffer was full.
+func (this *NetSink) Dropped() uint64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.dropped
+}
+
+// Close stops the sender, making one last attempt to deliver what is buffered.
+func (this *NetSink) Close() error {
+	this.closeOnce.Do(func() { close(this.done) })
+	<-this.exit
+	return nil
+}
+
+func (this *NetSink) push(line []byte) {
+	this.mu.Lock()
+	if len(this.pending) >= this.limit {
+		this.pending = this.pending[1:]
+		this.dropped++
+	}
+	this.pending = append(this.pending, line)
+	this.mu.Unlock()
+
+	select {
+	case this.wake <- struct{}{}:
+	default:
+	}
+}
+
+// requeue puts lines that could not be sent back in front of the buffer.
+func (this *NetSink) requeue(lines [][]byte) {
+	this.mu.Lock()
+	pending := append(lines, this.pending...)
+	if over := len(pending) - this.limit; over > 0 {
+		pending = pending[over:]
+		this.dropped += uint64(over)
+	}
+	this.pending = pending
+	this.mu.Unlock()
+}
+
+func (this *NetSink) take() [][]byte {
+	this.mu.Lock()
+	lines := this.pending
+	this.pending = nil
+	this.mu.Unlock()
+	return lines
+}
+
+func (this *NetSink) sendLoop() {
+	var conn net.Conn
+	backoff := netMinBackoff
+
+	defer close(this.exit)
+
+	for {
+		closing := false
+		select {
+		case <-this.wake:
+		case <-this.done:
+			closing = true
+		}
+
+		for {
+			lines := this.take()
+			if len(lines) == 0 {
+				break
+			}
+
+			if conn == nil {
+				var err error
+				conn, err = this.dial()
+				if err != nil {
+					conn = nil
+					this.requeue(lines)
+					if closing {
+						return
+					}
+					closing = this.sleep(backoff)
+					if backoff *= 2; backoff > netMaxBackoff {
+						backoff = netMaxBackoff
+					}
+					continue
+				}
+			}
+
+			if timeout := time.Duration(this.timeout.Load()); timeout > 0 {
+				conn.SetWriteDeadline(time.Now().Add(timeout))
+			} else {
+				conn.SetWriteDeadline(time.Time{})
+			}
+			sent, err := sendLines(conn, lines)
+			switch {
+			case err == nil:
+				backoff = netMinBackoff
+			case tooLong(err):
+				// The datagram can't be sent, however often it is tried.
+				this.mu.Lock()
+				this.dropped++
+				this.mu.Unlock()
+				notifyError(fmt.Errorf("Net sink: dropped a record of %d bytes: %w", len(lines[sent]), err))
+				this.requeue(lines[sent+1:])
+			default:
+				notifyError(fmt.Errorf("Net sink: %w", err))
+				conn.Close()
+				conn = nil
+				this.requeue(lines[sent:])
+				if closing {
+					return
+				}
+				closing = this.sleep(backoff)
+				if backoff *= 2; backoff > netMaxBackoff {
+					backoff = netMaxBackoff
+				}
+			}
+		}
+
+		if closing {
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// sleep waits for d, returning early, with true, when the sink is closed.
+func (this *NetSink) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return false
+	case <-this.done:
+		return true
+	}
+}
+
+// maxDatagram is the most a UDP datagram holds; longer records are
+// truncated.
+const maxDatagram = 65507
+
+// tooLong tells whether err is a datagram being too long for the socket.
+func tooLong(err error) bool {
+	var errno syscall.Errno
+	// 10040 is WSAEMSGSIZE, what Windows returns instead.
+	return errors.As(err, &errno) && (errno == syscall.EMSGSIZE || errno == 10040)
+}
+
+// sendChunk is how much sendLines copies together for one write.
+const sendChunk = 64 << 10
+
+// sendLines writes lines to conn, one datagram each on packet connections.
+// On streams they are coalesced, with writev on plain sockets and through
+// a buffer on others, like TLS, instead of taking a write each. It returns
+// how many lines were written in full. Lines too long for a UDP datagram
+// are truncated.
+func sendLines(conn net.Conn, lines [][]byte) (int, error) {
+	if addr := conn.LocalAddr(); addr != nil {
+		if network := addr.Network(); strings.HasPrefix(network, "udp") || network == "unixgram" {
+			for i, line := range lines {
+				if len(line) > maxDatagram && network != "unixgram" {
+					notifyError(fmt.Errorf("Net sink: truncated a record of %d bytes to %d", len(line), maxDatagram))
+					line = line[:maxDatagram]
+				}
+				if _, err := conn.Write(line); err != nil {
+					return i, err
+				}
+			}
+			return len(lines), nil
+		}
+	}
+
+	var n int64
+	var err error
+	switch conn.(type) {
+	case *net.TCPConn, *net.UnixConn:
+		// WriteTo consumes the buffers it is given, leave lines alone.
+		bufs := append(net.Buffers(nil), lines...)
+		n, err = bufs.WriteTo(conn)
+	default:
+		buf := make([]byte, 0, sendChunk)
+		for i, line := range lines {
+			buf = append(buf, line...)
+			if len(buf) < sendChunk && i < len(lines)-1 {
+				continue
+			}
+			var w int
+			w, err = conn.Write(buf)
+			n += int64(w)
+			if err != nil {
+				break
+			}
+			buf = buf[:0]
+		}
+	}
+	if err == nil {
+		return len(lines), nil
+	}
+
+	for i, line := range lines {
+		if n < int64(len(line)) {
+			return i, err
+		}
+		n -= int64(len(line))
+	}
+	return len(lines), err
+}
+
+// NewUnixSink returns a sink writing to the Unix domain socket at path,
+// as a stream ("unix") or, when datagram is set, one datagram per record
+// ("unixgram").
+func NewUnixSink(path string, datagram bool, bufsize int) *NetSink {
+	network := "unix"
+	if datagram {
+		network = "unixgram"
+	}
+	return NewNetSink(network, path, bufsize)
+}
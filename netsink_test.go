@@ -0,0 +1,152 @@
+package kslog
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readDatagrams returns the datagrams conn receives until timeout passes
+// without one.
+func readDatagrams(conn net.PacketConn, timeout time.Duration) [][]byte {
+	var got [][]byte
+	buf := make([]byte, 1<<20)
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return got
+		}
+		got = append(got, append([]byte(nil), buf[:n]...))
+	}
+}
+
+func TestNetSinkLongDatagram(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+
+	var dials atomic.Int32
+	addr := conn.LocalAddr().String()
+	s := newNetSink(10, func() (net.Conn, error) {
+		dials.Add(1)
+		return net.Dial("udp", addr)
+	})
+	s.Write(&Record{Message: strings.Repeat("x", 100<<10), Level: INFO})
+	s.Write(&Record{Message: "after", Level: INFO})
+	got := readDatagrams(conn, 500*time.Millisecond)
+	s.Close()
+
+	if len(got) != 2 {
+		t.Fatalf("got %d datagrams, want 2", len(got))
+	}
+	if len(got[0]) != maxDatagram {
+		t.Errorf("got a datagram of %d bytes, want it truncated to %d", len(got[0]), maxDatagram)
+	}
+	if !bytes.Contains(got[1], []byte("after")) {
+		t.Errorf("got %q, want the record after the long one", got[1])
+	}
+	if n := dials.Load(); n != 1 {
+		t.Errorf("dialed %d times, want 1", n)
+	}
+}
+
+func TestNetSinkUnixgramTooLong(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	defer os.Remove(path)
+
+	var dials atomic.Int32
+	s := newNetSink(10, func() (net.Conn, error) {
+		dials.Add(1)
+		return net.Dial("unixgram", path)
+	})
+	var errs atomic.Int32
+	SetErrorHandler(func(error) { errs.Add(1) })
+	defer SetErrorHandler(nil)
+
+	s.Write(&Record{Message: strings.Repeat("x", 4<<20), Level: INFO})
+	s.Write(&Record{Message: "after", Level: INFO})
+	got := readDatagrams(conn, 500*time.Millisecond)
+	s.Close()
+
+	if len(got) != 1 || !bytes.Contains(got[0], []byte("after")) {
+		t.Fatalf("got %d datagrams, want only the record after the long one", len(got))
+	}
+	if s.Dropped() != 1 || errs.Load() != 1 {
+		t.Errorf("got %d dropped and %d errors, want 1 of each", s.Dropped(), errs.Load())
+	}
+	if n := dials.Load(); n != 1 {
+		t.Errorf("dialed %d times, want 1", n)
+	}
+}
+
+func TestNetSinkWriteBackoff(t *testing.T) {
+	var dials atomic.Int32
+	s := newNetSink(10, func() (net.Conn, error) {
+		dials.Add(1)
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	})
+	s.Write(&Record{Message: "lost", Level: INFO})
+	time.Sleep(300 * time.Millisecond)
+	s.Close()
+
+	// Waiting 100ms, 200ms, ... between attempts, not redialing at once.
+	if n := dials.Load(); n > 4 {
+		t.Errorf("dialed %d times in 300ms", n)
+	}
+}
+
+func TestNetSinkWriteTimeout(t *testing.T) {
+	var errs atomic.Int32
+	SetErrorHandler(func(err error) {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			errs.Add(1)
+		}
+	})
+	defer SetErrorHandler(nil)
+
+	// A collector that never reads.
+	var servers []net.Conn
+	s := newNetSink(10, func() (net.Conn, error) {
+		client, server := net.Pipe()
+		servers = append(servers, server)
+		return client, nil
+	})
+	s.SetWriteTimeout(50 * time.Millisecond)
+	s.Write(&Record{Message: "stuck", Level: INFO})
+	for i := 0; i < 100 && errs.Load() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on the stalled collector")
+	}
+	if errs.Load() == 0 {
+		t.Error("the write didn't time out")
+	}
+	for _, server := range servers {
+		server.Close()
+	}
+}
@@ -0,0 +1,307 @@
+package kslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP transport protocols.
+const (
+	OTLPHTTP = iota
+	OTLPGRPC
+)
+
+const otlpGRPCPath = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+
+// otlpSeverities maps levels to OpenTelemetry SeverityNumber values.
+var otlpSeverities = [MAXLEVEL]uint64{
+	24, // EMERGE: FATAL4
+	22, // ALERT: FATAL2
+	21, // CRIT: FATAL
+	17, // ERROR
+	13, // WARN
+	10, // NOTICE: INFO2
+	9,  // INFO
+	5,  // DEBUG
+	1,  // DEBUG2: TRACE
+}
+
+// OTLPSinkConfig configures an OTLPSink.
+type OTLPSinkConfig struct {
+	// Endpoint is the collector's base URL, e.g. http://otel:4318 for
+	// OTLP/HTTP or http://otel:4317 for OTLP/gRPC. An https URL uses TLS.
+	Endpoint string
+	// Protocol is OTLPHTTP (the default) or OTLPGRPC.
+	Protocol int
+	// Resource attributes describe the process; service.name defaults to
+	// the program name, and host.name and process.pid are always set.
+	Resource map[string]string
+	Header   http.Header
+	TLS      *tls.Config
+	Gzip     bool
+	// BatchSize, FlushInterval and MaxRetries default to 100, 1s and 3;
+	// see NoRetries and RetryForever.
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+}
+
+// OTLPSink exports records to an OpenTelemetry collector as OTLP logs.
+// The level becomes the SeverityNumber, the message the Body and the args
+// the Attributes, alongside kslog.code, code.filepath and code.lineno.
+// Records are grouped into one instrumentation scope per module.
+type OTLPSink struct {
+	config   OTLPSinkConfig
+	url      string
+	client   *http.Client
+	resource protoWriter
+	batch    *batcher
+}
+
+// NewOTLPSink returns a sink exporting to config.Endpoint.
+func NewOTLPSink(config OTLPSinkConfig) (*OTLPSink, error) {
+	endpoint := strings.TrimRight(config.Endpoint, "/")
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, errors.New("OTLP endpoint must be an http or https URL")
+	}
+
+	s := &OTLPSink{config: config, client: newHTTPClient(config.TLS)}
+	switch config.Protocol {
+	case OTLPHTTP:
+		s.url = endpoint + "/v1/logs"
+	case OTLPGRPC:
+		s.url = endpoint + otlpGRPCPath
+		protocols := new(http.Protocols)
+		if strings.HasPrefix(endpoint, "https://") {
+			protocols.SetHTTP2(true)
+		} else {
+			protocols.SetUnencryptedHTTP2(true)
+		}
+		s.client.Transport.(*http.Transport).Protocols = protocols
+	default:
+		return nil, errors.New("Unknown OTLP protocol")
+	}
+
+	resource := map[string]string{"service.name": getProgram(), "process.pid": strconv.Itoa(os.Getpid())}
+	if host, err := os.Hostname(); err == nil {
+		resource["host.name"] = host
+	}
+	for k, v := range config.Resource {
+		resource[k] = v
+	}
+	keys := make([]string, 0, len(resource))
+	for k := range resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s.resource.message(1, otlpKeyValue(k, resource[k]))
+	}
+
+	s.batch = newBatcher(config.BatchSize, config.FlushInterval, config.MaxRetries, s.flush, nil)
+	return s, nil
+}
+
+func (this *OTLPSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *OTLPSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *OTLPSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close exports what is still pending and stops the sink.
+func (this *OTLPSink) Close() error {
+	this.batch.close()
+	return nil
+}
+
+// otlpAnyValue encodes v as an AnyValue message.
+func otlpAnyValue(v interface{}) *protoWriter {
+	m := new(protoWriter)
+	switch v := v.(type) {
+	case string:
+		m.bytes(1, []byte(v))
+	case bool:
+		m.tag(2, 0)
+		if v {
+			m.varint(1)
+		} else {
+			m.varint(0)
+		}
+	case int, int8, int16, int32, int64:
+		m.tag(3, 0)
+		m.varint(uint64(reflect.ValueOf(v).Int()))
+	case uint, uint8, uint16, uint32, uint64:
+		m.tag(3, 0)
+		m.varint(reflect.ValueOf(v).Uint())
+	case float32:
+		m.double(4, float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			m.bytes(1, []byte(fmt.Sprint(v)))
+		} else {
+			m.double(4, v)
+		}
+	case []byte:
+		m.bytes(7, v)
+	default:
+		m.bytes(1, []byte(fmt.Sprintf("%v", v)))
+	}
+	return m
+}
+
+func otlpKeyValue(key string, value interface{}) *protoWriter {
+	kv := new(protoWriter)
+	kv.string(1, key)
+	kv.message(2, otlpAnyValue(value))
+	return kv
+}
+
+func otlpLogRecord(r *Record) *protoWriter {
+	m := new(protoWriter)
+	m.fixed64(1, uint64(r.Time.UnixNano()))
+	if int(r.Level) < len(otlpSeverities) {
+		m.uint(2, otlpSeverities[r.Level])
+	}
+	m.string(3, r.Level.String())
+	m.message(5, otlpAnyValue(r.Message))
+
+	m.message(6, otlpKeyValue("kslog.code", int64(r.Code)))
+	m.message(6, otlpKeyValue("code.filepath", r.File))
+	m.message(6, otlpKeyValue("code.lineno", int64(r.Line)))
+	keys := make([]string, 0, len(r.Args))
+	for k := range r.Args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		m.message(6, otlpKeyValue(k, r.Args[k]))
+	}
+	m.fixed64(11, uint64(time.Now().UnixNano()))
+	return m
+}
+
+// encode builds an ExportLogsServiceRequest for records.
+func (this *OTLPSink) encode(records []*Record) []byte {
+	var modules []string
+	scopes := make(map[string]*protoWriter)
+	for _, r := range records {
+		scope, ok := scopes[r.Module]
+		if !ok {
+			scope = new(protoWriter)
+			name := new(protoWriter)
+			name.string(1, r.Module)
+			scope.message(1, name)
+			scopes[r.Module] = scope
+			modules = append(modules, r.Module)
+		}
+		scope.message(2, otlpLogRecord(r))
+	}
+
+	rl := new(protoWriter)
+	rl.message(1, &this.resource)
+	for _, module := range modules {
+		rl.message(2, scopes[module])
+	}
+
+	req := new(protoWriter)
+	req.message(1, rl)
+	return req.buf
+}
+
+func (this *OTLPSink) flush(records []*Record) error {
+	body := this.encode(records)
+	if this.config.Protocol == OTLPHTTP {
+		return postHTTP(this.client, this.url, "application/x-protobuf", this.config.Header, body, this.config.Gzip)
+	}
+	return this.export(body)
+}
+
+// grpcRetryable lists the gRPC status codes the OTLP specification
+// allows retrying.
+var grpcRetryable = map[string]bool{
+	"1":  true, // CANCELLED
+	"4":  true, // DEADLINE_EXCEEDED
+	"8":  true, // RESOURCE_EXHAUSTED
+	"10": true, // ABORTED
+	"11": true, // OUT_OF_RANGE
+	"14": true, // UNAVAILABLE
+	"15": true, // DATA_LOSS
+}
+
+// export makes a unary gRPC call to the LogsService.
+func (this *OTLPSink) export(body []byte) error {
+	frame := make([]byte, 5, 5+len(body))
+	if this.config.Gzip {
+		buf := new(bytes.Buffer)
+		zw := gzip.NewWriter(buf)
+		zw.Write(body)
+		zw.Close()
+		body = buf.Bytes()
+		frame[0] = 1
+	}
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(body)))
+	frame = append(frame, body...)
+
+	req, err := http.NewRequest("POST", this.url, bytes.NewReader(frame))
+	if err != nil {
+		return permanentError{err}
+	}
+	for k, v := range this.config.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if this.config.Gzip {
+		req.Header.Set("Grpc-Encoding", "gzip")
+	}
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return httpStatusError(resp)
+	}
+
+	// Errors may come as trailers or, without a body, as headers.
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if status == "0" {
+		return nil
+	}
+
+	err = fmt.Errorf("OTLP export: gRPC status %s %s", status, message)
+	if grpcRetryable[status] {
+		return err
+	}
+	return permanentError{err}
+}
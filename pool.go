@@ -0,0 +1,53 @@
+package kslog
+
+import "sync"
+
+// maxPooledArgs is the largest args map kept for reuse.
+const maxPooledArgs = 64
+
+// recordPool recycles records, with their args map and stack, once the
+// sink goroutine is done with them.
+var recordPool = sync.Pool{
+	New: func() interface{} {
+		return &Record{Args: make(map[string]interface{})}
+	},
+}
+
+func newRecord() *Record {
+	r := recordPool.Get().(*Record)
+	if r.Args == nil {
+		r.Args = make(map[string]interface{})
+	}
+	return r
+}
+
+// releaseRecord returns r to the pool. Nothing may use r afterwards.
+func releaseRecord(r *Record) {
+	args := r.Args
+	if len(args) > maxPooledArgs {
+		args = nil
+	} else {
+		clear(args)
+	}
+	*r = Record{Args: args, Stack: r.Stack[:0], fields: r.fields[:0]}
+	recordPool.Put(r)
+}
+
+// Clone returns a deep copy of r. Records are reused once every sink has
+// written them, so a sink that keeps a record past Write keeps a clone.
+func (r *Record) Clone() *Record {
+	c := *r
+	c.flushed = nil
+	c.repeatsDue = false
+	c.fields = nil
+	if r.Args != nil {
+		c.Args = make(map[string]interface{}, len(r.Args))
+		for k, v := range r.Args {
+			c.Args[k] = v
+		}
+	}
+	if r.Stack != nil {
+		c.Stack = append([]uintptr(nil), r.Stack...)
+	}
+	return &c
+}
@@ -0,0 +1,70 @@
+package kslog
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReleaseRecord(t *testing.T) {
+	r := newRecord()
+	r.Message, r.Level = "x", ERROR
+	r.Args["a"] = 1
+	r.Stack = append(r.Stack, 1, 2, 3)
+	releaseRecord(r)
+	if r.Message != "" || r.Level != EMERGE || len(r.Args) != 0 || len(r.Stack) != 0 {
+		t.Errorf("got %+v, want a reset record", r)
+	}
+	if r.Args == nil || cap(r.Stack) < 3 {
+		t.Error("released record lost its args or stack storage")
+	}
+
+	r = newRecord()
+	for i := 0; i <= maxPooledArgs; i++ {
+		r.Args[fmt.Sprint(i)] = i
+	}
+	releaseRecord(r)
+	if r.Args != nil {
+		t.Errorf("kept %d args past maxPooledArgs", maxPooledArgs+1)
+	}
+	if r = newRecord(); r.Args == nil || len(r.Args) != 0 {
+		t.Errorf("got args %v, want an empty map", r.Args)
+	}
+}
+
+func TestRecordClone(t *testing.T) {
+	r := &Record{Message: "x", Args: map[string]interface{}{"a": 1}, Stack: []uintptr{1}}
+	c := r.Clone()
+	c.Args["a"] = 2
+	c.Stack[0] = 2
+	if r.Args["a"] != 1 || r.Stack[0] != 1 {
+		t.Errorf("clone shares storage: %v %v", r.Args, r.Stack)
+	}
+	if c.Message != "x" {
+		t.Errorf("got message %q, want x", c.Message)
+	}
+}
+
+// TestRecordReuse checks that records kept by a sink survive the reuse of
+// the records they were cloned from.
+func TestRecordReuse(t *testing.T) {
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	sink := new(recordSink)
+	l.AddSink(sink)
+
+	module := "test"
+	for i := 0; i < 1000; i++ {
+		message := fmt.Sprintf("record %d", i)
+		l.printex(INFO, &module, 0, &message, "i", i)
+	}
+	l.Flush()
+
+	if len(sink.records) != 1000 {
+		t.Fatalf("got %d records, want 1000", len(sink.records))
+	}
+	for i, r := range sink.records {
+		if want := fmt.Sprintf("record %d", i); r.Message != want || r.Args["i"] != i {
+			t.Fatalf("got %q %v, want %q i=%d", r.Message, r.Args, want, i)
+		}
+	}
+}
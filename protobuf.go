@@ -0,0 +1,76 @@
+package kslog
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// protoWriter appends protocol buffers wire format to buf. Nested
+// messages are encoded into their own protoWriter and added with message.
+type protoWriter struct {
+	buf []byte
+}
+
+func (this *protoWriter) tag(field int, wire byte) {
+	this.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (this *protoWriter) varint(v uint64) {
+	this.buf = binary.AppendUvarint(this.buf, v)
+}
+
+func (this *protoWriter) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	this.tag(field, 0)
+	this.varint(v)
+}
+
+func (this *protoWriter) int(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	this.tag(field, 0)
+	this.varint(uint64(v))
+}
+
+func (this *protoWriter) bool(field int, v bool) {
+	if !v {
+		return
+	}
+	this.tag(field, 0)
+	this.varint(1)
+}
+
+func (this *protoWriter) fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	this.tag(field, 1)
+	this.buf = binary.LittleEndian.AppendUint64(this.buf, v)
+}
+
+func (this *protoWriter) double(field int, v float64) {
+	this.tag(field, 1)
+	this.buf = binary.LittleEndian.AppendUint64(this.buf, math.Float64bits(v))
+}
+
+func (this *protoWriter) bytes(field int, v []byte) {
+	this.tag(field, 2)
+	this.varint(uint64(len(v)))
+	this.buf = append(this.buf, v...)
+}
+
+func (this *protoWriter) string(field int, v string) {
+	if v == "" {
+		return
+	}
+	this.tag(field, 2)
+	this.varint(uint64(len(v)))
+	this.buf = append(this.buf, v...)
+}
+
+func (this *protoWriter) message(field int, m *protoWriter) {
+	this.bytes(field, m.buf)
+}
@@ -0,0 +1,210 @@
+package kslog
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// ringSpins is how many times a producer yields to wait for room before
+// it sleeps.
+const ringSpins = 16
+
+// queue carries records from the logging calls to the sink goroutine.
+// Records may be pushed from any goroutine; they are popped by the sink
+// goroutine and, to drop the oldest, by logging calls.
+type queue interface {
+	// push queues r, waiting for room if wait is set, and reports whether
+	// r was queued.
+	push(r *Record, wait bool) bool
+	// pop removes the oldest record, waiting for one if wait is set, and
+	// returns nil if there is none.
+	pop(wait bool) *Record
+	// size is how many records the queue holds when full, and len how
+	// many it holds now.
+	size() int
+	len() int
+}
+
+// chanQueue is a queue on a buffered channel.
+type chanQueue chan *Record
+
+func (this chanQueue) push(r *Record, wait bool) bool {
+	if wait {
+		this <- r
+		return true
+	}
+	select {
+	case this <- r:
+		return true
+	default:
+		return false
+	}
+}
+
+func (this chanQueue) pop(wait bool) *Record {
+	if wait {
+		return <-this
+	}
+	select {
+	case r := <-this:
+		return r
+	default:
+		return nil
+	}
+}
+
+func (this chanQueue) size() int {
+	return cap(this)
+}
+
+func (this chanQueue) len() int {
+	return len(this)
+}
+
+// ringSlot holds one record of a ringQueue. Its seq tells whose turn it
+// is: the slot is free for the push of position seq, and holds the record
+// of position seq-1.
+type ringSlot struct {
+	seq atomic.Uint64
+	r   *Record
+}
+
+// ringQueue is a bounded lock-free queue on a ring of slots, after Dmitry
+// Vyukov's. Producers claim a position with a compare and swap on head
+// and don't contend on anything else; only the sink goroutine has to be
+// woken up, when it waits for records, and producers that wait for room.
+type ringQueue struct {
+	slots []ringSlot
+	mask  uint64
+	// head, the next position to push, and tail, the next to pop, are
+	// kept on cache lines of their own.
+	_    [64]byte
+	head atomic.Uint64
+	_    [64]byte
+	tail atomic.Uint64
+	_    [64]byte
+	// sleeping is set while the sink goroutine waits on ready, waiting
+	// counts producers waiting on room.
+	sleeping atomic.Bool
+	ready    chan struct{}
+	waiting  atomic.Int32
+	room     chan struct{}
+}
+
+// newRingQueue returns a ring of size records, rounded up to a power of
+// two.
+func newRingQueue(size int) *ringQueue {
+	n := 2
+	for n < size {
+		n <<= 1
+	}
+	q := &ringQueue{
+		slots: make([]ringSlot, n),
+		mask:  uint64(n - 1),
+		ready: make(chan struct{}, 1),
+		room:  make(chan struct{}, 1),
+	}
+	for i := range q.slots {
+		q.slots[i].seq.Store(uint64(i))
+	}
+	return q
+}
+
+func (this *ringQueue) size() int {
+	return len(this.slots)
+}
+
+func (this *ringQueue) len() int {
+	// Tail first: head can only have moved further since.
+	tail := this.tail.Load()
+	return int(this.head.Load() - tail)
+}
+
+// tryPush queues r unless the ring is full.
+func (this *ringQueue) tryPush(r *Record) bool {
+	for {
+		pos := this.head.Load()
+		slot := &this.slots[pos&this.mask]
+		switch seq := slot.seq.Load(); {
+		case seq == pos:
+			if this.head.CompareAndSwap(pos, pos+1) {
+				slot.r = r
+				slot.seq.Store(pos + 1)
+				return true
+			}
+		case seq < pos:
+			return false
+		}
+	}
+}
+
+// tryPop removes the oldest record, nil if the ring is empty.
+func (this *ringQueue) tryPop() *Record {
+	for {
+		pos := this.tail.Load()
+		slot := &this.slots[pos&this.mask]
+		switch seq := slot.seq.Load(); {
+		case seq == pos+1:
+			if this.tail.CompareAndSwap(pos, pos+1) {
+				r := slot.r
+				slot.r = nil
+				slot.seq.Store(pos + this.mask + 1)
+				return r
+			}
+		case seq < pos+1:
+			return nil
+		}
+	}
+}
+
+// wake wakes up one goroutine waiting on c, if there is none waiting
+// already.
+func wake(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+func (this *ringQueue) push(r *Record, wait bool) bool {
+	ok := this.tryPush(r)
+	// The sink goroutine is likely to make room soon; yield a few times
+	// before going to sleep.
+	for i := 0; !ok && wait && i < ringSpins; i++ {
+		runtime.Gosched()
+		ok = this.tryPush(r)
+	}
+	if !ok && wait {
+		this.waiting.Add(1)
+		for !this.tryPush(r) {
+			<-this.room
+		}
+		// Pass the wake up on to the next producer waiting.
+		if this.waiting.Add(-1) > 0 {
+			wake(this.room)
+		}
+		ok = true
+	}
+	if ok && this.sleeping.Load() {
+		wake(this.ready)
+	}
+	return ok
+}
+
+func (this *ringQueue) pop(wait bool) *Record {
+	r := this.tryPop()
+	for r == nil && wait {
+		// Producers check sleeping after pushing, so a record pushed
+		// after tryPop fails either is seen here or wakes us up.
+		this.sleeping.Store(true)
+		if r = this.tryPop(); r == nil {
+			<-this.ready
+			r = this.tryPop()
+		}
+		this.sleeping.Store(false)
+	}
+	if r != nil && this.waiting.Load() > 0 {
+		wake(this.room)
+	}
+	return r
+}
@@ -0,0 +1,126 @@
+package kslog
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestRingQueueStress pushes from several producers into a small ring
+// and checks that the sink goroutine gets every record once and each
+// producer's in order, while the ring is filled up, so producers wait for
+// room, and run empty, so the sink goroutine waits for records. Run it
+// with -race.
+func TestRingQueueStress(t *testing.T) {
+	const producers, n = 8, 5000
+	q := newRingQueue(4)
+	// Producers stop halfway until the ring ran empty.
+	gate := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if i == n/2 {
+					<-gate
+				}
+				if !q.push(&Record{Code: int32(p), Seq: uint64(i)}, true) {
+					t.Errorf("producer %d: push %d failed", p, i)
+					return
+				}
+			}
+		}(p)
+	}
+
+	var next [producers]uint64
+	full := 0
+	for got := 0; got < producers*n; got++ {
+		switch {
+		case got == producers*n/2:
+			if q.len() != 0 {
+				t.Errorf("got %d records past the gate", q.len())
+			}
+			close(gate)
+		case got%500 == 0 && got < producers*n/2-q.size():
+			// Let the producers fill the ring.
+			for q.len() < q.size() {
+				runtime.Gosched()
+			}
+			full++
+		}
+		r := q.pop(true)
+		if r.Seq != next[r.Code] {
+			t.Fatalf("producer %d: got record %d, want %d", r.Code, r.Seq, next[r.Code])
+		}
+		next[r.Code]++
+	}
+	wg.Wait()
+	if r := q.pop(false); r != nil {
+		t.Errorf("got an extra record %+v", r)
+	}
+	if full == 0 {
+		t.Error("the ring never filled up")
+	}
+}
+
+// TestRingQueueDrop has producers that don't wait but drop the oldest
+// record when the ring is full, as logging calls do, and checks that no
+// record is lost or delivered twice.
+func TestRingQueueDrop(t *testing.T) {
+	const producers, n = 8, 5000
+	q := newRingQueue(8)
+
+	var dropped atomic.Int64
+	var seen [producers][n]atomic.Bool
+	twice := func(r *Record) {
+		if seen[r.Code][r.Seq].Swap(true) {
+			t.Errorf("producer %d: record %d popped twice", r.Code, r.Seq)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				r := &Record{Code: int32(p), Seq: uint64(i)}
+				for !q.push(r, false) {
+					if old := q.pop(false); old != nil {
+						twice(old)
+						dropped.Add(1)
+					}
+				}
+			}
+		}(p)
+	}
+
+	done := make(chan struct{})
+	var received int64
+	go func() {
+		defer close(done)
+		var last [producers]int64
+		for i := range last {
+			last[i] = -1
+		}
+		for r := q.pop(true); r.Code >= 0; r = q.pop(true) {
+			// Drops leave gaps, but what's received stays in order.
+			if int64(r.Seq) <= last[r.Code] {
+				t.Errorf("producer %d: got record %d after %d", r.Code, r.Seq, last[r.Code])
+			}
+			last[r.Code] = int64(r.Seq)
+			twice(r)
+			received++
+		}
+	}()
+
+	wg.Wait()
+	q.push(&Record{Code: -1}, true)
+	<-done
+	if received+dropped.Load() != producers*n {
+		t.Errorf("received %d and dropped %d of %d records", received, dropped.Load(), producers*n)
+	}
+}
@@ -0,0 +1,128 @@
+package kslog
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultSummaryInterval = time.Minute
+
+// RateLimit caps the records of each module and code: after a burst of
+// Burst records, Rate per second get through on average. The ones
+// suppressed are counted and reported in a summary record, at the most
+// every Summary, 1 minute by default.
+type RateLimit struct {
+	Rate    float64
+	Burst   int
+	Summary time.Duration
+}
+
+// rateKey identifies the records limited together.
+type rateKey struct {
+	module string
+	code   int32
+}
+
+// rateState is the bucket of a module and code and what it suppressed
+// since the last summary.
+type rateState struct {
+	bucket     *tokenBucket
+	level      Level
+	suppressed uint64
+}
+
+// rateLimiter holds the rate limits of a logger.
+type rateLimiter struct {
+	limits [MAXLEVEL]atomic.Pointer[RateLimit]
+	mu     sync.Mutex
+	states map[rateKey]*rateState
+}
+
+// SetRateLimit limits the records at level and less severe levels, so
+// that a single failing dependency can't log millions of identical lines;
+// nil lifts the limit. Records of the same module and code share their
+// bucket whatever their level. To let through 10 per second after a burst
+// of 100:
+//
+//	kslog.SetRateLimit(kslog.ERROR, &kslog.RateLimit{Rate: 10, Burst: 100})
+//
+// Records suppressed are counted in Stats.
+func (this *logger) SetRateLimit(level Level, limit *RateLimit) {
+	if limit != nil {
+		c := *limit
+		if c.Burst < 1 {
+			c.Burst = 1
+		}
+		if c.Summary <= 0 {
+			c.Summary = defaultSummaryInterval
+		}
+		limit = &c
+	}
+	for l := level; l < MAXLEVEL; l++ {
+		this.limiter.limits[l].Store(limit)
+	}
+
+	// Buckets are sized when they are created; start over.
+	this.limiter.mu.Lock()
+	this.limiter.states = nil
+	this.limiter.mu.Unlock()
+}
+
+// SetRateLimit sets the rate limit of the default logger.
+func SetRateLimit(level Level, limit *RateLimit) {
+	logging.SetRateLimit(level, limit)
+}
+
+// limit reports whether a record gets through the rate limit of its level.
+func (this *logger) limit(level Level, module string, code int32) bool {
+	if level >= MAXLEVEL {
+		level = MAXLEVEL - 1
+	}
+	limit := this.limiter.limits[level].Load()
+	if limit == nil {
+		return true
+	}
+
+	key := rateKey{module, code}
+	this.limiter.mu.Lock()
+	defer this.limiter.mu.Unlock()
+
+	state := this.limiter.states[key]
+	if state == nil {
+		if this.limiter.states == nil {
+			this.limiter.states = make(map[rateKey]*rateState)
+		}
+		state = &rateState{bucket: newTokenBucket(limit.Rate, limit.Burst)}
+		this.limiter.states[key] = state
+	}
+	if state.bucket.allow(this.now()) {
+		return true
+	}
+
+	if state.suppressed == 0 {
+		state.level = level
+		time.AfterFunc(limit.Summary, func() { this.summarize(key, state) })
+	} else if level < state.level {
+		state.level = level
+	}
+	state.suppressed++
+	this.limited[level].Add(1)
+	return false
+}
+
+// summarize logs how many records of key were suppressed.
+func (this *logger) summarize(key rateKey, state *rateState) {
+	this.limiter.mu.Lock()
+	n, level := state.suppressed, state.level
+	state.suppressed = 0
+	this.limiter.mu.Unlock()
+
+	if n == 0 || !this.moduleEnabled(level, key.module) {
+		return
+	}
+	item := this.newItem(level, key.code, key.module, "Suppressed "+strconv.FormatUint(n, 10)+" similar messages", "", 0)
+	item.Args["suppressed"] = n
+	this.enqueue(item)
+}
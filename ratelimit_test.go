@@ -0,0 +1,73 @@
+package kslog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitClock(t *testing.T) {
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	sink := new(recordSink)
+	l.AddSink(sink)
+	clock := &testClock{t: time.Now()}
+	l.SetClock(clock)
+	l.SetRateLimit(INFO, &RateLimit{Rate: 1, Burst: 1, Summary: time.Hour})
+
+	module := "test"
+	for i := 0; i < 3; i++ {
+		l.printf(INFO, &module, 0, "x")
+	}
+	clock.add(time.Second)
+	l.printf(INFO, &module, 0, "x")
+	l.Flush()
+
+	if n := len(sink.records); n != 2 {
+		t.Errorf("got %d records, want one a second", n)
+	}
+}
+
+func TestRateLimitSummary(t *testing.T) {
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	sink := new(recordSink)
+	l.AddSink(sink)
+	l.SetClock(&testClock{t: time.Now()})
+	l.SetRateLimit(WARNING, &RateLimit{Rate: 1, Burst: 2, Summary: 50 * time.Millisecond})
+
+	module := "test"
+	for i := 0; i < 5; i++ {
+		l.printf(INFO, &module, 1, "x")
+	}
+	// The bucket is shared by levels, the summary at the most severe.
+	l.printf(WARNING, &module, 1, "x")
+	l.printf(INFO, &module, 2, "other code")
+	l.printf(ERROR, &module, 1, "not limited")
+	l.Flush()
+
+	if n := len(sink.records); n != 4 {
+		t.Errorf("got %d records, want 4", n)
+	}
+	if st := l.Stats(); st.Limited[INFO] != 3 || st.Limited[WARNING] != 1 {
+		t.Errorf("got limited %d at INFO and %d at WARNING, want 3 and 1", st.Limited[INFO], st.Limited[WARNING])
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l.Flush()
+		sink.mu.Lock()
+		records := sink.records
+		sink.mu.Unlock()
+		if len(records) > 4 {
+			r := records[4]
+			if r.Message != "Suppressed 4 similar messages" || r.Level != WARNING || r.Code != 1 || r.Args["suppressed"] != uint64(4) {
+				t.Errorf("got summary %s %d %q %v", r.Level, r.Code, r.Message, r.Args)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no summary")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,197 @@
+package kslog
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Redacted replaces the values of sensitive arguments and of Secret.
+const Redacted = "[REDACTED]"
+
+// defaultRedactKeys are the keys redacted until SetRedactKeys.
+var defaultRedactKeys = []string{
+	"password", "passwd", "secret", "token", "authorization", "apikey",
+	"cookie", "credential", "privatekey",
+}
+
+// redactKeys are the normalized keys set by SetRedactKeys.
+var redactKeys atomic.Pointer[[]string]
+
+func init() {
+	SetRedactKeys(defaultRedactKeys...)
+}
+
+// SetRedactKeys sets the argument keys whose values are written as
+// Redacted by every sink, by default password, passwd, secret, token,
+// authorization, apikey, cookie, credential and privatekey. A key matches
+// an argument whose key contains it, ignoring case, '-' and '_': "token"
+// redacts "access_token" and "X-Auth-Token" alike. The values of matching
+// keys of map arguments, like an http.Header, are redacted as well.
+//
+// SetRedactKeys() without keys turns redaction off; values wrapped in
+// Secret stay masked.
+func SetRedactKeys(keys ...string) {
+	list := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k = normalizeKey(k); k != "" {
+			list = append(list, k)
+		}
+	}
+	redactKeys.Store(&list)
+}
+
+// secret is a value wrapped by Secret.
+type secret struct {
+	v interface{}
+}
+
+// Secret wraps v so that it is logged as Redacted, whatever its key and
+// wherever it is formatted, the message of an f call included:
+//
+//	kslog.Infof("auth", 0, "Logged in with %v", kslog.Secret(otp))
+func Secret(v interface{}) interface{} {
+	return secret{v}
+}
+
+func (secret) String() string {
+	return Redacted
+}
+
+func (secret) GoString() string {
+	return Redacted
+}
+
+// Format writes Redacted for every verb; fmt would otherwise format the
+// wrapped value for verbs like %d that don't call String.
+func (secret) Format(f fmt.State, verb rune) {
+	io.WriteString(f, Redacted)
+}
+
+func (secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + Redacted + `"`), nil
+}
+
+// normalizeKey returns key lower case without '-' and '_'.
+func normalizeKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(key))
+}
+
+// sensitive tells whether the values of key are redacted.
+func sensitive(keys []string, key string) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	key = normalizeKey(key)
+	for _, k := range keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactRecord replaces the values of r's sensitive arguments and its
+// Secret values with Redacted. Maps are copied rather than changed, they
+// belong to the caller.
+func redactRecord(r *Record) {
+	keys := *redactKeys.Load()
+	for k, v := range r.Args {
+		if _, ok := v.(secret); ok || sensitive(keys, k) {
+			r.Args[k] = Redacted
+		} else if v, ok := redactValue(keys, v); ok {
+			r.Args[k] = v
+		}
+	}
+}
+
+// redactValue returns a copy of the map v with its sensitive entries
+// redacted, and whether there were any.
+func redactValue(keys []string, v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if m := redactArgs(keys, v); m != nil {
+			return m, true
+		}
+	case map[string]string:
+		if m := redactStrings(keys, v); m != nil {
+			return m, true
+		}
+	case map[string][]string:
+		if m := redactHeader(keys, v); m != nil {
+			return m, true
+		}
+	case http.Header:
+		if m := redactHeader(keys, v); m != nil {
+			return http.Header(m), true
+		}
+	}
+	return nil, false
+}
+
+// redactArgs returns a redacted copy of m, or nil if it has nothing to
+// redact.
+func redactArgs(keys []string, m map[string]interface{}) map[string]interface{} {
+	var out map[string]interface{}
+	for k, v := range m {
+		var nv interface{}
+		if _, ok := v.(secret); ok || sensitive(keys, k) {
+			nv = Redacted
+		} else if rv, ok := redactValue(keys, v); ok {
+			nv = rv
+		} else {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]interface{}, len(m))
+			for k, v := range m {
+				out[k] = v
+			}
+		}
+		out[k] = nv
+	}
+	return out
+}
+
+// redactStrings is redactArgs for maps of strings.
+func redactStrings(keys []string, m map[string]string) map[string]string {
+	var out map[string]string
+	for k := range m {
+		if !sensitive(keys, k) {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string, len(m))
+			for k, v := range m {
+				out[k] = v
+			}
+		}
+		out[k] = Redacted
+	}
+	return out
+}
+
+// redactHeader is redactArgs for maps of string lists, like http.Header.
+func redactHeader(keys []string, m map[string][]string) map[string][]string {
+	var out map[string][]string
+	for k := range m {
+		if !sensitive(keys, k) {
+			continue
+		}
+		if out == nil {
+			out = make(map[string][]string, len(m))
+			for k, v := range m {
+				out[k] = v
+			}
+		}
+		out[k] = []string{Redacted}
+	}
+	return out
+}
@@ -0,0 +1,23 @@
+package kslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestSecretFormat(t *testing.T) {
+	for _, format := range []string{"%v", "%s", "%d", "%f", "%.2f", "%+v", "%#v", "%x", "%q", "%10d", "%t"} {
+		for _, v := range []interface{}{123456, "abc", 3.14, struct{ Pin int }{42}} {
+			if got := fmt.Sprintf(format, Secret(v)); got != Redacted {
+				t.Errorf("%s of %v: got %q", format, v, got)
+			}
+		}
+	}
+	if got := fmt.Sprintf("otp %d pin %s f %.2f", Secret(123456), Secret("abc"), Secret(3.14)); got != "otp [REDACTED] pin [REDACTED] f [REDACTED]" {
+		t.Errorf("got %q", got)
+	}
+	if data, _ := json.Marshal(map[string]interface{}{"pin": Secret(42)}); string(data) != `{"pin":"[REDACTED]"}` {
+		t.Errorf("got %s", data)
+	}
+}
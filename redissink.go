@@ -0,0 +1,238 @@
+package kslog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const redisTimeout = 10 * time.Second
+
+// RedisSinkConfig configures a RedisSink.
+type RedisSinkConfig struct {
+	// Addr is the host:port of the Redis server.
+	Addr string
+	// Username and Password are sent with AUTH when Password is set.
+	Username string
+	Password string
+	DB       int
+	TLS      *tls.Config
+	// Stream is the stream key, "kslog:<program>" by default.
+	Stream string
+	// MaxLen approximately caps the stream length; zero leaves it unbounded.
+	MaxLen int
+	// BatchSize, FlushInterval and MaxRetries default to 100, 1s and 3;
+	// see NoRetries and RetryForever.
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+}
+
+// RedisSink XADDs records to a Redis stream, one entry per record with
+// time, level, module, code, file, line, message and JSON args fields, so
+// they can be tailed with XREAD or consumer groups.
+type RedisSink struct {
+	config RedisSinkConfig
+	conn   net.Conn
+	reader *bufio.Reader
+	batch  *batcher
+}
+
+// NewRedisSink returns a sink adding to config.Stream.
+func NewRedisSink(config RedisSinkConfig) *RedisSink {
+	if config.Stream == "" {
+		config.Stream = "kslog:" + getProgram()
+	}
+
+	s := &RedisSink{config: config}
+	s.batch = newBatcher(config.BatchSize, config.FlushInterval, config.MaxRetries, s.flush, nil)
+	return s
+}
+
+func (this *RedisSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records were given up on.
+func (this *RedisSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *RedisSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close adds what is still pending and closes the connection.
+func (this *RedisSink) Close() error {
+	this.batch.close()
+	if this.conn != nil {
+		this.disconnect()
+	}
+	return nil
+}
+
+func redisCommand(w *bufio.Writer, args ...string) {
+	w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		w.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		w.WriteString(arg)
+		w.WriteString("\r\n")
+	}
+}
+
+// redisReply reads one reply, returning server errors as error.
+func redisReply(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if len(line) < 3 {
+		return errors.New("Redis: short reply")
+	}
+	body := line[1 : len(line)-2]
+
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return errors.New("Redis: " + body)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return err
+		}
+		if n >= 0 {
+			_, err = io.CopyN(io.Discard, r, int64(n+2))
+		}
+		return err
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := redisReply(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.New("Redis: unexpected reply " + line)
+}
+
+func (this *RedisSink) connect() error {
+	dialer := &net.Dialer{Timeout: netDialTimeout}
+	var conn net.Conn
+	var err error
+	if this.config.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", this.config.Addr, this.config.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", this.config.Addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	this.conn = conn
+	this.reader = bufio.NewReader(conn)
+
+	w := bufio.NewWriter(conn)
+	replies := 0
+	if this.config.Password != "" {
+		if this.config.Username != "" {
+			redisCommand(w, "AUTH", this.config.Username, this.config.Password)
+		} else {
+			redisCommand(w, "AUTH", this.config.Password)
+		}
+		replies++
+	}
+	if this.config.DB != 0 {
+		redisCommand(w, "SELECT", strconv.Itoa(this.config.DB))
+		replies++
+	}
+	if replies == 0 {
+		return nil
+	}
+
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	defer conn.SetDeadline(time.Time{})
+	if err := w.Flush(); err != nil {
+		this.disconnect()
+		return err
+	}
+	for i := 0; i < replies; i++ {
+		if err := redisReply(this.reader); err != nil {
+			this.disconnect()
+			return permanentError{err}
+		}
+	}
+	return nil
+}
+
+func (this *RedisSink) disconnect() {
+	this.conn.Close()
+	this.conn = nil
+	this.reader = nil
+}
+
+func (this *RedisSink) flush(records []*Record) error {
+	if this.conn == nil {
+		if err := this.connect(); err != nil {
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(this.conn)
+	for _, r := range records {
+		args := []string{"XADD", this.config.Stream}
+		if this.config.MaxLen > 0 {
+			args = append(args, "MAXLEN", "~", strconv.Itoa(this.config.MaxLen))
+		}
+		args = append(args, "*",
+			"time", r.Time.UTC().Format(time.RFC3339Nano),
+			"level", r.Level.String(),
+			"module", r.Module,
+			"code", strconv.Itoa(int(r.Code)),
+			"file", r.File,
+			"line", strconv.Itoa(r.Line),
+			"message", r.Message)
+		if len(r.Args) > 0 {
+			args = append(args, "args", string(encodeJSONArgs(r.Args)))
+		}
+		redisCommand(w, args...)
+	}
+
+	this.conn.SetDeadline(time.Now().Add(redisTimeout))
+	if err := w.Flush(); err != nil {
+		this.disconnect()
+		return err
+	}
+
+	// Read every reply to keep the connection in sync; a failed XADD
+	// only fails its own record.
+	var failed []*Record
+	var lastErr error
+	for _, r := range records {
+		err := redisReply(this.reader)
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(net.Error); ok || err == io.EOF {
+			this.disconnect()
+			return err
+		}
+		failed = append(failed, r)
+		lastErr = err
+	}
+	this.conn.SetDeadline(time.Time{})
+
+	if len(failed) > 0 {
+		return partialError{lastErr, failed, true, nil}
+	}
+	return nil
+}
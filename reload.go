@@ -0,0 +1,132 @@
+package kslog
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// defaultReloadInterval is how often WatchConfig looks at the file by
+// default.
+const defaultReloadInterval = 5 * time.Second
+
+// WatchConfig applies the config file at path, like LoadConfig, and then
+// polls it every interval, 5s by default, applying it again whenever it
+// is changed. Only what changed is applied: the sinks are reopened only
+// when their part of the file changed. Each reload is logged as a NOTICE
+// of module "kslog" saying what changed; a file that can't be read or
+// applied is logged as an ERROR, given to the error handler, see
+// SetErrorHandler, and leaves the logger as it was. Calling
+// stop stops the polling.
+func (this *logger) WatchConfig(path string, interval time.Duration) (stop func(), err error) {
+	config, err := ReadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := this.ApplyConfig(config); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+	info, _ := os.Stat(path)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			latest, err := os.Stat(path)
+			if err != nil || info != nil && latest.ModTime().Equal(info.ModTime()) && latest.Size() == info.Size() {
+				continue
+			}
+			info = latest
+			config = this.reloadConfig(path, config)
+		}
+	}()
+	return func() { close(done) }, nil
+}
+
+// WatchConfig applies the config file at path to the default logger and
+// reloads it when it changes.
+func WatchConfig(path string, interval time.Duration) (stop func(), err error) {
+	return logging.WatchConfig(path, interval)
+}
+
+// reloadConfig applies the config file at path over old, returning the
+// config in effect.
+func (this *logger) reloadConfig(path string, old *Config) *Config {
+	module := "kslog"
+	config, err := this.readConfig(path, old)
+	if err != nil {
+		notifyError(fmt.Errorf("Config %s not reloaded: %w", path, err))
+		message := fmt.Sprintf("Config not reloaded: %v", err)
+		this.printex(ERROR, &module, 0, &message)
+		return old
+	}
+
+	if changes := configChanges(old, config); len(changes) > 0 {
+		message := "Config reloaded: " + strings.Join(changes, ", ")
+		this.printex(NOTICE, &module, 0, &message)
+	}
+	return config
+}
+
+// readConfig reads the config file at path and applies it over old. A
+// panic doing so is returned as an error: one bad edit of a watched file
+// mustn't take the process down.
+func (this *logger) readConfig(path string, old *Config) (config *Config, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			config, err = nil, fmt.Errorf("Reading %s: %v", path, p)
+		}
+	}()
+	if config, err = ReadConfig(path); err != nil {
+		return nil, err
+	}
+	if err = this.applyConfig(config, old); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// configChanges describes what config changes from old.
+func configChanges(old, config *Config) []string {
+	var changes []string
+	changed := func(name, from, to string) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s %s -> %s", name, orDefault(from), orDefault(to)))
+		}
+	}
+	changed("level", old.Level, config.Level)
+	changed("console", old.Console, config.Console)
+	changed("console_level", old.ConsoleLevel, config.ConsoleLevel)
+	changed("dedup", old.Dedup, config.Dedup)
+	if !reflect.DeepEqual(old.Include, config.Include) || !reflect.DeepEqual(old.Exclude, config.Exclude) {
+		changes = append(changes, "module filter")
+	}
+	if !reflect.DeepEqual(old.Sampling, config.Sampling) {
+		changes = append(changes, "sampling")
+	}
+	if !reflect.DeepEqual(old.RateLimit, config.RateLimit) {
+		changes = append(changes, "rate_limit")
+	}
+	if !reflect.DeepEqual(old.Sinks, config.Sinks) {
+		changes = append(changes, fmt.Sprintf("sinks (%d -> %d)", len(old.Sinks), len(config.Sinks)))
+	}
+	return changes
+}
+
+func orDefault(s string) string {
+	if s == "" {
+		return "default"
+	}
+	return s
+}
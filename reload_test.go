@@ -0,0 +1,88 @@
+package kslog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReloadBadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kslog.toml")
+	if err := os.WriteFile(path, []byte("level = \"INFO\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errs []error
+	SetErrorHandler(func(err error) { errs = append(errs, err) })
+	defer SetErrorHandler(nil)
+	for _, bad := range []string{"a = []\n[a.b]\n", "a = [1]\n[a.b]\n", "level = \n"} {
+		if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if config := logging.reloadConfig(path, old); config != old {
+			t.Errorf("%q: the config was replaced", bad)
+		}
+	}
+	logging.Flush()
+	if len(errs) != 3 {
+		t.Fatalf("got %d errors, want 3: %v", len(errs), errs)
+	}
+	if !strings.Contains(errs[0].Error(), "line 2: key a is not a table") {
+		t.Errorf("got %v", errs[0])
+	}
+}
+
+// closingSink is a recordSink telling whether it was closed.
+type closingSink struct {
+	recordSink
+	closed bool
+}
+
+func (this *closingSink) Close() error {
+	this.closed = true
+	return nil
+}
+
+func TestApplyConfigKeepsSinks(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	user, security := new(closingSink), new(closingSink)
+	l.AddSink(user)
+	l.AddSecuritySink(security)
+
+	first := &Config{Console: "off", Sinks: []SinkConfig{{Type: "file", Path: filepath.Join(dir, "a.log")}}}
+	if err := l.ApplyConfig(first); err != nil {
+		t.Fatal(err)
+	}
+	configured := l.file.sink
+	second := &Config{Console: "off", Sinks: []SinkConfig{{Type: "file", Path: filepath.Join(dir, "b.log")}}}
+	if err := l.applyConfig(second, first); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []*closingSink{user, security} {
+		if s.closed || !l.SetSinkEnabled(s, true) {
+			t.Errorf("sink added by hand was closed or detached")
+		}
+	}
+	if l.SetSinkEnabled(configured, true) {
+		t.Error("sink of the first config still attached")
+	}
+
+	module := "test"
+	l.printf(INFO, &module, 0, "after reload")
+	l.Flush()
+	if len(user.records) != 1 {
+		t.Errorf("got %d records, want 1", len(user.records))
+	}
+	l.ResetSinks()
+	if data, err := os.ReadFile(filepath.Join(dir, "b.log")); err != nil || !strings.Contains(string(data), "after reload") {
+		t.Errorf("got %q, %v from the configured file", data, err)
+	}
+}
@@ -0,0 +1,426 @@
+package kslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// remoteRetry is how long a watch waits after failing to reach its store.
+const remoteRetry = 10 * time.Second
+
+// DynamicConfig is what a key watched by WatchConsul or WatchEtcd holds,
+// as JSON, or YAML when it doesn't start with "{": the level, the module
+// levels and the module filter, for a fleet of services to be turned up
+// together while debugging an incident.
+//
+//	{"level": "INFO", "modules": {"db": "DEBUG2"}, "exclude": ["http.access"]}
+type DynamicConfig struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules"`
+	Include []string          `json:"include"`
+	Exclude []string          `json:"exclude"`
+}
+
+// ConsulWatchConfig configures WatchConsul.
+type ConsulWatchConfig struct {
+	// Addr is the URL of the Consul agent, http://127.0.0.1:8500 by
+	// default, and Key the key holding the DynamicConfig.
+	Addr  string
+	Key   string
+	Token string
+	TLS   *tls.Config
+}
+
+// EtcdWatchConfig configures WatchEtcd.
+type EtcdWatchConfig struct {
+	// Endpoint is the URL of an etcd member, http://127.0.0.1:2379 by
+	// default, and Key the key holding the DynamicConfig.
+	Endpoint string
+	Key      string
+	// Username and Password authenticate when Username is set.
+	Username string
+	Password string
+	TLS      *tls.Config
+}
+
+// remoteState is what a watch applied, and what to restore once the key
+// is deleted.
+type remoteState struct {
+	mu      sync.Mutex
+	current *DynamicConfig
+	base    Level
+	modules map[string]Level
+}
+
+func newRemoteState(l *logger) *remoteState {
+	return &remoteState{current: new(DynamicConfig), base: l.GetLevel(), modules: l.ModuleLevels()}
+}
+
+// applyDynamic applies the value of a key, nil once it was deleted, logging a
+// NOTICE of module "kslog" saying what changed, or an ERROR if the value
+// is invalid.
+func (this *logger) applyDynamic(state *remoteState, source string, value []byte) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	module := "kslog"
+	config, err := parseDynamic(value)
+	if err == nil {
+		err = this.setDynamic(state, config)
+	}
+	if err != nil {
+		message := fmt.Sprintf("Config from %s not applied: %v", source, err)
+		this.printex(ERROR, &module, 0, &message)
+		return
+	}
+	if changes := dynamicChanges(state.current, config); len(changes) > 0 {
+		message := fmt.Sprintf("Config from %s applied: %s", source, strings.Join(changes, ", "))
+		this.printex(NOTICE, &module, 0, &message)
+	}
+	state.current = config
+}
+
+func parseDynamic(value []byte) (*DynamicConfig, error) {
+	config := new(DynamicConfig)
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 {
+		return config, nil
+	}
+	if value[0] != '{' {
+		var err error
+		if value, err = yamlToJSON(value); err != nil {
+			return nil, err
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// setDynamic applies config over what the watch applied before; what it
+// leaves out is restored to how it was when the watch started.
+func (this *logger) setDynamic(state *remoteState, config *DynamicConfig) error {
+	level, err := parseLevel(config.Level, state.base)
+	if err != nil {
+		return err
+	}
+	modules := make(map[string]Level)
+	for m, l := range state.modules {
+		modules[m] = l
+	}
+	for m, s := range config.Modules {
+		if modules[m], err = ParseLevel(s); err != nil {
+			return err
+		}
+	}
+	for _, patterns := range [][]string{config.Include, config.Exclude} {
+		if _, err := modulePatterns(patterns); err != nil {
+			return err
+		}
+	}
+
+	this.SetLevel(level)
+	for m := range state.current.Modules {
+		if _, ok := modules[m]; !ok {
+			this.ClearModuleLevel(m)
+		}
+	}
+	for m, l := range modules {
+		this.SetModuleLevel(m, l)
+	}
+	if !reflect.DeepEqual(state.current.Include, config.Include) || !reflect.DeepEqual(state.current.Exclude, config.Exclude) {
+		this.SetModuleFilter(config.Include, config.Exclude)
+	}
+	return nil
+}
+
+// dynamicChanges describes what config changes from old.
+func dynamicChanges(old, config *DynamicConfig) []string {
+	var changes []string
+	if old.Level != config.Level {
+		changes = append(changes, fmt.Sprintf("level %s -> %s", orDefault(old.Level), orDefault(config.Level)))
+	}
+	var modules []string
+	for m, l := range config.Modules {
+		if old.Modules[m] != l {
+			modules = append(modules, fmt.Sprintf("module %s %s -> %s", m, orDefault(old.Modules[m]), l))
+		}
+	}
+	for m, l := range old.Modules {
+		if _, ok := config.Modules[m]; !ok {
+			modules = append(modules, fmt.Sprintf("module %s %s -> default", m, l))
+		}
+	}
+	sort.Strings(modules)
+	changes = append(changes, modules...)
+	if !reflect.DeepEqual(old.Include, config.Include) || !reflect.DeepEqual(old.Exclude, config.Exclude) {
+		changes = append(changes, "module filter")
+	}
+	return changes
+}
+
+// remoteClient returns a client without a timeout, for long polls.
+func remoteClient(config *tls.Config) *http.Client {
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config}}
+}
+
+// watchRemote runs watch until stop is called, logging each failure as an
+// ERROR and starting over remoteRetry later.
+func (this *logger) watchRemote(source string, watch func(ctx context.Context) error) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			err := watch(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			module, message := "kslog", fmt.Sprintf("Watching %s: %v", source, err)
+			this.printex(ERROR, &module, 0, &message)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(remoteRetry):
+			}
+		}
+	}()
+	return cancel
+}
+
+// WatchConsul applies the DynamicConfig under config.Key in Consul to the
+// logger, and again whenever it changes, using blocking queries. Deleting
+// the key restores the level and module levels from before the watch and
+// removes the module filter. Calling stop stops the watch.
+func (this *logger) WatchConsul(config ConsulWatchConfig) (stop func(), err error) {
+	if config.Key == "" {
+		return nil, errors.New("No Consul key given")
+	}
+	if config.Addr == "" {
+		config.Addr = "http://127.0.0.1:8500"
+	}
+	client := remoteClient(config.TLS)
+	state := newRemoteState(this)
+	source := "consul key " + config.Key
+	index := uint64(0)
+
+	return this.watchRemote(source, func(ctx context.Context) error {
+		for {
+			u := strings.TrimSuffix(config.Addr, "/") + "/v1/kv/" + strings.TrimPrefix(config.Key, "/") +
+				"?raw&wait=5m&index=" + strconv.FormatUint(index, 10)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+			if err != nil {
+				return err
+			}
+			if config.Token != "" {
+				req.Header.Set("X-Consul-Token", config.Token)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			value, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+				return fmt.Errorf("Consul: %s", resp.Status)
+			}
+
+			next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+			if next == index {
+				// The wait timed out.
+				continue
+			}
+			// The index goes back when Consul's state is reset.
+			if next < index {
+				next = 0
+			}
+			index = next
+			if resp.StatusCode == http.StatusNotFound {
+				value = nil
+			}
+			this.applyDynamic(state, source, value)
+		}
+	}), nil
+}
+
+// WatchConsul watches a Consul key for the default logger.
+func WatchConsul(config ConsulWatchConfig) (stop func(), err error) {
+	return logging.WatchConsul(config)
+}
+
+// etcdKV and etcdHeader are the parts of etcd's JSON API a watch reads;
+// its 64 bit numbers are strings.
+type etcdKV struct {
+	Value []byte `json:"value"`
+}
+
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+// WatchEtcd applies the DynamicConfig under config.Key in etcd to the
+// logger, and again whenever it changes, through etcd's JSON gateway, so
+// without a gRPC client. Deleting the key restores the level and module
+// levels from before the watch and removes the module filter. Calling
+// stop stops the watch.
+func (this *logger) WatchEtcd(config EtcdWatchConfig) (stop func(), err error) {
+	if config.Key == "" {
+		return nil, errors.New("No etcd key given")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "http://127.0.0.1:2379"
+	}
+	base, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	e := &etcdWatch{config: config, base: base.String(), client: remoteClient(config.TLS)}
+	state := newRemoteState(this)
+	source := "etcd key " + config.Key
+
+	return this.watchRemote(source, func(ctx context.Context) error {
+		if err := e.authenticate(ctx); err != nil {
+			return err
+		}
+		var r struct {
+			Header etcdHeader `json:"header"`
+			KVs    []etcdKV   `json:"kvs"`
+		}
+		if err := e.call(ctx, "/v3/kv/range", map[string]interface{}{"key": []byte(config.Key)}, &r); err != nil {
+			return err
+		}
+		var value []byte
+		if len(r.KVs) > 0 {
+			value = r.KVs[0].Value
+		}
+		this.applyDynamic(state, source, value)
+		return e.watch(ctx, r.Header.Revision+1, func(value []byte) {
+			this.applyDynamic(state, source, value)
+		})
+	}), nil
+}
+
+// WatchEtcd watches an etcd key for the default logger.
+func WatchEtcd(config EtcdWatchConfig) (stop func(), err error) {
+	return logging.WatchEtcd(config)
+}
+
+type etcdWatch struct {
+	config EtcdWatchConfig
+	base   string
+	client *http.Client
+	token  string
+}
+
+// authenticate gets a token when a user is configured.
+func (this *etcdWatch) authenticate(ctx context.Context) error {
+	if this.config.Username == "" {
+		return nil
+	}
+	this.token = ""
+	var r struct {
+		Token string `json:"token"`
+	}
+	err := this.call(ctx, "/v3/auth/authenticate", map[string]string{"name": this.config.Username, "password": this.config.Password}, &r)
+	this.token = r.Token
+	return err
+}
+
+// post POSTs body as JSON to path.
+func (this *etcdWatch) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, this.base+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if this.token != "" {
+		req.Header.Set("Authorization", this.token)
+	}
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("etcd: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+// call POSTs body to path and decodes the answer into result.
+func (this *etcdWatch) call(ctx context.Context, path string, body, result interface{}) error {
+	resp, err := this.post(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// watch streams the changes of the key from revision on, handing each
+// value to changed, nil once the key is deleted.
+func (this *etcdWatch) watch(ctx context.Context, revision int64, changed func(value []byte)) error {
+	resp, err := this.post(ctx, "/v3/watch", map[string]interface{}{
+		"create_request": map[string]interface{}{"key": []byte(this.config.Key), "start_revision": strconv.FormatInt(revision, 10)},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var msg struct {
+			Result struct {
+				Canceled     bool   `json:"canceled"`
+				CancelReason string `json:"cancel_reason"`
+				Events       []struct {
+					Type string `json:"type"`
+					KV   etcdKV `json:"kv"`
+				} `json:"events"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			return err
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("etcd: %s", msg.Error.Message)
+		}
+		if msg.Result.Canceled {
+			return fmt.Errorf("etcd: watch canceled: %s", msg.Result.CancelReason)
+		}
+		for _, ev := range msg.Result.Events {
+			if ev.Type == "DELETE" {
+				changed(nil)
+			} else {
+				changed(ev.KV.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package kslog
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// removeOldLogs deletes the log files in dir whose name starts with
+// prefix, other than current, beyond the retention limits of config.
+// The newest files are kept.
+func removeOldLogs(dir, prefix, current string, config *FileSinkConfig) {
+	if config.MaxFiles <= 0 && config.MaxAge <= 0 && config.MaxTotalSize <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var logs []os.FileInfo
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), prefix) || !e.Type().IsRegular() {
+			continue
+		}
+		if filepath.Join(dir, e.Name()) == current {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			logs = append(logs, info)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].ModTime().After(logs[j].ModTime())
+	})
+
+	// The current file counts towards the limits.
+	files := 1
+	var total int64
+	if info, err := os.Stat(current); err == nil {
+		total = info.Size()
+	}
+	now := clockNow(config.Clock)
+	for _, info := range logs {
+		files++
+		total += info.Size()
+		if (config.MaxFiles > 0 && files > config.MaxFiles) ||
+			(config.MaxAge > 0 && now.Sub(info.ModTime()) > config.MaxAge) ||
+			(config.MaxTotalSize > 0 && total > config.MaxTotalSize) {
+			os.Remove(filepath.Join(dir, info.Name()))
+		}
+	}
+}
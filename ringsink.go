@@ -0,0 +1,64 @@
+package kslog
+
+import (
+	"io"
+	"sync"
+)
+
+// RingSink keeps the last records in memory so they can be dumped after
+// a crash or for a support bundle. Attach it with AddSink so it sees
+// every level.
+type RingSink struct {
+	mu     sync.Mutex
+	ring   []*Record
+	next   int
+	full   bool
+	format Formatter
+}
+
+// NewRingSink returns a sink retaining the last size records, dumped
+// with format.
+func NewRingSink(size int, format Formatter) *RingSink {
+	if size < 1 {
+		size = 1
+	}
+	return &RingSink{ring: make([]*Record, size), format: format}
+}
+
+func (this *RingSink) Write(r *Record) error {
+	this.mu.Lock()
+	this.ring[this.next] = r.Clone()
+	this.next++
+	if this.next == len(this.ring) {
+		this.next = 0
+		this.full = true
+	}
+	this.mu.Unlock()
+	return nil
+}
+
+func (this *RingSink) Close() error {
+	return nil
+}
+
+// Records returns the retained records, oldest first.
+func (this *RingSink) Records() []*Record {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	var out []*Record
+	if this.full {
+		out = append(out, this.ring[this.next:]...)
+	}
+	return append(out, this.ring[:this.next]...)
+}
+
+// Dump writes the retained records to w, oldest first.
+func (this *RingSink) Dump(w io.Writer) error {
+	for _, r := range this.Records() {
+		if _, err := w.Write(this.format(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package kslog
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Sampling thins out records logged in bursts from the same place: of the
+// records with the same level, module and code, the first First of every
+// second are kept and after that one in Thereafter, or none if Thereafter
+// is zero.
+type Sampling struct {
+	First      int
+	Thereafter int
+}
+
+// sampleKey identifies the records counted together.
+type sampleKey struct {
+	level  Level
+	module string
+	code   int32
+}
+
+// sampleCounter counts records in the current second.
+type sampleCounter struct {
+	second atomic.Int64
+	count  atomic.Uint64
+}
+
+// sampler holds the sampling of a logger.
+type sampler struct {
+	policies [MAXLEVEL]atomic.Pointer[Sampling]
+	mu       sync.RWMutex
+	counters map[sampleKey]*sampleCounter
+}
+
+// SetSampling samples the records at level and less severe levels, so
+// that debug storms from hot paths don't overwhelm the sinks while
+// representative records still get through; nil stops sampling them.
+// To keep the first 100 DEBUG records per module and code every second
+// and then one in 100:
+//
+//	kslog.SetSampling(kslog.DEBUG, &kslog.Sampling{First: 100, Thereafter: 100})
+//
+// Records sampled out are counted in Stats.
+func (this *logger) SetSampling(level Level, s *Sampling) {
+	if s != nil {
+		c := *s
+		if c.First < 0 {
+			c.First = 0
+		}
+		if c.Thereafter < 0 {
+			c.Thereafter = 0
+		}
+		s = &c
+	}
+	for l := level; l < MAXLEVEL; l++ {
+		this.sampler.policies[l].Store(s)
+	}
+}
+
+// SetSampling sets the sampling of the default logger.
+func SetSampling(level Level, s *Sampling) {
+	logging.SetSampling(level, s)
+}
+
+// sample reports whether a record is kept by the sampling of its level.
+func (this *logger) sample(level Level, module string, code int32) bool {
+	if level >= MAXLEVEL {
+		level = MAXLEVEL - 1
+	}
+	s := this.sampler.policies[level].Load()
+	if s == nil {
+		return true
+	}
+
+	c := this.sampler.counter(sampleKey{level, module, code})
+	now := this.now().Unix()
+	if second := c.second.Load(); second != now && c.second.CompareAndSwap(second, now) {
+		c.count.Store(0)
+	}
+	n := c.count.Add(1)
+	if n <= uint64(s.First) || s.Thereafter > 0 && (n-uint64(s.First))%uint64(s.Thereafter) == 0 {
+		return true
+	}
+	this.sampled[level].Add(1)
+	return false
+}
+
+func (this *sampler) counter(key sampleKey) *sampleCounter {
+	this.mu.RLock()
+	c := this.counters[key]
+	this.mu.RUnlock()
+	if c != nil {
+		return c
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if c = this.counters[key]; c == nil {
+		if this.counters == nil {
+			this.counters = make(map[sampleKey]*sampleCounter)
+		}
+		c = new(sampleCounter)
+		this.counters[key] = c
+	}
+	return c
+}
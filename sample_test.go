@@ -0,0 +1,30 @@
+package kslog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSamplingClock(t *testing.T) {
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	sink := new(recordSink)
+	l.AddSink(sink)
+	clock := &testClock{t: time.Now()}
+	l.SetClock(clock)
+	l.SetSampling(INFO, &Sampling{First: 2})
+
+	module := "test"
+	for i := 0; i < 5; i++ {
+		l.printf(INFO, &module, 0, "x")
+	}
+	clock.add(time.Second)
+	for i := 0; i < 5; i++ {
+		l.printf(INFO, &module, 0, "x")
+	}
+	l.Flush()
+
+	if n := len(sink.records); n != 4 {
+		t.Errorf("got %d records, want 2 of every second", n)
+	}
+}
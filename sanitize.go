@@ -0,0 +1,150 @@
+package kslog
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// unsanitized is set by SetSanitize(false).
+var unsanitized atomic.Bool
+
+// SetSanitize switches the sanitizing of records, on by default: invalid
+// UTF-8 in messages, argument keys and string, error and fmt.Stringer
+// values is replaced by U+FFFD, ANSI escape sequences are removed and
+// other control characters, newlines included, are escaped like in Go
+// strings. Input logged as is then can't forge records nor take over the
+// terminal showing them.
+//
+// Arguments holding several lines on purpose, like the stack of a crash,
+// are escaped as well; SetSanitize(false) keeps them as they are.
+func SetSanitize(on bool) {
+	unsanitized.Store(!on)
+}
+
+// sanitizeRecord sanitizes the message and arguments of r, see
+// SetSanitize.
+func sanitizeRecord(r *Record) {
+	if unsanitized.Load() {
+		return
+	}
+	r.Message = sanitize(r.Message)
+
+	var keys []string
+	for k, v := range r.Args {
+		if sanitize(k) != k {
+			keys = append(keys, k)
+		}
+		switch v := v.(type) {
+		case string:
+			r.Args[k] = sanitize(v)
+		case error, fmt.Stringer:
+			// fmt recovers from methods panicking on nil receivers.
+			if s := fmt.Sprint(v); sanitize(s) != s {
+				r.Args[k] = sanitize(s)
+			}
+		}
+	}
+	for _, k := range keys {
+		r.Args[sanitize(k)] = r.Args[k]
+		delete(r.Args, k)
+	}
+}
+
+// sanitize returns s with invalid UTF-8 replaced, ANSI escape sequences
+// removed and control characters escaped. Clean strings are returned
+// without copying.
+func sanitize(s string) string {
+	if clean(s) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteRune(utf8.RuneError)
+		case r == 0x1b:
+			i += escapeLen(s[i:])
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case r >= 0x80 && r <= 0x9f, r == 0x2028, r == 0x2029:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// clean tells whether s needs no sanitizing.
+func clean(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c == 0x7f {
+			return false
+		} else if c >= utf8.RuneSelf {
+			return cleanRunes(s[i:])
+		}
+	}
+	return true
+}
+
+// cleanRunes is clean for strings that aren't plain ASCII.
+func cleanRunes(s string) bool {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == utf8.RuneError && size == 1,
+			r < 0x20, r >= 0x7f && r <= 0x9f, r == 0x2028, r == 0x2029:
+			return false
+		}
+	}
+	return true
+}
+
+// escapeLen returns the length of the rest of the ANSI escape sequence
+// s follows the ESC of: a CSI sequence like "[1;31m", an OSC sequence
+// like "]0;title" up to its BEL or ST, or a single character.
+func escapeLen(s string) int {
+	if s == "" {
+		return 0
+	}
+	switch s[0] {
+	case '[':
+		// Parameter and intermediate bytes, then a final byte.
+		for i := 1; i < len(s); i++ {
+			if c := s[i]; c >= 0x40 && c <= 0x7e {
+				return i + 1
+			} else if c < 0x20 || c > 0x7e {
+				return i
+			}
+		}
+		return len(s)
+	case ']', 'P', '_', '^':
+		// A string ended by BEL or ESC \.
+		for i := 1; i < len(s); i++ {
+			if s[i] == 0x07 {
+				return i + 1
+			}
+			if s[i] == 0x1b && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return len(s)
+	}
+	if s[0] >= 0x20 && s[0] <= 0x7e {
+		return 1
+	}
+	return 0
+}
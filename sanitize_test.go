@@ -0,0 +1,64 @@
+package kslog
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"héllo ✓", "héllo ✓"},
+		{"forged\n0: x.go:1 0 : \"ok\"", `forged\n0: x.go:1 0 : "ok"`},
+		{"a\r\tb", `a\r\tb`},
+		{"nul\x00del\x7f", `nul\x00del\x7f`},
+		{"bad\xffutf8", "bad�utf8"},
+		{"\x1b[1;31mred\x1b[0m", "red"},
+		{"\x1b]0;title\x07text", "text"},
+		{"\x1b]0;title\x1b\\text", "text"},
+		{"\x1bcreset", "reset"},
+		{"c1\u0085line\u2028sep", `c1\u0085line\u2028sep`},
+	} {
+		if got := sanitize(test.in); got != test.want {
+			t.Errorf("sanitize(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestSanitizeRecord(t *testing.T) {
+	r := &Record{
+		Message: "a\nb",
+		Args: map[string]interface{}{
+			"key\n":  1,
+			"string": "\x1b[2J",
+			"error":  errors.New("x\ny"),
+			"level":  ERROR,
+			"int":    2,
+		},
+	}
+	sanitizeRecord(r)
+	want := &Record{
+		Message: `a\nb`,
+		Args: map[string]interface{}{
+			`key\n`:  1,
+			"string": "",
+			"error":  `x\ny`,
+			"level":  ERROR,
+			"int":    2,
+		},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("got %+v, want %+v", r, want)
+	}
+
+	SetSanitize(false)
+	defer SetSanitize(true)
+	r = &Record{Message: "a\nb"}
+	sanitizeRecord(r)
+	if r.Message != "a\nb" {
+		t.Errorf("got %q with sanitizing off, want it as is", r.Message)
+	}
+}
@@ -0,0 +1,149 @@
+package kslog
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// Scrubber returns s with the personal data it finds in it masked. It is
+// given the message and the string, error and fmt.Stringer argument
+// values of every record.
+type Scrubber func(s string) string
+
+// scrubbers are the scrubbers added by AddScrubber.
+var scrubbers struct {
+	list atomic.Pointer[[]Scrubber]
+	mu   sync.Mutex
+}
+
+// AddScrubber adds scrubber to those records go through before hooks,
+// and again after them, in the order they were added, e.g. the built in
+// ones and a pattern of your own:
+//
+//	kslog.AddScrubber(kslog.ScrubEmails)
+//	kslog.AddScrubber(kslog.ScrubCards)
+//	kslog.AddScrubber(kslog.ScrubSSNs)
+//	kslog.AddScrubber(kslog.ScrubPattern(regexp.MustCompile(`\bDE\d{20}\b`), "[IBAN]"))
+//
+// Scrubbers run on the goroutine writing records and must not log.
+func AddScrubber(scrubber Scrubber) {
+	scrubbers.mu.Lock()
+	defer scrubbers.mu.Unlock()
+
+	var list []Scrubber
+	if old := scrubbers.list.Load(); old != nil {
+		list = append(list, *old...)
+	}
+	list = append(list, scrubber)
+	scrubbers.list.Store(&list)
+}
+
+// ClearScrubbers removes all scrubbers.
+func ClearScrubbers() {
+	scrubbers.mu.Lock()
+	defer scrubbers.mu.Unlock()
+	scrubbers.list.Store(nil)
+}
+
+// ScrubPattern returns a Scrubber replacing the matches of re with
+// replacement, in which $1 stands for the first submatch like in
+// regexp.Regexp.ReplaceAllString.
+func ScrubPattern(re *regexp.Regexp, replacement string) Scrubber {
+	return func(s string) string {
+		return re.ReplaceAllString(s, replacement)
+	}
+}
+
+var (
+	emailPattern = regexp.MustCompile(`\b([A-Za-z0-9])[A-Za-z0-9._%+-]*@([A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,})\b`)
+	cardPattern  = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	ssnPattern   = regexp.MustCompile(`\b\d{3}-\d{2}-(\d{4})\b`)
+)
+
+// ScrubEmails masks e-mail addresses but the first character and the
+// domain: "jane.doe@example.com" is logged as "j***@example.com".
+func ScrubEmails(s string) string {
+	return emailPattern.ReplaceAllString(s, "$1***@$2")
+}
+
+// ScrubCards masks payment card numbers, of 13 to 19 digits passing the
+// Luhn check and maybe grouped by spaces or dashes, but their last four
+// digits: "4111 1111 1111 1111" is logged as "**** **** **** 1111".
+func ScrubCards(s string) string {
+	return cardPattern.ReplaceAllStringFunc(s, func(number string) string {
+		if !luhn(number) {
+			return number
+		}
+		b := []byte(number)
+		for i, n := len(b)-1, 0; i >= 0; i-- {
+			if b[i] >= '0' && b[i] <= '9' {
+				if n >= 4 {
+					b[i] = '*'
+				}
+				n++
+			}
+		}
+		return string(b)
+	})
+}
+
+// ScrubSSNs masks US social security numbers written like 123-45-6789
+// but their last four digits: "***-**-6789".
+func ScrubSSNs(s string) string {
+	return ssnPattern.ReplaceAllString(s, "***-**-$1")
+}
+
+// luhn tells whether the digits of number pass the Luhn check.
+func luhn(number string) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// scrubRecord runs the scrubbers over the message and argument values of
+// r.
+func scrubRecord(r *Record) {
+	p := scrubbers.list.Load()
+	if p == nil {
+		return
+	}
+	list := *p
+	r.Message = scrub(list, r.Message)
+	for k, v := range r.Args {
+		switch v := v.(type) {
+		case string:
+			r.Args[k] = scrub(list, v)
+		case error, fmt.Stringer:
+			s := fmt.Sprint(v)
+			if scrubbed := scrub(list, s); scrubbed != s {
+				r.Args[k] = scrubbed
+			}
+		}
+	}
+}
+
+// scrub returns s as the scrubbers in list leave it.
+func scrub(list []Scrubber, s string) string {
+	if s == "" {
+		return s
+	}
+	for _, f := range list {
+		s = f(s)
+	}
+	return s
+}
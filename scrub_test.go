@@ -0,0 +1,66 @@
+package kslog
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestScrubbers(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		scrubber Scrubber
+		in, want string
+	}{
+		{"email", ScrubEmails, "mail jane.doe@mail.example.com now", "mail j***@mail.example.com now"},
+		{"card", ScrubCards, "card 4111 1111 1111 1111", "card **** **** **** 1111"},
+		{"card dashes", ScrubCards, "4111-1111-1111-1111", "****-****-****-1111"},
+		{"card plain", ScrubCards, "5500000000000004", "************0004"},
+		{"not luhn", ScrubCards, "order 1234567890123", "order 1234567890123"},
+		{"ssn", ScrubSSNs, "ssn 123-45-6789", "ssn ***-**-6789"},
+		{"pattern", ScrubPattern(regexp.MustCompile(`token=(\w)\w*`), "token=$1***"), "token=abcdef", "token=a***"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.scrubber(test.in); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScrubLogged(t *testing.T) {
+	AddScrubber(ScrubEmails)
+	AddScrubber(ScrubSSNs)
+	defer ClearScrubbers()
+
+	l := NewLoggerQueue(16)
+	l.ResetSinks()
+	sink := new(recordSink)
+	l.AddSink(sink)
+
+	module := "test"
+	message := "from jane@example.com"
+	l.printex(INFO, &module, 0, &message, "ssn", "123-45-6789", "err", errors.New("no joe@example.org"), "n", 123456789)
+	l.Flush()
+
+	if len(sink.records) != 1 {
+		t.Fatalf("got %d records, want 1", len(sink.records))
+	}
+	r := sink.records[0]
+	if r.Message != "from j***@example.com" {
+		t.Errorf("got message %q", r.Message)
+	}
+	want := map[string]interface{}{"ssn": "***-**-6789", "err": "no j***@example.org", "n": 123456789}
+	for k, v := range want {
+		if r.Args[k] != v {
+			t.Errorf("got %s %v, want %v", k, r.Args[k], v)
+		}
+	}
+
+	ClearScrubbers()
+	l.printex(INFO, &module, 0, &message)
+	l.Flush()
+	if r := sink.records[1]; r.Message != message {
+		t.Errorf("got %q after ClearScrubbers, want it as is", r.Message)
+	}
+}
@@ -0,0 +1,65 @@
+package kslog
+
+// SecurityCategory classifies the records of security events, see
+// Security.
+type SecurityCategory string
+
+// The categories of security events.
+const (
+	SecAuthn        SecurityCategory = "authn"
+	SecAuthz        SecurityCategory = "authz"
+	SecDataAccess   SecurityCategory = "data-access"
+	SecConfigChange SecurityCategory = "config-change"
+)
+
+// Security, given among the fields of a call, marks its record as a
+// security event of category, which encoders write as a field of its own
+// and AddSecuritySink routes:
+//
+//	kslog.NoticeFields("auth", 401, "Login failed", kslog.Security(kslog.SecAuthn), kslog.String("user", user))
+func Security(category SecurityCategory) Field {
+	return Field{kind: fieldSecurity, str: string(category)}
+}
+
+// AddSecuritySink attaches s, e.g. a SIEM, to the logger to receive the
+// security events of categories, or of every category without any, and no
+// other records. It receives them whatever their level: levels, module
+// filters, sampling and rate limits don't keep security events from it.
+func (this *logger) AddSecuritySink(s Sink, categories ...SecurityCategory) {
+	this.setFallbackOf(s)
+	this.mu.Lock()
+	this.sinks = append(this.sinks, &sinkEntry{sink: s, level: DEBUG2, security: true, categories: categories})
+	this.updateVerbosest()
+	this.mu.Unlock()
+}
+
+// AddSecuritySink attaches a sink of security events to the default logger.
+func AddSecuritySink(s Sink, categories ...SecurityCategory) {
+	logging.AddSecuritySink(s, categories...)
+}
+
+// securityOf returns the security category among fields, or "".
+func securityOf(fields []Field) SecurityCategory {
+	for i := range fields {
+		if fields[i].kind == fieldSecurity {
+			return SecurityCategory(fields[i].str)
+		}
+	}
+	return ""
+}
+
+// getsSecurity reports whether the security sink e gets r.
+func (this *sinkEntry) getsSecurity(r *Record) bool {
+	if r.Security == "" {
+		return false
+	}
+	if len(this.categories) == 0 {
+		return true
+	}
+	for _, c := range this.categories {
+		if c == r.Security {
+			return true
+		}
+	}
+	return false
+}
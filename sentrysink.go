@@ -0,0 +1,228 @@
+package kslog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	mrand "math/rand"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SentrySinkConfig configures a SentrySink.
+type SentrySinkConfig struct {
+	// DSN is the project's client key URL.
+	DSN string
+	// Level is the least severe level sent, ERROR if nil, see LevelPtr;
+	// anything less severe than ERROR is treated as ERROR.
+	Level *Level
+	// SampleRate is the fraction of records sent, between 0 and 1.
+	// Zero means send everything.
+	SampleRate float64
+	// RateLimit caps events per second after a burst of RateBurst.
+	// They default to 1 and 10.
+	RateLimit float64
+	RateBurst int
+	// Environment and Release are attached to every event.
+	Environment string
+	Release     string
+}
+
+// SentrySink turns ERROR and more severe records into Sentry events,
+// carrying module, code, args and the stack of the logging call.
+type SentrySink struct {
+	config SentrySinkConfig
+	level  Level
+	url    string
+	auth   string
+	client *http.Client
+	batch  *batcher
+
+	mu      sync.Mutex
+	bucket  *tokenBucket
+	pause   time.Time
+	skipped uint64
+}
+
+// NewSentrySink returns a sink reporting to the project of dsn.
+func NewSentrySink(config SentrySinkConfig) (*SentrySink, error) {
+	dsn, err := url.Parse(config.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if dsn.User == nil || dsn.User.Username() == "" {
+		return nil, errors.New("Sentry DSN has no public key")
+	}
+	slash := strings.LastIndex(dsn.Path, "/")
+	project := dsn.Path[slash+1:]
+	if project == "" {
+		return nil, errors.New("Sentry DSN has no project id")
+	}
+
+	level := ERROR
+	if config.Level != nil && *config.Level < ERROR {
+		level = *config.Level
+	}
+	if config.RateLimit <= 0 {
+		config.RateLimit = 1
+	}
+	if config.RateBurst <= 0 {
+		config.RateBurst = 10
+	}
+
+	s := &SentrySink{
+		config: config,
+		level:  level,
+		url:    dsn.Scheme + "://" + dsn.Host + dsn.Path[:slash] + "/api/" + project + "/store/",
+		auth:   "Sentry sentry_version=7, sentry_client=kslog/1.0, sentry_key=" + dsn.User.Username(),
+		client: newHTTPClient(nil),
+		bucket: newTokenBucket(config.RateLimit, config.RateBurst),
+	}
+	if secret, ok := dsn.User.Password(); ok {
+		s.auth += ", sentry_secret=" + secret
+	}
+	s.batch = newBatcher(10, time.Second, 1, s.flush, nil)
+	return s, nil
+}
+
+func (this *SentrySink) Write(r *Record) error {
+	if r.Level > this.level {
+		return nil
+	}
+	if this.config.SampleRate > 0 && mrand.Float64() >= this.config.SampleRate {
+		return nil
+	}
+
+	now := time.Now()
+	this.mu.Lock()
+	allowed := now.After(this.pause) && this.bucket.allow(now)
+	if !allowed {
+		this.skipped++
+	}
+	this.mu.Unlock()
+
+	if allowed {
+		this.batch.add(r)
+	}
+	return nil
+}
+
+// Dropped returns how many records were rate limited or failed to send.
+func (this *SentrySink) Dropped() uint64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.skipped + this.batch.droppedCount()
+}
+
+func (this *SentrySink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close sends what is still pending and stops the sink.
+func (this *SentrySink) Close() error {
+	this.batch.close()
+	return nil
+}
+
+func sentryLevel(level Level) string {
+	if level <= CRIT {
+		return "fatal"
+	}
+	return "error"
+}
+
+func sentryFrames(stack []uintptr) []map[string]interface{} {
+	var frames []map[string]interface{}
+
+	it := runtime.CallersFrames(stack)
+	for {
+		frame, more := it.Next()
+		frames = append(frames, map[string]interface{}{
+			"function": frame.Function,
+			"abs_path": frame.File,
+			"filename": frame.File[strings.LastIndex(frame.File, "/")+1:],
+			"lineno":   frame.Line,
+			"in_app":   !strings.HasPrefix(frame.Function, "runtime."),
+		})
+		if !more {
+			break
+		}
+	}
+
+	// Sentry wants the outermost frame first.
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+func (this *SentrySink) event(r *Record) map[string]interface{} {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	exception := map[string]interface{}{
+		"type":  r.Module + "/" + strconv.Itoa(int(r.Code)),
+		"value": r.Message,
+	}
+	if len(r.Stack) > 0 {
+		exception["stacktrace"] = map[string]interface{}{"frames": sentryFrames(r.Stack)}
+	}
+
+	event := map[string]interface{}{
+		"event_id":  hex.EncodeToString(id),
+		"timestamp": r.Time.UTC().Format(time.RFC3339Nano),
+		"platform":  "go",
+		"level":     sentryLevel(r.Level),
+		"logger":    r.Module,
+		"message":   r.Message,
+		"tags": map[string]string{
+			"program": getProgram(),
+			"module":  r.Module,
+			"code":    strconv.Itoa(int(r.Code)),
+			"level":   r.Level.String(),
+		},
+		"extra":     jsonArgs(r.Args),
+		"exception": map[string]interface{}{"values": []interface{}{exception}},
+	}
+	if this.config.Environment != "" {
+		event["environment"] = this.config.Environment
+	}
+	if this.config.Release != "" {
+		event["release"] = this.config.Release
+	}
+	return event
+}
+
+func (this *SentrySink) flush(records []*Record) error {
+	header := http.Header{"X-Sentry-Auth": {this.auth}}
+
+	for i, r := range records {
+		event := this.event(r)
+		body, err := json.Marshal(event)
+		if err != nil {
+			event["extra"] = stringArgs(r.Args)
+			body, _ = json.Marshal(event)
+		}
+
+		err = postHTTP(this.client, this.url, "application/json", header, body, false)
+		if ra, ok := err.(retryAfterError); ok {
+			// Sentry is rate limiting this project; stop sending until it
+			// says we may continue.
+			this.mu.Lock()
+			this.pause = time.Now().Add(ra.after)
+			this.mu.Unlock()
+			return partialError{err, records[i:], true, nil}
+		}
+		if err != nil {
+			_, final := err.(permanentError)
+			return partialError{err, records[i:], final, nil}
+		}
+	}
+	return nil
+}
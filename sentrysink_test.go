@@ -0,0 +1,24 @@
+package kslog
+
+import "testing"
+
+func TestSentrySinkLevel(t *testing.T) {
+	for _, test := range []struct {
+		level *Level
+		want  Level
+	}{
+		{nil, ERROR},
+		{LevelPtr(EMERGE), EMERGE},
+		{LevelPtr(CRIT), CRIT},
+		{LevelPtr(DEBUG), ERROR},
+	} {
+		s, err := NewSentrySink(SentrySinkConfig{DSN: "https://key@sentry.example.com/42", Level: test.level})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.level != test.want {
+			t.Errorf("got %s, want %s", s.level, test.want)
+		}
+		s.Close()
+	}
+}
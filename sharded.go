@@ -0,0 +1,168 @@
+package kslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedSinkConfig configures a sharded sink. Either New or Format and
+// Writer are set.
+type ShardedSinkConfig struct {
+	// Shards is the number of shard goroutines, GOMAXPROCS by default,
+	// and Queue how many records each of them queues, 1000 by default.
+	Shards int
+	Queue  int
+	// New returns the sink of a shard, e.g. a file sink for segment
+	// app.<shard>.log. The records of a shard keep their order, but not
+	// those of different shards.
+	New func(shard int) (Sink, error)
+	// Format and Writer, instead, have the shards format records in
+	// parallel and a merge stage write them to Writer in order.
+	Format Formatter
+	Writer io.Writer
+}
+
+// shard is one goroutine of a sharded sink and its queue.
+type shard struct {
+	records chan *Record
+	out     chan []byte
+	sink    Sink
+}
+
+// ShardedSink spreads records over several goroutines, so that a service
+// logging on many cores isn't held up by the single sink goroutine
+// formatting and writing every record. Records are numbered as they are
+// written and handed to the shards in turn; in ordered mode the merge
+// stage takes them back by number.
+type ShardedSink struct {
+	config ShardedSinkConfig
+	shards []*shard
+	seq    uint64
+	wg     sync.WaitGroup
+	failed atomic.Uint64
+}
+
+// NewShardedSink returns a sharded sink configured by config, e.g. for
+// four log files written in parallel:
+//
+//	kslog.NewShardedSink(kslog.ShardedSinkConfig{Shards: 4, New: func(shard int) (kslog.Sink, error) {
+//		return kslog.NewFileSink(fmt.Sprintf("/var/log/app/app.%d.log", shard), kslog.JSONFormatter)
+//	}})
+func NewShardedSink(config ShardedSinkConfig) (*ShardedSink, error) {
+	ordered := config.Format != nil && config.Writer != nil
+	if (config.New == nil) == !ordered {
+		return nil, errors.New("Sharded sink needs either New or Format and Writer")
+	}
+	if config.Shards <= 0 {
+		config.Shards = runtime.GOMAXPROCS(0)
+	}
+	if config.Queue <= 0 {
+		config.Queue = defaultQueueSize
+	}
+
+	s := &ShardedSink{config: config}
+	for i := 0; i < config.Shards; i++ {
+		sh := &shard{records: make(chan *Record, config.Queue)}
+		if ordered {
+			sh.out = make(chan []byte, config.Queue)
+		} else {
+			sink, err := config.New(i)
+			if err != nil {
+				s.Close()
+				return nil, err
+			}
+			sh.sink = sink
+		}
+		s.shards = append(s.shards, sh)
+	}
+
+	for _, sh := range s.shards {
+		s.wg.Add(1)
+		go s.run(sh)
+	}
+	if ordered {
+		s.wg.Add(1)
+		go s.merge()
+	}
+	return s, nil
+}
+
+func (this *ShardedSink) Write(r *Record) error {
+	this.shards[this.seq%uint64(len(this.shards))].records <- r.Clone()
+	this.seq++
+	return nil
+}
+
+// Dropped returns how many records the shards failed to write.
+func (this *ShardedSink) Dropped() uint64 {
+	return this.failed.Load()
+}
+
+// Close waits for the shards to write what they queued and closes their
+// sinks.
+func (this *ShardedSink) Close() error {
+	for _, sh := range this.shards {
+		close(sh.records)
+	}
+	this.wg.Wait()
+
+	var first error
+	for _, sh := range this.shards {
+		if sh.sink == nil {
+			continue
+		}
+		if err := sh.sink.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// run writes, or formats for the merge stage, the records of a shard.
+func (this *ShardedSink) run(sh *shard) {
+	defer this.wg.Done()
+	for r := range sh.records {
+		if sh.out != nil {
+			sh.out <- this.config.Format(r)
+		} else if err := sh.sink.Write(r); err != nil {
+			this.failed.Add(1)
+		}
+	}
+	if sh.out != nil {
+		close(sh.out)
+	}
+}
+
+// merge writes the formatted records in the order they were numbered:
+// record n was handed to shard n modulo the number of shards.
+func (this *ShardedSink) merge() {
+	defer this.wg.Done()
+	w := bufio.NewWriter(this.config.Writer)
+	for n := 0; ; n++ {
+		sh := this.shards[n%len(this.shards)]
+		var data []byte
+		var ok bool
+		select {
+		case data, ok = <-sh.out:
+		default:
+			// Write out what is buffered before waiting.
+			if err := w.Flush(); err != nil {
+				this.failed.Add(1)
+			}
+			data, ok = <-sh.out
+		}
+		if !ok {
+			break
+		}
+		if _, err := w.Write(data); err != nil {
+			this.failed.Add(1)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		this.failed.Add(1)
+	}
+}
@@ -0,0 +1,117 @@
+package kslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// failSink fails every write.
+type failSink struct {
+	closed bool
+}
+
+func (this *failSink) Write(r *Record) error {
+	return errors.New("Failed")
+}
+
+func (this *failSink) Close() error {
+	this.closed = true
+	return nil
+}
+
+func TestShardedSinkConfig(t *testing.T) {
+	format := func(r *Record) []byte { return nil }
+	newSink := func(int) (Sink, error) { return new(recordSink), nil }
+	for _, config := range []ShardedSinkConfig{
+		{},
+		{Format: format},
+		{Writer: new(bytes.Buffer)},
+		{New: newSink, Format: format, Writer: new(bytes.Buffer)},
+	} {
+		if _, err := NewShardedSink(config); err == nil {
+			t.Errorf("%+v: got no error", config)
+		}
+	}
+
+	var sinks []*failSink
+	_, err := NewShardedSink(ShardedSinkConfig{Shards: 3, New: func(shard int) (Sink, error) {
+		if shard == 2 {
+			return nil, errors.New("No shard 2")
+		}
+		s := new(failSink)
+		sinks = append(sinks, s)
+		return s, nil
+	}})
+	if err == nil || err.Error() != "No shard 2" {
+		t.Errorf("got %v, want the error of New", err)
+	}
+	for i, s := range sinks {
+		if !s.closed {
+			t.Errorf("sink of shard %d not closed", i)
+		}
+	}
+}
+
+func TestShardedSinkOrdered(t *testing.T) {
+	var out bytes.Buffer
+	s, err := NewShardedSink(ShardedSinkConfig{
+		Shards: 4,
+		Queue:  8,
+		Format: func(r *Record) []byte { return []byte(r.Message + "\n") },
+		Writer: &out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want strings.Builder
+	for i := 0; i < 1000; i++ {
+		m := fmt.Sprint(i)
+		s.Write(&Record{Message: m})
+		want.WriteString(m + "\n")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want.String() {
+		t.Error("records written out of order")
+	}
+}
+
+func TestShardedSinkShards(t *testing.T) {
+	var sinks []*recordSink
+	s, err := NewShardedSink(ShardedSinkConfig{Shards: 3, New: func(int) (Sink, error) {
+		sink := new(recordSink)
+		sinks = append(sinks, sink)
+		return sink, nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		s.Write(&Record{Code: int32(i)})
+	}
+	s.Close()
+
+	for shard, sink := range sinks {
+		if len(sink.records) != 10 {
+			t.Fatalf("shard %d got %d records, want 10", shard, len(sink.records))
+		}
+		for i, r := range sink.records {
+			if want := int32(shard + 3*i); r.Code != want {
+				t.Errorf("shard %d got record %d, want %d", shard, r.Code, want)
+			}
+		}
+	}
+
+	s, _ = NewShardedSink(ShardedSinkConfig{Shards: 2, New: func(int) (Sink, error) { return new(failSink), nil }})
+	for i := 0; i < 5; i++ {
+		s.Write(&Record{})
+	}
+	s.Close()
+	if n := s.Dropped(); n != 5 {
+		t.Errorf("got %d dropped, want 5", n)
+	}
+}
@@ -0,0 +1,88 @@
+package kslog
+
+import "context"
+
+// Shutdown stops the logger for good: logging calls are ignored from then
+// on, the records already queued are handed to the sinks, and the sinks
+// are closed, making those that deliver in the background send what they
+// still hold. When ctx is done first, the records still queued are
+// abandoned, sinks still closing are left to finish in the background,
+// and ctx's error is returned. The count of abandoned records is returned
+// either way; they are also counted as dropped in Stats.
+func (this *logger) Shutdown(ctx context.Context) (int, error) {
+	this.mu.Lock()
+	this.closed = true
+	this.updateVerbosest()
+	this.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		this.Flush()
+		close(drained)
+	}()
+
+	abandoned := 0
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		abandoned = this.abandon()
+		err = ctx.Err()
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- this.closeSinks()
+	}()
+	select {
+	case cerr := <-closed:
+		if err == nil {
+			err = cerr
+		}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return abandoned, err
+}
+
+// Shutdown stops the default logger, see the logger's Shutdown.
+func Shutdown(ctx context.Context) (int, error) {
+	return logging.Shutdown(ctx)
+}
+
+// abandon empties the queue, returning how many records it dropped.
+func (this *logger) abandon() int {
+	n := 0
+	for r := this.queue.pop(false); r != nil; r = this.queue.pop(false) {
+		if r.keep {
+			this.kept.Add(-1)
+		}
+		switch {
+		case r.flushed != nil:
+			close(r.flushed)
+		case !r.marker():
+			this.countDropped(r)
+			releaseRecord(r)
+			n++
+		}
+	}
+	return n
+}
+
+// closeSinks closes and detaches all sinks, returning the first error.
+func (this *logger) closeSinks() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	var first error
+	for _, e := range this.sinks {
+		if err := e.sink.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	this.sinks = nil
+	if err := this.audit.close(); err != nil && first == nil {
+		first = err
+	}
+	return first
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+package kslog
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ReopenOnSIGHUP makes the default logger reopen its files whenever the
+// process gets SIGHUP, as logrotate's postrotate scripts usually send.
+func ReopenOnSIGHUP() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			Reopen()
+		}
+	}()
+}
+
+// raise sends sig to the process itself.
+func raise(sig os.Signal) {
+	if s, ok := sig.(syscall.Signal); ok {
+		syscall.Kill(os.Getpid(), s)
+	}
+}
+
+// BumpLevelOnSignal lets operators get more detail from a running daemon
+// without restarting it: SIGUSR1 makes the default logger's level one step
+// more verbose, toward DEBUG2, and SIGUSR2 one step less. The level goes
+// back to what it was revert after the last signal; zero or negative
+// keeps it. Each change is logged as a NOTICE.
+func BumpLevelOnSignal(revert time.Duration) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range c {
+			if sig == syscall.SIGUSR1 {
+				logging.bumpLevel(1, revert)
+			} else {
+				logging.bumpLevel(-1, revert)
+			}
+		}
+	}()
+}
@@ -0,0 +1,22 @@
+package kslog
+
+import (
+	"os"
+	"time"
+)
+
+// ReopenOnSIGHUP does nothing on Windows, which has no SIGHUP; call
+// Reopen instead.
+func ReopenOnSIGHUP() {
+}
+
+// BumpLevelOnSignal does nothing on Windows, which has no SIGUSR1 and
+// SIGUSR2; call SetLevel instead.
+func BumpLevelOnSignal(revert time.Duration) {
+}
+
+// raise exits the process, as Windows has no way to send sig to the
+// process itself.
+func raise(sig os.Signal) {
+	os.Exit(2)
+}
@@ -0,0 +1,113 @@
+package kslog
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+)
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLiteSink inserts records into a table of a SQLite database, indexed
+// by time, level, module and code so they can be queried with SQL:
+//
+//	SELECT datetime(time/1e9, 'unixepoch'), module, message
+//	FROM kslog WHERE level <= 3 AND time > strftime('%s','now','-1 day')*1e9
+//
+// The database is opened by the caller with the SQLite driver of their
+// choice (mattn/go-sqlite3, modernc.org/sqlite, ...), which keeps kslog
+// free of cgo and driver dependencies.
+type SQLiteSink struct {
+	db     *sql.DB
+	insert string
+	batch  *batcher
+}
+
+// NewSQLiteSink creates table and its indexes in db if needed and returns
+// a sink inserting into it. Records are inserted in batches, one
+// transaction per batch.
+func NewSQLiteSink(db *sql.DB, table string) (*SQLiteSink, error) {
+	if !sqlIdentifier.MatchString(table) {
+		return nil, errors.New("Bad table name " + table)
+	}
+
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			time INTEGER NOT NULL,
+			level INTEGER NOT NULL,
+			module TEXT NOT NULL,
+			code INTEGER NOT NULL,
+			file TEXT NOT NULL,
+			line INTEGER NOT NULL,
+			message TEXT NOT NULL,
+			args TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + table + `_time ON ` + table + ` (time)`,
+		`CREATE INDEX IF NOT EXISTS ` + table + `_level ON ` + table + ` (level, time)`,
+		`CREATE INDEX IF NOT EXISTS ` + table + `_module ON ` + table + ` (module, time)`,
+		`CREATE INDEX IF NOT EXISTS ` + table + `_code ON ` + table + ` (code, time)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &SQLiteSink{
+		db: db,
+		insert: `INSERT INTO ` + table + ` (time, level, module, code, file, line, message, args)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+	}
+	s.batch = newBatcher(defaultBatchSize, time.Second, 0, s.flush, nil)
+	return s, nil
+}
+
+func (this *SQLiteSink) Write(r *Record) error {
+	this.batch.add(r)
+	return nil
+}
+
+// Dropped returns how many records could not be inserted.
+func (this *SQLiteSink) Dropped() uint64 {
+	return this.batch.droppedCount()
+}
+
+func (this *SQLiteSink) setFallback(f func(*Record, error)) {
+	this.batch.fallback.Store(&f)
+}
+
+// Close inserts what is still pending. The database stays open.
+func (this *SQLiteSink) Close() error {
+	this.batch.close()
+	return nil
+}
+
+func (this *SQLiteSink) flush(records []*Record) error {
+	tx, err := this.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(this.insert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range records {
+		var args interface{}
+		if len(r.Args) > 0 {
+			args = string(encodeJSONArgs(r.Args))
+		}
+
+		_, err := stmt.Exec(r.Time.UnixNano(), int(r.Level), r.Module, r.Code, r.File, r.Line, r.Message, args)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
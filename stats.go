@@ -0,0 +1,56 @@
+package kslog
+
+// Statistics are the counters of a logger, see Stats.
+type Statistics struct {
+	// Emitted counts the records queued for the sinks by level, and
+	// Dropped those discarded because the queue was full.
+	Emitted [MAXLEVEL]uint64
+	Dropped [MAXLEVEL]uint64
+	// Sampled counts the records sampled out, see SetSampling, and
+	// Limited those suppressed by SetRateLimit.
+	Sampled [MAXLEVEL]uint64
+	Limited [MAXLEVEL]uint64
+	Sinks   []SinkStats
+}
+
+// SinkStats are the counters of one attached sink.
+type SinkStats struct {
+	Sink Sink
+	// Level is the most verbose level the sink gets; Disabled is set by
+	// SetSinkEnabled.
+	Level    Level
+	Disabled bool
+	// Failures counts the records the sink returned an error for.
+	Failures uint64
+	// Dropped is what the sink reports having given up on, for sinks with
+	// a Dropped method like the network sinks.
+	Dropped uint64
+}
+
+// Stats returns the logger's counters, so that lost records don't go
+// unnoticed.
+func (this *logger) Stats() Statistics {
+	var st Statistics
+	for l := range st.Emitted {
+		st.Emitted[l] = this.emitted[l].Load()
+		st.Dropped[l] = this.dropped[l].Load()
+		st.Sampled[l] = this.sampled[l].Load()
+		st.Limited[l] = this.limited[l].Load()
+	}
+
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	for _, e := range this.sinks {
+		ss := SinkStats{Sink: e.sink, Level: e.level, Disabled: e.disabled, Failures: e.failures.Load()}
+		if d, ok := e.sink.(interface{ Dropped() uint64 }); ok {
+			ss.Dropped = d.Dropped()
+		}
+		st.Sinks = append(st.Sinks, ss)
+	}
+	return st
+}
+
+// Stats returns the counters of the default logger.
+func Stats() Statistics {
+	return logging.Stats()
+}
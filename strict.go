@@ -0,0 +1,216 @@
+package kslog
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors of the Try functions.
+var (
+	ErrDropped  = errors.New("Record dropped, the queue is full")
+	ErrShutDown = errors.New("Logger is shut down")
+)
+
+// checkArgs returns what is wrong with the key value pairs of args, which
+// args2map would otherwise make up for.
+func checkArgs(args []interface{}) error {
+	pairs := 0
+	for _, arg := range args {
+		if _, ok := structValue(arg); ok && pairs%2 == 0 {
+			continue
+		}
+		if _, ok := arg.(string); !ok && pairs%2 == 0 && arg != nil {
+			return fmt.Errorf("Key %v is not a string", arg)
+		}
+		pairs++
+	}
+	if pairs%2 != 0 {
+		return errors.New("Bad key value match")
+	}
+	return nil
+}
+
+// closedErr returns ErrShutDown if the logger is shut down.
+func (this *logger) closedErr() error {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	if this.closed {
+		return ErrShutDown
+	}
+	return nil
+}
+
+func (this *logger) tryex(level Level, module *string, code int32, message *string, args ...interface{}) error {
+	err := checkArgs(args)
+	if !this.admit(level, *module, code) {
+		if cerr := this.closedErr(); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+	if !this.output(level, code, module, message, 0, args...) {
+		return ErrDropped
+	}
+	return err
+}
+
+func (this *logger) tryf(level Level, module *string, code int32, format string, args ...interface{}) error {
+	if !this.admit(level, *module, code) {
+		return this.closedErr()
+	}
+	err := checkFormat(format, args)
+	str := fmt.Sprintf(format, args...)
+	if !this.output(level, code, module, &str, 0) {
+		return ErrDropped
+	}
+	return err
+}
+
+// checkFormat returns what is wrong with format and args that fmt.Sprintf
+// would otherwise write into the message as "%!": a verb without an
+// argument or not fitting it, arguments left over, a bad argument index or
+// a bad * width or precision. Text the format or the arguments hold is
+// not looked at.
+func checkFormat(format string, args []interface{}) error {
+	bad := func(why string, a ...interface{}) error {
+		return fmt.Errorf("Bad format %q: %s", format, fmt.Sprintf(why, a...))
+	}
+	argNum, reordered := 0, false
+	// index parses an argument index like "[2]" at format[i:], if any.
+	index := func(i int) (int, error) {
+		if i >= len(format) || format[i] != '[' {
+			return i, nil
+		}
+		end := strings.IndexByte(format[i:], ']')
+		if end < 0 {
+			return i, bad("bad argument index")
+		}
+		n, err := strconv.Atoi(format[i+1 : i+end])
+		if err != nil || n < 1 || n > len(args) {
+			return i, bad("bad argument index %s", format[i:i+end+1])
+		}
+		argNum, reordered = n-1, true
+		return i + end + 1, nil
+	}
+	// number parses a width or precision at format[i:], consuming an int
+	// argument for a "*".
+	number := func(i int) (int, error) {
+		if i < len(format) && format[i] == '*' {
+			if argNum >= len(args) {
+				return i, bad("missing argument for *")
+			}
+			switch reflect.ValueOf(args[argNum]).Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			default:
+				return i, bad("* needs an integer, not %T", args[argNum])
+			}
+			argNum++
+			return i + 1, nil
+		}
+		for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+			i++
+		}
+		return i, nil
+	}
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			i++
+		}
+		var err error
+		if i, err = index(i); err != nil {
+			return err
+		}
+		if i, err = number(i); err != nil {
+			return err
+		}
+		if i < len(format) && format[i] == '.' {
+			if i, err = index(i + 1); err != nil {
+				return err
+			}
+			if i, err = number(i); err != nil {
+				return err
+			}
+		}
+		if i, err = index(i); err != nil {
+			return err
+		}
+		if i >= len(format) {
+			return bad("no verb at the end")
+		}
+		verb, size := utf8.DecodeRuneInString(format[i:])
+		i += size - 1
+		if verb == '%' {
+			continue
+		}
+		if argNum >= len(args) {
+			return bad("missing argument for %%%c", verb)
+		}
+		// fmt writes a verb not fitting its argument, or a panic of
+		// the argument's methods, as "%!verb(".
+		if s := fmt.Sprintf("%"+string(verb), args[argNum]); strings.HasPrefix(s, "%!"+string(verb)+"(") {
+			return bad("%%%c doesn't fit %T", verb, args[argNum])
+		}
+		argNum++
+	}
+	if !reordered && argNum < len(args) {
+		return bad("too many arguments, %d unused", len(args)-argNum)
+	}
+	return nil
+}
+
+// TryEmergef logs to the EMERGE log like Emergef; see TryErrorf.
+func TryEmergef(module string, code int32, format string, args ...interface{}) error {
+	return logging.tryf(EMERGE, &module, code, format, args...)
+}
+
+// TryEmergeEx logs to the EMERGE log like EmergeEx; see TryErrorEx.
+func TryEmergeEx(module string, code int32, message string, args ...interface{}) error {
+	return logging.tryex(EMERGE, &module, code, &message, args...)
+}
+
+// TryErrorf logs to the ERROR log like Errorf; see TryErrorEx. Arguments
+// that don't match the format are an error.
+func TryErrorf(module string, code int32, format string, args ...interface{}) error {
+	return logging.tryf(ERROR, &module, code, format, args...)
+}
+
+// TryErrorEx logs to the ERROR log like ErrorEx, for applications that
+// can't have records go missing or malformed silently. It returns
+// ErrDropped if the record was dropped for a full queue, see
+// SetBackpressure, ErrShutDown once the logger is shut down, and an error
+// if args aren't key value pairs, in which case the record is still
+// logged as ErrorEx logs it. Records left out by levels, filters,
+// sampling or rate limits are not an error.
+func TryErrorEx(module string, code int32, message string, args ...interface{}) error {
+	return logging.tryex(ERROR, &module, code, &message, args...)
+}
+
+// TryNoticef logs to the NOTICE log like Noticef; see TryErrorf.
+func TryNoticef(module string, code int32, format string, args ...interface{}) error {
+	return logging.tryf(NOTICE, &module, code, format, args...)
+}
+
+// TryNoticeEx logs to the NOTICE log like NoticeEx; see TryErrorEx.
+func TryNoticeEx(module string, code int32, message string, args ...interface{}) error {
+	return logging.tryex(NOTICE, &module, code, &message, args...)
+}
+
+// TryInfof logs to the INFO log like Infof; see TryErrorf.
+func TryInfof(module string, code int32, format string, args ...interface{}) error {
+	return logging.tryf(INFO, &module, code, format, args...)
+}
+
+// TryInfoEx logs to the INFO log like InfoEx; see TryErrorEx.
+func TryInfoEx(module string, code int32, message string, args ...interface{}) error {
+	return logging.tryex(INFO, &module, code, &message, args...)
+}
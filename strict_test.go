@@ -0,0 +1,46 @@
+package kslog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheckFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []interface{}
+		err    string
+	}{
+		{format: "%d items", args: []interface{}{3}},
+		{format: "input %s", args: []interface{}{"50%! off"}},
+		{format: "%5.2f%% %-4q", args: []interface{}{1.5, "x"}},
+		{format: "%*d %.*f", args: []interface{}{3, 4, 2, 1.5}},
+		{format: "%[2]s %[1]s", args: []interface{}{"a", "b"}},
+		{format: "%v %x %T", args: []interface{}{nil, []byte("x"), 1}},
+		{format: "%d", args: []interface{}{"x"}, err: "%d doesn't fit string"},
+		{format: "%w", args: []interface{}{errors.New("x")}, err: "%w doesn't fit *errors.errorString"},
+		{format: "%s %s", args: []interface{}{"a"}, err: "missing argument for %s"},
+		{format: "%s", args: []interface{}{"a", "b"}, err: "too many arguments, 1 unused"},
+		{format: "%[3]s", args: []interface{}{"a"}, err: "bad argument index [3]"},
+		{format: "%*d", args: []interface{}{"x", 1}, err: "* needs an integer, not string"},
+		{format: "50%", err: "no verb at the end"},
+	}
+	for _, test := range tests {
+		err := checkFormat(test.format, test.args)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%q: %v", test.format, err)
+			}
+			continue
+		}
+		if want := fmt.Sprintf("Bad format %q: %s", test.format, test.err); err == nil || err.Error() != want {
+			t.Errorf("%q: got %v, want %s", test.format, err, want)
+		}
+		// fmt agrees.
+		if !strings.Contains(fmt.Sprintf(test.format, test.args...), "%!") {
+			t.Errorf("%q: fmt finds nothing wrong", test.format)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package kslog
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Limits of expandStruct: how deep nested structs are expanded, and how
+// many fields of a struct are added at most.
+const (
+	maxStructDepth  = 3
+	maxStructFields = 64
+)
+
+// structValue returns the struct arg is, or points to, unless it has a
+// text form of its own, as a time.Time or an error has.
+func structValue(arg interface{}) (reflect.Value, bool) {
+	switch arg.(type) {
+	case nil, fmt.Stringer, error:
+		return reflect.Value{}, false
+	}
+	v := reflect.ValueOf(arg)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, v.Kind() == reflect.Struct
+}
+
+// expandStruct adds the exported fields of v to argsMap, named by their
+// `kslog:"name"` tag or else their name, after prefix; a field tagged
+// `kslog:"-"` is left out. Nested structs are expanded with their name
+// and a dot as prefix, embedded ones without, down to maxStructDepth.
+// Fields beyond maxStructFields are left out, which is noted under
+// keyWarning.
+func expandStruct(argsMap map[string]interface{}, prefix string, v reflect.Value, depth int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("kslog"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag, _, _ = strings.Cut(tag, ","); tag != "" {
+				name = tag
+			}
+		}
+
+		fv := v.Field(i)
+		if depth < maxStructDepth {
+			if nested, ok := fieldStruct(fv); ok {
+				if f.Anonymous {
+					expandStruct(argsMap, prefix, nested, depth+1)
+				} else {
+					expandStruct(argsMap, prefix+name+".", nested, depth+1)
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if len(argsMap) >= maxStructFields {
+			argsMap[keyWarning] = fmt.Sprintf("Fields of %s beyond %d left out", t, maxStructFields)
+			return
+		}
+		argsMap[prefix+name] = fv.Interface()
+	}
+}
+
+// fieldStruct returns the struct the field v is, or points to, for
+// expanding.
+func fieldStruct(v reflect.Value) (reflect.Value, bool) {
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct || !v.CanInterface() {
+		return reflect.Value{}, false
+	}
+	return structValue(v.Interface())
+}
@@ -0,0 +1,90 @@
+package kslog
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testInner struct {
+	Port int
+}
+
+// Embedded is exported, as the fields of an unexported embedded type
+// can't be read through reflection.
+type Embedded struct {
+	Region string
+}
+
+type testArgs struct {
+	Embedded
+	Name    string `kslog:"name"`
+	Secret  string `kslog:"-"`
+	private int
+	Addr    testInner
+	Ptr     *testInner
+	Started time.Time
+}
+
+type testDeep struct {
+	Next *testDeep
+	N    int
+}
+
+func TestExpandStruct(t *testing.T) {
+	started := time.Unix(0, 0)
+	arg := testArgs{
+		Embedded: Embedded{"eu"},
+		Name:     "db",
+		Secret:   "x",
+		private:  1,
+		Addr:     testInner{80},
+		Ptr:      &testInner{443},
+		Started:  started,
+	}
+	want := map[string]interface{}{
+		"Region":    "eu",
+		"name":      "db",
+		"Addr.Port": 80,
+		"Ptr.Port":  443,
+		"Started":   started,
+		"a":         1,
+	}
+	for _, arg := range []interface{}{arg, &arg} {
+		got := make(map[string]interface{})
+		args2map(got, arg, "a", 1)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%T: got %v, want %v", arg, got, want)
+		}
+	}
+}
+
+func TestExpandStructLimits(t *testing.T) {
+	deep := &testDeep{N: 0}
+	for n := 1; n <= maxStructDepth+2; n++ {
+		deep = &testDeep{Next: deep, N: n}
+	}
+	got := make(map[string]interface{})
+	args2map(got, deep)
+	if _, ok := got["N"]; !ok {
+		t.Errorf("got %v, want N", got)
+	}
+	// N at every depth down to maxStructDepth, and the struct below as is.
+	last := strings.Repeat("Next.", maxStructDepth) + "Next"
+	if _, ok := got[last].(*testDeep); !ok || len(got) != maxStructDepth+2 {
+		t.Errorf("got %v, want %d fields ending in %s", got, maxStructDepth+2, last)
+	}
+
+	fields := make([]reflect.StructField, maxStructFields+10)
+	for i := range fields {
+		fields[i] = reflect.StructField{Name: fmt.Sprintf("F%d", i), Type: reflect.TypeOf(0)}
+	}
+	wide := reflect.New(reflect.StructOf(fields)).Elem().Interface()
+	got = make(map[string]interface{})
+	args2map(got, wide)
+	if len(got) != maxStructFields+1 || got[keyWarning] == nil {
+		t.Errorf("got %d fields and warning %v, want %d and a warning", len(got), got[keyWarning], maxStructFields)
+	}
+}
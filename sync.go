@@ -0,0 +1,32 @@
+package kslog
+
+// SetSync switches synchronous mode on or off. In synchronous mode logging
+// calls hand their records to the sinks themselves and return once they
+// are written, rather than queuing them for the sink goroutine: for CLIs,
+// tests and crash paths, where records still queued are lost when the
+// process exits. Calls then wait for the sinks, and for each other.
+func (this *logger) SetSync(sync bool) {
+	this.sync.Store(sync)
+	// Records queued before are written first.
+	this.Flush()
+}
+
+// SetSync switches synchronous mode of the default logger.
+func SetSync(sync bool) {
+	logging.SetSync(sync)
+}
+
+// writeNow hands r to the sinks in the calling goroutine.
+func (this *logger) writeNow(r *Record) {
+	this.writing.Lock()
+	defer this.writing.Unlock()
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	if this.repeated(r) {
+		releaseRecord(r)
+		return
+	}
+	this.write(r)
+	this.endBatch()
+}
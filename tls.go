@@ -0,0 +1,48 @@
+package kslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+)
+
+// TLSConfig builds a client tls.Config for the remote sinks.
+// caFile is a PEM bundle of CAs trusted to sign the collector's certificate;
+// when empty the system roots are used. certFile and keyFile, when given,
+// hold the client certificate presented for mutual TLS.
+func TLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificates found in " + caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// NewTLSSink returns a NetSink that sends over a TLS connection to addr.
+// The server name is taken from addr unless config sets one.
+func NewTLSSink(addr string, config *tls.Config, bufsize int) *NetSink {
+	dialer := &net.Dialer{Timeout: netDialTimeout}
+	return newNetSink(bufsize, func() (net.Conn, error) {
+		return tls.DialWithDialer(dialer, "tcp", addr, config)
+	})
+}
@@ -0,0 +1,38 @@
+//go:build !kslog_notrace && !kslog_nodebug
+// +build !kslog_notrace,!kslog_nodebug
+
+package kslog
+
+import "context"
+
+// traceLevel is DEBUG2 without the kslog_notrace and kslog_nodebug build
+// tags.
+const traceLevel = DEBUG2
+
+// Debug2f logs to the DEBUG2 log.
+// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
+func Debug2f(module string, code int32, format string, args ...interface{}) {
+	logging.printf(DEBUG2, &module, code, format, args...)
+}
+
+// Debug2 logs to the DEBUG2 log.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func Debug2(module string, code int32, args ...interface{}) {
+	logging.print(DEBUG2, &module, code, args...)
+}
+
+// Debug2 logs to the DEBUG2 log.
+// Argument are string and anonymous struct
+func Debug2Ex(module string, code int32, message string, args ...interface{}) {
+	logging.printex(DEBUG2, &module, code, &message, args...)
+}
+
+// Debug2Fields logs to the DEBUG2 log with typed fields; it doesn't allocate.
+func Debug2Fields(module string, code int32, message string, fields ...Field) {
+	logging.printFields(DEBUG2, module, code, message, fields...)
+}
+
+// Debug2Ctx logs to the DEBUG2 log like Debug2Ex, with what ctx carries.
+func Debug2Ctx(ctx context.Context, module string, code int32, message string, args ...interface{}) {
+	logging.printctx(ctx, DEBUG2, &module, code, &message, args...)
+}
@@ -0,0 +1,24 @@
+//go:build kslog_notrace || kslog_nodebug
+// +build kslog_notrace kslog_nodebug
+
+package kslog
+
+import "context"
+
+// traceLevel is DEBUG with the kslog_notrace or kslog_nodebug build tag.
+const traceLevel = DEBUG
+
+// Debug2f is a no-op with the kslog_notrace build tag.
+func Debug2f(module string, code int32, format string, args ...interface{}) {}
+
+// Debug2 is a no-op with the kslog_notrace build tag.
+func Debug2(module string, code int32, args ...interface{}) {}
+
+// Debug2Ex is a no-op with the kslog_notrace build tag.
+func Debug2Ex(module string, code int32, message string, args ...interface{}) {}
+
+// Debug2Fields is a no-op with the kslog_notrace build tag.
+func Debug2Fields(module string, code int32, message string, fields ...Field) {}
+
+// Debug2Ctx is a no-op with the kslog_notrace build tag.
+func Debug2Ctx(ctx context.Context, module string, code int32, message string, args ...interface{}) {}
@@ -0,0 +1,127 @@
+package kslog
+
+// TraceOnErrorConfig configures EnableTraceOnError.
+type TraceOnErrorConfig struct {
+	// Level is the least severe level kept, DEBUG2 if nil, see LevelPtr.
+	Level *Level
+	// Size is how many records are kept by correlation ID, 100 by
+	// default, and MaxIDs for how many IDs at most, 1000 by default; the
+	// records of the ID seen first are dropped to make room.
+	Size   int
+	MaxIDs int
+}
+
+// traceBuffer holds the records kept by correlation ID. It is only used
+// by the goroutine writing records.
+type traceBuffer struct {
+	config  TraceOnErrorConfig
+	level   Level
+	records map[string][]*Record
+	ids     []string
+}
+
+// EnableTraceOnError keeps the records of the Ctx functions that the
+// levels drop, such as DEBUG records of a service logging at INFO, by the
+// correlation ID of their context, see WithCorrelationID. When a record
+// with the same correlation ID is logged at ERROR or more severe, the
+// records kept are written first, whatever the levels of the sinks, with
+// a "traced" arg, giving detailed traces only around failures. Records
+// are kept in memory only; they are built whether they are written or
+// not, at the cost it takes.
+func (this *logger) EnableTraceOnError(config TraceOnErrorConfig) {
+	level := DEBUG2
+	if config.Level != nil {
+		level = *config.Level
+	}
+	if config.Size <= 0 {
+		config.Size = 100
+	}
+	if config.MaxIDs <= 0 {
+		config.MaxIDs = 1000
+	}
+	this.traces.Store(&traceBuffer{config: config, level: level, records: make(map[string][]*Record)})
+}
+
+// DisableTraceOnError stops keeping records, dropping those kept.
+func (this *logger) DisableTraceOnError() {
+	this.traces.Store(nil)
+}
+
+// EnableTraceOnError keeps records of the default logger for errors.
+func EnableTraceOnError(config TraceOnErrorConfig) {
+	logging.EnableTraceOnError(config)
+}
+
+// DisableTraceOnError stops keeping records of the default logger.
+func DisableTraceOnError() {
+	logging.DisableTraceOnError()
+}
+
+// outputTraced is output for a record kept for trace on error.
+func (this *logger) outputTraced(level Level, code int32, module *string, message *string, args ...interface{}) {
+	file, line := "", 0
+	if !this.noCaller.Load() {
+		file, line = getCaller(4)
+	}
+
+	item := this.newItem(level, code, *module, *message, file, line)
+	args2map(item.Args, args...)
+	item.traced = true
+	this.enqueue(item)
+}
+
+// keepTrace keeps r, which is then no longer the caller's.
+func (this *logger) keepTrace(r *Record) {
+	t := this.traces.Load()
+	id, _ := r.Args["correlation_id"].(string)
+	if t == nil || id == "" {
+		releaseRecord(r)
+		return
+	}
+
+	records, ok := t.records[id]
+	if !ok {
+		if len(t.ids) >= t.config.MaxIDs {
+			t.drop(t.ids[0])
+		}
+		t.ids = append(t.ids, id)
+	}
+	if len(records) >= t.config.Size {
+		releaseRecord(records[0])
+		records = records[1:]
+	}
+	t.records[id] = append(records, r)
+}
+
+// flushTrace writes the records kept with the correlation ID of r.
+func (this *logger) flushTrace(r *Record) {
+	t := this.traces.Load()
+	if t == nil {
+		return
+	}
+	id, _ := r.Args["correlation_id"].(string)
+	records := t.records[id]
+	if records == nil {
+		return
+	}
+	t.records[id] = nil
+	t.drop(id)
+	for _, kept := range records {
+		kept.Args["traced"] = true
+		this.deliver(kept)
+	}
+}
+
+// drop forgets the records of id, released unless already taken.
+func (this *traceBuffer) drop(id string) {
+	for _, r := range this.records[id] {
+		releaseRecord(r)
+	}
+	delete(this.records, id)
+	for i, kept := range this.ids {
+		if kept == id {
+			this.ids = append(this.ids[:i], this.ids[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package kslog
+
+import "testing"
+
+func TestTraceOnErrorLevel(t *testing.T) {
+	l := NewDiscardLogger()
+	for _, test := range []struct {
+		level *Level
+		want  Level
+	}{
+		{nil, DEBUG2},
+		{LevelPtr(EMERGE), EMERGE},
+		{LevelPtr(INFO), INFO},
+	} {
+		l.EnableTraceOnError(TraceOnErrorConfig{Level: test.level})
+		if got := l.traces.Load().level; got != test.want {
+			t.Errorf("got %s, want %s", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package kslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Payload styles of WebhookSink.
+const (
+	WebhookGeneric = iota
+	WebhookSlack
+	WebhookTeams
+)
+
+const (
+	webhookMaxLines   = 20
+	webhookMaxPending = 100
+)
+
+// WebhookSinkConfig configures a WebhookSink.
+type WebhookSinkConfig struct {
+	URL string
+	// Format is one of the Webhook constants.
+	Format int
+	// Level is the least severe level posted, CRIT if nil, see LevelPtr;
+	// anything less severe than CRIT is treated as CRIT.
+	Level *Level
+	// Window is the minimum time between two posts, default one minute.
+	// Records arriving within it are aggregated into the next post, up
+	// to 100; past that the oldest are dropped and only counted in it.
+	Window time.Duration
+	Header http.Header
+	// MaxRetries is how often a failed post is retried, default 3; see
+	// NoRetries and RetryForever.
+	MaxRetries int
+}
+
+// WebhookSink posts CRIT, ALERT and EMERGE records to a chat or generic
+// webhook. The first record after a quiet period is posted right away;
+// later ones are collected and posted together once per Window so an
+// incident can't flood the channel.
+type WebhookSink struct {
+	config WebhookSinkConfig
+	level  Level
+	client *http.Client
+
+	mu      sync.Mutex
+	pending []*Record
+	// skipped counts the records dropped for the next post, dropped all
+	// records dropped.
+	skipped int
+	dropped uint64
+	last    time.Time
+	timer   *time.Timer
+	closed  bool
+	sending sync.WaitGroup
+	done    chan struct{}
+
+	fallback atomic.Pointer[func(*Record, error)]
+}
+
+// NewWebhookSink returns a sink posting to config.URL.
+func NewWebhookSink(config WebhookSinkConfig) *WebhookSink {
+	level := CRIT
+	if config.Level != nil && *config.Level < CRIT {
+		level = *config.Level
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	config.MaxRetries = maxRetries(config.MaxRetries)
+
+	return &WebhookSink{
+		config: config,
+		level:  level,
+		client: newHTTPClient(nil),
+		done:   make(chan struct{}),
+	}
+}
+
+func (this *WebhookSink) Write(r *Record) error {
+	if r.Level > this.level {
+		return nil
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return nil
+	}
+	if len(this.pending) >= webhookMaxPending {
+		this.pending = this.pending[1:]
+		this.skipped++
+		this.dropped++
+	}
+	this.pending = append(this.pending, r.Clone())
+	if this.timer != nil {
+		return nil
+	}
+
+	wait := this.config.Window - time.Since(this.last)
+	if wait < 0 {
+		wait = 0
+	}
+	this.sending.Add(1)
+	this.timer = time.AfterFunc(wait, this.send)
+	return nil
+}
+
+// Dropped returns how many records were dropped, for the limit of a post
+// or because it failed.
+func (this *WebhookSink) Dropped() uint64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.dropped
+}
+
+// Close posts whatever is still waiting for the window to pass, and
+// stops retrying failed posts.
+func (this *WebhookSink) Close() error {
+	this.mu.Lock()
+	if this.closed {
+		this.mu.Unlock()
+		return nil
+	}
+	this.closed = true
+	close(this.done)
+	if this.timer != nil && this.timer.Stop() {
+		this.mu.Unlock()
+		this.send()
+	} else {
+		this.mu.Unlock()
+	}
+
+	this.sending.Wait()
+	return nil
+}
+
+func (this *WebhookSink) setFallback(f func(*Record, error)) {
+	this.fallback.Store(&f)
+}
+
+func (this *WebhookSink) send() {
+	defer this.sending.Done()
+
+	this.mu.Lock()
+	records, skipped := this.pending, this.skipped
+	this.pending, this.skipped = nil, 0
+	this.timer = nil
+	this.last = time.Now()
+	this.mu.Unlock()
+
+	if len(records) == 0 {
+		return
+	}
+
+	body, _ := json.Marshal(this.payload(records, skipped))
+	if err := this.post(body); err != nil {
+		this.mu.Lock()
+		this.dropped += uint64(len(records))
+		this.mu.Unlock()
+		notifyError(fmt.Errorf("Webhook sink: dropped %d records: %w", len(records), err))
+		if f := this.fallback.Load(); f != nil {
+			for _, r := range records {
+				(*f)(r, err)
+			}
+		}
+	}
+}
+
+// post posts body, retrying 429 and 5xx responses and network errors with
+// backoff like the batcher does.
+func (this *WebhookSink) post(body []byte) error {
+	backoff := netMinBackoff
+	for attempt := 0; ; attempt++ {
+		err := postHTTP(this.client, this.config.URL, "application/json", this.config.Header, body, false)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(permanentError); ok || (this.config.MaxRetries >= 0 && attempt >= this.config.MaxRetries) {
+			return err
+		}
+
+		wait := backoff
+		if ra, ok := err.(retryAfterError); ok && ra.after > wait {
+			wait = ra.after
+		}
+		select {
+		case <-time.After(wait):
+		case <-this.done:
+			return err
+		}
+		if backoff *= 2; backoff > netMaxBackoff {
+			backoff = netMaxBackoff
+		}
+	}
+}
+
+// payload returns the post of records, after skipped more were dropped.
+func (this *WebhookSink) payload(records []*Record, skipped int) interface{} {
+	if this.config.Format == WebhookGeneric {
+		var list []json.RawMessage
+		for _, r := range records {
+			list = append(list, encodeJSON(r))
+		}
+		return map[string]interface{}{
+			"program": getProgram(),
+			"count":   len(records),
+			"dropped": skipped,
+			"records": list,
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if len(records) == 1 && skipped == 0 {
+		fmt.Fprintf(buf, "%s: %s record\n", getProgram(), records[0].Level)
+	} else {
+		fmt.Fprintf(buf, "%s: %d records\n", getProgram(), len(records)+skipped)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(buf, "%d oldest records dropped\n", skipped)
+	}
+	for i, r := range records {
+		if i == webhookMaxLines {
+			fmt.Fprintf(buf, "... and %d more\n", len(records)-i)
+			break
+		}
+		fmt.Fprintf(buf, "[%s] %s/%d %s:%d %s\n", r.Level, r.Module, r.Code, r.File, r.Line, r.Message)
+	}
+
+	if this.config.Format == WebhookTeams {
+		return map[string]interface{}{
+			"@type":    "MessageCard",
+			"@context": "http://schema.org/extensions",
+			"summary":  getProgram() + " alert",
+			"text":     "<pre>" + buf.String() + "</pre>",
+		}
+	}
+	return map[string]string{"text": "```" + buf.String() + "```"}
+}
@@ -0,0 +1,123 @@
+package kslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookServer answers the first fail posts with status.
+func webhookServer(t *testing.T, status int, fail int32) (*httptest.Server, *int32, *int32) {
+	var posts, ok int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&posts, 1) <= fail {
+			w.WriteHeader(status)
+			return
+		}
+		atomic.AddInt32(&ok, 1)
+	}))
+	t.Cleanup(server.Close)
+	return server, &posts, &ok
+}
+
+func TestWebhookSinkRetry(t *testing.T) {
+	var errs []error
+	var mu sync.Mutex
+	SetErrorHandler(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	defer SetErrorHandler(nil)
+
+	// An unavailable endpoint is retried.
+	server, posts, ok := webhookServer(t, http.StatusServiceUnavailable, 2)
+	s := NewWebhookSink(WebhookSinkConfig{URL: server.URL, Window: time.Millisecond})
+	s.Write(&Record{Message: "down", Level: CRIT})
+	for i := 0; i < 200 && atomic.LoadInt32(ok) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Close()
+	if atomic.LoadInt32(posts) != 3 || atomic.LoadInt32(ok) != 1 {
+		t.Errorf("got %d posts, %d accepted, want the post retried", atomic.LoadInt32(posts), atomic.LoadInt32(ok))
+	}
+
+	// A rejected post isn't, and is reported.
+	server, posts, _ = webhookServer(t, http.StatusBadRequest, 1)
+	s = NewWebhookSink(WebhookSinkConfig{URL: server.URL, Window: time.Millisecond})
+	s.Write(&Record{Message: "rejected", Level: CRIT})
+	time.Sleep(50 * time.Millisecond)
+	s.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if atomic.LoadInt32(posts) != 1 || len(errs) != 1 || !strings.Contains(errs[0].Error(), "400") {
+		t.Errorf("got %d posts, errors %v", atomic.LoadInt32(posts), errs)
+	}
+}
+
+func TestWebhookSinkStorm(t *testing.T) {
+	var mu sync.Mutex
+	var posts []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var post map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&post)
+		mu.Lock()
+		posts = append(posts, post)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	s := NewWebhookSink(WebhookSinkConfig{URL: server.URL, Window: time.Hour})
+	s.Write(&Record{Message: "first", Level: CRIT})
+	for i := 0; i < 200; i++ {
+		mu.Lock()
+		n := len(posts)
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The storm waits for the window, and is cut down to the newest 100.
+	for i := 0; i < 1000; i++ {
+		s.Write(&Record{Message: fmt.Sprintf("storm %d", i), Level: CRIT})
+	}
+	s.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(posts) != 2 {
+		t.Fatalf("got %d posts, want 2", len(posts))
+	}
+	post := posts[1]
+	records, _ := post["records"].([]interface{})
+	if post["count"] != 100.0 || post["dropped"] != 900.0 || len(records) != 100 || s.Dropped() != 900 {
+		t.Errorf("got count %v, dropped %v, %d records, Dropped %d", post["count"], post["dropped"], len(records), s.Dropped())
+	}
+	if last, _ := records[99].(map[string]interface{}); last["message"] != "storm 999" {
+		t.Errorf("the last record is %v", last)
+	}
+}
+
+func TestWebhookSinkLevel(t *testing.T) {
+	for _, test := range []struct {
+		level *Level
+		want  Level
+	}{
+		{nil, CRIT},
+		{LevelPtr(EMERGE), EMERGE},
+		{LevelPtr(ERROR), CRIT},
+	} {
+		s := NewWebhookSink(WebhookSinkConfig{URL: "http://127.0.0.1:1", Level: test.level})
+		if s.level != test.want {
+			t.Errorf("got %s, want %s", s.level, test.want)
+		}
+		s.Close()
+	}
+}